@@ -5,10 +5,13 @@ go 1.13
 require (
 	github.com/Venafi/vcert v3.18.4+incompatible
 	github.com/Venafi/vcert/v4 v4.13.0
+	github.com/armon/go-metrics v0.3.3
 	github.com/hashicorp/go-hclog v0.14.1
 	github.com/hashicorp/vault/api v1.0.4
 	github.com/hashicorp/vault/sdk v0.1.13
 	github.com/onsi/ginkgo v1.14.0
 	github.com/onsi/gomega v1.10.1
 	github.com/rendon/testcli v0.0.0-20161027181003-6283090d169f
+	github.com/ryanuber/go-glob v1.0.0
+	golang.org/x/crypto v0.0.0-20190605123033-f99c8df09eb5
 )
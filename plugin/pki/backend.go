@@ -3,8 +3,11 @@ package pki
 import (
 	"context"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/logical"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Factory creates a new backend implementing the logical.Backend interface
@@ -34,17 +37,33 @@ func Backend(conf *logical.BackendConfig) *backend {
 			pathCredentialsList(&b),
 			pathCredentials(&b),
 			pathVenafiCertEnroll(&b),
+			pathVenafiCertBatch(&b),
 			pathVenafiCertSign(&b),
+			pathVenafiCertValidate(&b),
 			pathVenafiCertRead(&b),
 			pathVenafiCertRevoke(&b),
+			pathVenafiCertRenew(&b),
+			pathVenafiCertImport(&b),
 			pathVenafiFetchListCerts(&b),
+			pathVenafiCA(&b),
+			pathVenafiConnectionTest(&b),
+			pathVenafiWhoami(&b),
+			pathVenafiHealth(&b),
+			pathVenafiPickupStatus(&b),
+			pathVenafiPickup(&b),
+			pathMetrics(&b),
+			pathTidy(&b),
+			pathTidyStatus(&b),
+			pathConfigLimits(&b),
 		},
 
 		Secrets: []*framework.Secret{
 			secretCerts(&b),
 		},
 
-		BackendType: logical.TypeLogical,
+		InitializeFunc: b.initialize,
+		Invalidate:     b.invalidate,
+		BackendType:    logical.TypeLogical,
 	}
 	b.storage = conf.StorageView
 	return &b
@@ -53,6 +72,45 @@ func Backend(conf *logical.BackendConfig) *backend {
 type backend struct {
 	*framework.Backend
 	storage logical.Storage
+
+	keyGenLock  sync.Mutex
+	keyGenSlots map[string]chan struct{}
+
+	caChainLock  sync.Mutex
+	caChainCache map[string]cachedCAChain
+
+	customFieldsLock  sync.Mutex
+	customFieldsCache map[string]cachedCustomFields
+
+	tidyLock sync.Mutex
+	tidy     *tidyStatus
+
+	metricsLock sync.Mutex
+	metrics     map[string]*roleMetrics
+
+	healthLock sync.Mutex
+	health     map[string]roleHealth
+
+	zonesLock    sync.Mutex
+	zoneRotation map[string]int
+	zoneFailures map[string]time.Time
+
+	requestSlotsLock   sync.Mutex
+	requestSlots       chan struct{}
+	requestLimit       int
+	requestLimitLoaded bool
+}
+
+// initialize builds the common name index of the certificates stored by earlier versions when the plugin is mounted.
+// A failure doesn't fail the mount, the index is built by the next tidy operation.
+func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby | consts.ReplicationPerformanceSecondary) {
+		return nil
+	}
+	if err := buildCNIndex(ctx, req.Storage); err != nil {
+		b.Logger().Error("Failed to build the common name index, it will be built by the next tidy operation", "error", err)
+	}
+	return nil
 }
 
 const (
@@ -59,7 +59,15 @@ func TestFakeEndpoints(t *testing.T) {
 	t.Run("fake list certificates", integrationTestEnv.FakeListCertificate)
 	t.Run("fake read certificate by serial", integrationTestEnv.FakeReadCertificateBySerial)
 	t.Run("fake sign", integrationTestEnv.FakeSignCertificate)
+	t.Run("fake validate", integrationTestEnv.FakeValidateRequest)
+	t.Run("fake issue with the private key in the response data", integrationTestEnv.FakeIssueCertificateAndCheckPrivateKeyInData)
 	t.Run("fake revoke certificate", integrationTestEnv.FakeRevokeCertificate)
+	t.Run("fake renew lease", integrationTestEnv.RenewLease)
+	t.Run("fake revoke lease", integrationTestEnv.RevokeLease)
+	t.Run("fake read CA chain", integrationTestEnv.FakeReadCAChain)
+	t.Run("fake read pickup status", integrationTestEnv.FakeReadPickupStatus)
+	t.Run("fake resume pickup", integrationTestEnv.FakeResumePickup)
+	t.Run("fake read metrics", integrationTestEnv.ReadMetrics)
 
 }
 
@@ -120,6 +128,100 @@ func TestFakeStoreByOptions(t *testing.T) {
 
 }
 
+//Testing private keys generated by Venafi with fake vcert CA
+func TestFakeServiceGeneratedCSR(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("create venafi secret", integrationTestEnv.FakeCreateVenafi)
+	t.Run("create role service_generated_cert true", integrationTestEnv.FakeCreateRoleServiceGenerated)
+	t.Run("issue with service generated key", integrationTestEnv.FakeIssueServiceGeneratedCertificate)
+	t.Run("issue with service generated key and password", integrationTestEnv.FakeIssueServiceGeneratedCertificateWithPassword)
+}
+
+func TestFakeUniqueCN(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("create venafi secret", integrationTestEnv.FakeCreateVenafi)
+	t.Run("create role unique_cn true", integrationTestEnv.FakeCreateRoleUniqueCN)
+	t.Run("issue twice with unique_cn and force", integrationTestEnv.FakeIssueCertificateWithUniqueCN)
+}
+
+func TestFakeNoReturnPrivateKey(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("create venafi secret", integrationTestEnv.FakeCreateVenafi)
+	t.Run("create role return_private_key false", integrationTestEnv.FakeCreateRoleNoReturnPKey)
+	t.Run("issue without returning the private key", integrationTestEnv.FakeIssueCertificateWithoutReturningPrivateKey)
+}
+
+//Testing requests on the fake role, each case with its own backend
+func TestFakeRoleRequests(t *testing.T) {
+	type step struct {
+		name string
+		run  func(e *testEnv, t *testing.T)
+	}
+	cases := []struct {
+		name  string
+		steps []step
+	}{
+		{"csr only", []step{
+			{"generate CSR only and sign it", (*testEnv).FakeIssueCSROnlyAndSign},
+			{"issue with a CSR and key parameters", (*testEnv).FakeIssueWithCSRAndKeyParams},
+		}},
+		{"chain options", []step{
+			{"issue without root in chain", (*testEnv).FakeIssueCertificateWithoutRoot},
+		}},
+		{"issue batch", []step{
+			{"issue batch", (*testEnv).FakeIssueBatch},
+		}},
+		{"connection", []step{
+			{"test connection", (*testEnv).ReadConnectionTest},
+			{"whoami", (*testEnv).ReadWhoami},
+			{"health", (*testEnv).ReadHealth},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			integrationTestEnv, err := newIntegrationTestEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Run("create venafi secret", integrationTestEnv.FakeCreateVenafi)
+			t.Run("create role", integrationTestEnv.FakeCreateRole)
+			for _, s := range c.steps {
+				s := s
+				t.Run(s.name, func(t *testing.T) { s.run(integrationTestEnv, t) })
+			}
+		})
+	}
+}
+
+//testing zone requiring SANs with CN-only input
+func TestFakeCNOnlyBehavior(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("create venafi secret", integrationTestEnv.FakeCreateVenafi)
+	t.Run("create role cn_only_behavior promote", integrationTestEnv.FakeCreateRoleCNOnlyPromote)
+	t.Run("issue with only CN promoted to SAN", integrationTestEnv.FakeIssueCertificateWithOnlyCNPromoted)
+	t.Run("delete role", integrationTestEnv.DeleteRole)
+
+	t.Run("create role cn_only_behavior fail", integrationTestEnv.FakeCreateRoleCNOnlyFail)
+	t.Run("issue with only CN allowed by the zone", integrationTestEnv.FakeIssueCertificateWithOnlyCNAllowed)
+}
+
 //Testing Venafi Platform integration
 func TestTPPIntegration(t *testing.T) {
 
@@ -0,0 +1,132 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+const (
+	formatPEM        = "pem"
+	formatDER        = "der"
+	formatPEMBundle  = "pem_bundle"
+	formatKubernetes = "kubernetes"
+
+	bundleOrderKeyCertChain = "key-cert-chain"
+	bundleOrderCertChainKey = "cert-chain-key"
+	bundleOrderCertKeyChain = "cert-key-chain"
+
+	// the default matches what nginx and HAProxy expect in a single file
+	defaultBundleOrder = bundleOrderCertChainKey
+)
+
+func isValidBundleOrder(order string) bool {
+	switch order {
+	case bundleOrderKeyCertChain, bundleOrderCertChainKey, bundleOrderCertKeyChain:
+		return true
+	}
+	return false
+}
+
+// pemBundle concatenates the certificate, its chain and the private key in the given order. The private key is left out
+// when it's empty, as when signing a CSR.
+func pemBundle(order string, certificate string, chain []string, privateKey string) (string, error) {
+	if order == "" {
+		order = defaultBundleOrder
+	}
+
+	var blocks []string
+	switch order {
+	case bundleOrderKeyCertChain:
+		blocks = append([]string{privateKey, certificate}, chain...)
+	case bundleOrderCertChainKey:
+		blocks = append(append([]string{certificate}, chain...), privateKey)
+	case bundleOrderCertKeyChain:
+		blocks = append([]string{certificate, privateKey}, chain...)
+	default:
+		return "", fmt.Errorf(errTextBundleOrderWrongOption, bundleOrderKeyCertChain, bundleOrderCertChainKey, bundleOrderCertKeyChain, order)
+	}
+
+	var bundle []string
+	for _, block := range blocks {
+		block = strings.TrimSpace(block)
+		if block != "" {
+			bundle = append(bundle, block)
+		}
+	}
+	return strings.Join(bundle, "\n") + "\n", nil
+}
+
+// kubernetesTLSData returns the "tls.crt" and "tls.key" fields of a Kubernetes TLS secret, base64 encoded as its data
+// expects. The certificate is followed by its chain, and the private key is left out when it's empty.
+func kubernetesTLSData(certificate string, chain []string, privateKey string) map[string]interface{} {
+	var blocks []string
+	for _, block := range append([]string{certificate}, chain...) {
+		if block = strings.TrimSpace(block); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	data := map[string]interface{}{
+		"tls.crt": base64.StdEncoding.EncodeToString([]byte(strings.Join(blocks, "\n") + "\n")),
+	}
+	if privateKey = strings.TrimSpace(privateKey); privateKey != "" {
+		data["tls.key"] = base64.StdEncoding.EncodeToString([]byte(privateKey + "\n"))
+	}
+	return data
+}
+
+// pemToDER returns the blocks of the PEM data as base64 encoded DER, as the built-in PKI engine returns them with the
+// "der" format. Keys with the legacy PEM encryption are refused, their encryption parameters only live in the PEM headers.
+func pemToDER(data string) ([]string, error) {
+	var blocks []string
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if x509.IsEncryptedPEMBlock(block) {
+			return nil, fmt.Errorf(errorTextDEREncryptedPEM)
+		}
+		blocks = append(blocks, base64.StdEncoding.EncodeToString(block.Bytes))
+	}
+	if len(blocks) == 0 && strings.TrimSpace(data) != "" {
+		return nil, fmt.Errorf(errorTextDERNoPEM)
+	}
+	return blocks, nil
+}
+
+// derResponseData replaces the PEM certificates and key of a response with their base64 encoded DER
+func derResponseData(respData map[string]interface{}) error {
+	for _, field := range []string{"certificate", "issuing_ca", "private_key", "certificate_chain"} {
+		value, ok := respData[field].(string)
+		if !ok {
+			continue
+		}
+		blocks, err := pemToDER(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %s", field, err)
+		}
+		respData[field] = strings.Join(blocks, "\n")
+	}
+	if chain, ok := respData["ca_chain"].([]string); ok {
+		var derChain []string
+		for _, c := range chain {
+			blocks, err := pemToDER(c)
+			if err != nil {
+				return fmt.Errorf("failed to encode ca_chain: %s", err)
+			}
+			derChain = append(derChain, blocks...)
+		}
+		respData["ca_chain"] = derChain
+	}
+	return nil
+}
+
+const (
+	errorTextDEREncryptedPEM = `keys encrypted with the legacy PEM encryption can't be returned in "der" format`
+	errorTextDERNoPEM        = "no PEM data found"
+)
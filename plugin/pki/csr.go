@@ -0,0 +1,120 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/hashicorp/vault/sdk/logical"
+	"time"
+)
+
+// pendingKeyTTL is how long the key of a CSR generated with csr_only is kept waiting for the CSR to be signed
+const pendingKeyTTL = 7 * 24 * time.Hour
+
+// pendingKeyEntry keeps the private key of a CSR generated with csr_only until the CSR is signed on the sign path, so
+// the key is stored with the certificate as it is for issued certificates
+type pendingKeyEntry struct {
+	PrivateKey string    `json:"private_key"`
+	Role       string    `json:"role"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// expired validates if the key has waited for its CSR to be signed longer than the backend keeps it
+func (p *pendingKeyEntry) expired() bool {
+	return time.Since(p.CreatedAt) > pendingKeyTTL
+}
+
+// csrOnlyResponse returns the CSR and private key generated for an issue request with csr_only, which is not sent to
+// Venafi. The key is kept when the role stores private keys.
+func (b *backend) csrOnlyResponse(ctx context.Context, s logical.Storage, roleName string, role *roleEntry, certReq *certificate.Request,
+	keyPassword, privateKeyFormat string) (*logical.Response, error) {
+
+	privateKey, err := encodePrivateKey(certReq.PrivateKey, privateKeyFormat, keyPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if role.StorePrivateKey && !role.NoStore {
+		keyID, err := publicKeyID(certReq.PrivateKey.Public())
+		if err != nil {
+			return nil, err
+		}
+		entry, err := logical.StorageEntryJSON("csr-keys/"+keyID, pendingKeyEntry{
+			PrivateKey: privateKey,
+			Role:       roleName,
+			CreatedAt:  time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Put(ctx, entry); err != nil {
+			b.Logger().Error("Error putting entry to storage: " + err.Error())
+			return nil, err
+		}
+	}
+	b.Logger().Debug(fmt.Sprintf("Generated CSR for %s without requesting the certificate", certReq.Subject.CommonName))
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"csr":              string(certReq.GetCSR()),
+			"private_key_type": privateKeyType(certReq.PrivateKey),
+		},
+	}
+	if role.returnPrivateKey() {
+		resp.Data["private_key"] = privateKey
+		resp.AddWarning(warningTextPrivateKeyACL)
+	}
+	return resp, nil
+}
+
+// takePendingKey returns the private key kept for a CSR generated with csr_only and removes it from the storage, or ""
+// if the CSR was generated elsewhere. The key is only given to the role that generated the CSR, and is dropped once
+// expired.
+func takePendingKey(ctx context.Context, s logical.Storage, roleName string, csrPEM []byte) (string, error) {
+	pemBlock, _ := pem.Decode(csrPEM)
+	if pemBlock == nil {
+		return "", nil
+	}
+	csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+	if err != nil {
+		return "", nil
+	}
+	keyID, err := publicKeyID(csr.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	entry, err := s.Get(ctx, "csr-keys/"+keyID)
+	if err != nil || entry == nil {
+		return "", err
+	}
+	var pending pendingKeyEntry
+	if err := entry.DecodeJSON(&pending); err != nil {
+		return "", err
+	}
+	if pending.Role != roleName {
+		return "", nil
+	}
+	if err := s.Delete(ctx, "csr-keys/"+keyID); err != nil {
+		return "", err
+	}
+	if pending.expired() {
+		return "", nil
+	}
+	return pending.PrivateKey, nil
+}
+
+// publicKeyID identifies a key pair by the SHA-256 hash of its public key
+func publicKeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
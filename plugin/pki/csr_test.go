@@ -0,0 +1,84 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/hashicorp/vault/sdk/logical"
+	"testing"
+	"time"
+)
+
+func TestTakePendingKey(t *testing.T) {
+	ctx := context.Background()
+	s := &logical.InmemStorage{}
+
+	//each CSR key is kept under the ID of its public key
+	putPendingKey := func(pending pendingKeyEntry) []byte {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "pending.example.com"},
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyID, err := publicKeyID(key.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := logical.StorageEntryJSON("csr-keys/"+keyID, pending)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	}
+
+	csrPEM := putPendingKey(pendingKeyEntry{PrivateKey: "pending key", Role: "csr", CreatedAt: time.Now()})
+	key, err := takePendingKey(ctx, s, "other", csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		t.Fatal("Expecting the key of a CSR not to be given to another role")
+	}
+	key, err = takePendingKey(ctx, s, "csr", csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "pending key" {
+		t.Fatalf("Expecting the key of the CSR to be given to its role but got %q", key)
+	}
+	key, err = takePendingKey(ctx, s, "csr", csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		t.Fatal("Expecting the key of the CSR to be removed once taken")
+	}
+
+	csrPEM = putPendingKey(pendingKeyEntry{PrivateKey: "expired key", Role: "csr", CreatedAt: time.Now().Add(-pendingKeyTTL - time.Hour)})
+	key, err = takePendingKey(ctx, s, "csr", csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		t.Fatal("Expecting an expired key not to be given")
+	}
+	keys, err := s.List(ctx, "csr-keys/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("Expecting the expired key to be deleted but got %v", keys)
+	}
+}
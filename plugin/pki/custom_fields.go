@@ -0,0 +1,200 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/hashicorp/vault/sdk/logical"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// tppMetadataItemsPath is the Venafi Platform endpoint listing the custom fields that apply to a policy folder.
+	// vcert drops the custom fields Venafi doesn't know without telling, so the backend checks them itself.
+	tppMetadataItemsPath = "/vedsdk/metadata/getitems"
+	// tppAuthorizePath is the Venafi Platform endpoint trading a user and password for an API key
+	tppAuthorizePath = "/vedsdk/authorize/"
+	// customFieldsCacheTTL is how long the custom fields of the zone of a role are cached
+	customFieldsCacheTTL = 1 * time.Hour
+)
+
+type cachedCustomFields struct {
+	fields    []string
+	expiresAt time.Time
+}
+
+type metadataItemsRequest struct {
+	DN string `json:"DN"`
+}
+
+type metadataItemsResponse struct {
+	Items []struct {
+		Label string `json:"Label"`
+	} `json:"Items"`
+	Error string `json:"Error"`
+}
+
+type authorizeRequest struct {
+	Username string `json:"Username"`
+	Password string `json:"Password"`
+}
+
+type authorizeResponse struct {
+	APIKey string `json:"APIKey"`
+}
+
+// tppPolicyDN returns the DN of the policy folder of a zone, given with or without the "\VED\Policy" prefix
+func tppPolicyDN(zone string) string {
+	if strings.HasPrefix(zone, `\VED\Policy`) {
+		return zone
+	}
+	if !strings.HasPrefix(zone, `\`) {
+		zone = `\` + zone
+	}
+	return `\VED\Policy` + zone
+}
+
+// zoneCustomFields returns the labels of the custom fields defined for the zone of the config on Venafi Platform
+func zoneCustomFields(ctx context.Context, cfg *vcert.Config) ([]string, error) {
+	client, err := configHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(metadataItemsRequest{DN: tppPolicyDN(cfg.Zone)})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tppURL(cfg.BaseUrl, tppMetadataItemsPath), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := setTPPAuthorization(ctx, client, cfg, req); err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code on TPP Metadata GetItems. Status: %s", resp.Status)
+	}
+	var itemsResp metadataItemsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&itemsResp); err != nil {
+		return nil, fmt.Errorf("failed to decode TPP Metadata GetItems response: %s", err)
+	}
+	if itemsResp.Error != "" {
+		return nil, fmt.Errorf("TPP failed to list the custom fields of zone %s: %s", cfg.Zone, itemsResp.Error)
+	}
+	labels := make([]string, 0, len(itemsResp.Items))
+	for _, item := range itemsResp.Items {
+		labels = append(labels, item.Label)
+	}
+	return labels, nil
+}
+
+// setTPPAuthorization authenticates a request to Venafi Platform with the access token of the config, or with an API
+// key for its user and password
+func setTPPAuthorization(ctx context.Context, client *http.Client, cfg *vcert.Config, req *http.Request) error {
+	if cfg.Credentials == nil {
+		return fmt.Errorf("no credentials to connect to Venafi Platform")
+	}
+	if cfg.Credentials.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Credentials.AccessToken)
+		return nil
+	}
+
+	body, err := json.Marshal(authorizeRequest{Username: cfg.Credentials.User, Password: cfg.Credentials.Password})
+	if err != nil {
+		return err
+	}
+	authReq, err := http.NewRequestWithContext(ctx, http.MethodPost, tppURL(cfg.BaseUrl, tppAuthorizePath), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	authReq.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(authReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code on TPP Authorize. Status: %s", resp.Status)
+	}
+	var authResp authorizeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		return fmt.Errorf("failed to decode TPP Authorize response: %s", err)
+	}
+	req.Header.Set("X-Venafi-Api-Key", authResp.APIKey)
+	return nil
+}
+
+// checkCustomField validates that the custom field named by a role option is defined for the zone the request is sent
+// to, given by clientZone, as Venafi would otherwise issue the certificate without it. The fields found are cached for
+// an hour, or until the role or its Venafi secret is written.
+func (b *backend) checkCustomField(ctx context.Context, req *logical.Request, roleName string, zone string,
+	connectorType endpoint.ConnectorType, option string, field string) error {
+
+	switch connectorType {
+	case endpoint.ConnectorTypeFake:
+		return nil
+	case endpoint.ConnectorTypeTPP:
+	default:
+		return fmt.Errorf(errorTextCustomFieldNotTPP, field, option)
+	}
+
+	b.customFieldsLock.Lock()
+	cached, ok := b.customFieldsCache[roleZoneKey(roleName, zone)]
+	b.customFieldsLock.Unlock()
+	fields := cached.fields
+	if !ok || time.Now().After(cached.expiresAt) {
+		cfg, err := b.getConfig(ctx, req, roleName, false)
+		if err != nil {
+			return err
+		}
+		if zone != "" {
+			cfg.Zone = zone
+		}
+		fields, err = zoneCustomFields(ctx, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to read the custom fields of the zone: %s", err)
+		}
+		b.customFieldsLock.Lock()
+		if b.customFieldsCache == nil {
+			b.customFieldsCache = make(map[string]cachedCustomFields)
+		}
+		b.customFieldsCache[roleZoneKey(roleName, zone)] = cachedCustomFields{fields: fields, expiresAt: time.Now().Add(customFieldsCacheTTL)}
+		b.customFieldsLock.Unlock()
+	}
+
+	if !sliceContains(fields, field) {
+		return fmt.Errorf(errorTextCustomFieldNotDefined, field, option)
+	}
+	return nil
+}
+
+// invalidateCustomFields drops the cached custom fields of all the zones of a role, so a changed zone or Venafi secret
+// is picked up
+func (b *backend) invalidateCustomFields(roleName string) {
+	b.customFieldsLock.Lock()
+	defer b.customFieldsLock.Unlock()
+
+	for key := range b.customFieldsCache {
+		if strings.HasPrefix(key, roleZoneKey(roleName, "")) {
+			delete(b.customFieldsCache, key)
+		}
+	}
+}
+
+const (
+	errorTextCustomFieldNotTPP     = `custom field %q of %q can only be set on Venafi Platform`
+	errorTextCustomFieldNotDefined = `custom field %q of %q is not defined for the zone in Venafi`
+)
@@ -0,0 +1,125 @@
+package pki
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTPPPolicyDN(t *testing.T) {
+	cases := map[string]string{
+		`devops\vcert`:             `\VED\Policy\devops\vcert`,
+		`\devops\vcert`:            `\VED\Policy\devops\vcert`,
+		`\VED\Policy\devops\vcert`: `\VED\Policy\devops\vcert`,
+	}
+	for zone, expected := range cases {
+		if dn := tppPolicyDN(zone); dn != expected {
+			t.Fatalf("Expecting DN %s for zone %s but got %s", expected, zone, dn)
+		}
+	}
+}
+
+func TestZoneCustomFields(t *testing.T) {
+	var received metadataItemsRequest
+	var authorization, apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == tppAuthorizePath:
+			var auth authorizeRequest
+			if err := json.NewDecoder(r.Body).Decode(&auth); err != nil {
+				t.Errorf("failed to decode request body: %s", err)
+			}
+			if auth.Username != "admin" || auth.Password != "secret-password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"APIKey":"secret-api-key"}`))
+		case r.Method == http.MethodPost && r.URL.Path == tppMetadataItemsPath:
+			authorization = r.Header.Get("Authorization")
+			apiKey = r.Header.Get("X-Venafi-Api-Key")
+			if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+				t.Errorf("failed to decode request body: %s", err)
+			}
+			if received.DN == `\VED\Policy\failing` {
+				w.Write([]byte(`{"Error":"policy does not exist"}`))
+				return
+			}
+			w.Write([]byte(`{"Items":[{"Label":"Vault Mount"},{"Label":"Requester"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &vcert.Config{
+		ConnectorType: endpoint.ConnectorTypeTPP,
+		BaseUrl:       server.URL + "/vedsdk",
+		Zone:          `devops\vcert`,
+		Credentials:   &endpoint.Authentication{AccessToken: "secret-access-token"},
+	}
+	fields, err := zoneCustomFields(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 || fields[0] != "Vault Mount" || fields[1] != "Requester" {
+		t.Fatalf("Expecting the labels of the zone custom fields but got %#v", fields)
+	}
+	if received.DN != `\VED\Policy\devops\vcert` || authorization != "Bearer secret-access-token" {
+		t.Fatalf("Expecting the policy DN to be sent with the access token but got %#v and %q", received, authorization)
+	}
+
+	cfg.Credentials = &endpoint.Authentication{User: "admin", Password: "secret-password"}
+	if _, err := zoneCustomFields(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if apiKey != "secret-api-key" {
+		t.Fatalf("Expecting the API key of the user to be sent but got %q", apiKey)
+	}
+
+	cfg.Zone = "failing"
+	if _, err := zoneCustomFields(context.Background(), cfg); err == nil {
+		t.Fatal("Expecting the error returned by Venafi Platform to fail the lookup")
+	}
+}
+
+func TestCheckCustomField(t *testing.T) {
+	b, _ := createBackendWithStorage(t)
+	b.customFieldsCache = map[string]cachedCustomFields{
+		roleZoneKey("tpp", ""):      {fields: []string{"Vault Mount", "Requester"}, expiresAt: time.Now().Add(customFieldsCacheTTL)},
+		roleZoneKey("tpp", "other"): {fields: []string{"Requester"}, expiresAt: time.Now().Add(customFieldsCacheTTL)},
+	}
+
+	if err := b.checkCustomField(context.Background(), nil, "tpp", "", endpoint.ConnectorTypeTPP, "origin_custom_field", "Vault Mount"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.checkCustomField(context.Background(), nil, "tpp", "", endpoint.ConnectorTypeTPP, "origin_custom_field", "Unknown"); err == nil {
+		t.Fatal("Expecting a custom field the zone doesn't define to be refused")
+	}
+	if err := b.checkCustomField(context.Background(), nil, "tpp", "", endpoint.ConnectorTypeTPP, "requester_custom_field", "Requester"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.checkCustomField(context.Background(), nil, "cloud", "", endpoint.ConnectorTypeCloud, "origin_custom_field", "Vault Mount"); err == nil {
+		t.Fatal("Expecting a custom field to be refused on Venafi Cloud")
+	}
+	if err := b.checkCustomField(context.Background(), nil, "fake", "", endpoint.ConnectorTypeFake, "origin_custom_field", "Unknown"); err != nil {
+		t.Fatal(err)
+	}
+
+	//the fields are kept for each zone of a role with additional zones
+	if err := b.checkCustomField(context.Background(), nil, "tpp", "other", endpoint.ConnectorTypeTPP, "origin_custom_field", "Vault Mount"); err == nil {
+		t.Fatal("Expecting a custom field only defined for another zone to be refused")
+	}
+
+	b.invalidateCustomFields("tpp")
+	if _, ok := b.customFieldsCache[roleZoneKey("tpp", "")]; ok {
+		t.Fatal("Expecting the cached custom fields of the role to be dropped")
+	}
+	if _, ok := b.customFieldsCache[roleZoneKey("tpp", "other")]; ok {
+		t.Fatal("Expecting the cached custom fields of every zone of the role to be dropped")
+	}
+}
@@ -0,0 +1,133 @@
+package pki
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/ryanuber/go-glob"
+)
+
+// requestNames returns the names of a comma separated field of the request, given either as a string or as a JSON
+// array. Entries of an array are split on commas as a string is, and names are trimmed with empty ones dropped, so both
+// forms give the same names.
+func requestNames(data *framework.FieldData, field string) ([]string, bool) {
+	raw, ok := data.GetOk(field)
+	if !ok {
+		return nil, false
+	}
+	var names []string
+	for _, entry := range raw.([]string) {
+		for _, name := range strings.Split(entry, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, true
+}
+
+// validateAllowedNames checks the common name and SANs of a request against the role allowed domains, with the same
+// semantics as the built-in Vault PKI engine. Roles without allowed domains accept any name, leaving it to the zone
+// policy. IP addresses aren't checked and only the domain of an email address is.
+func validateAllowedNames(role *roleEntry, names []string) error {
+	if len(role.AllowedDomains) == 0 {
+		return nil
+	}
+
+	for _, name := range names {
+		if name == "" || net.ParseIP(name) != nil {
+			continue
+		}
+		domainName := strings.ToLower(name)
+		if i := strings.LastIndex(domainName, "@"); i >= 0 {
+			domainName = domainName[i+1:]
+		}
+		if !isAllowedDomain(role, domainName) {
+			return fmt.Errorf(errorTextDomainNotAllowed, name)
+		}
+	}
+	return nil
+}
+
+// isAllowedDomain checks a name against the role allowed domains. Wildcard names are never allowed when the role
+// disallows wildcard certificates, whatever allowed domain they match.
+func isAllowedDomain(role *roleEntry, name string) bool {
+	if strings.Contains(name, "*") && !role.allowWildcardCertificates() {
+		return false
+	}
+	for _, allowed := range role.AllowedDomains {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == "" {
+			continue
+		}
+		if role.AllowBareDomains && name == allowed {
+			return true
+		}
+		//also allows wildcards when the role does, *.example.com is a subdomain of example.com
+		if role.AllowSubdomains && strings.HasSuffix(name, "."+allowed) {
+			return true
+		}
+		//as in the built-in PKI engine a * can match several labels, *.example.com matches a.b.example.com
+		if role.AllowGlobDomains && strings.Contains(allowed, "*") && glob.Glob(allowed, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateWildcards rejects wildcards in the common name and DNS SANs of a request when the role doesn't allow them
+func validateWildcards(role *roleEntry, names []string) error {
+	if role.allowWildcardCertificates() {
+		return nil
+	}
+	for _, name := range names {
+		if strings.Contains(name, "*") {
+			return fmt.Errorf(errorTextWildcardNotAllowed, name)
+		}
+	}
+	return nil
+}
+
+// wildcardApexes returns the apex domains of the wildcard names, e.g. example.com for *.example.com
+func wildcardApexes(names []string) []string {
+	var apexes []string
+	for _, name := range names {
+		if apex := strings.TrimPrefix(name, "*."); apex != name && apex != "" && !strings.Contains(apex, "*") {
+			apexes = appendUniqueFold(apexes, strings.ToLower(apex))
+		}
+	}
+	return apexes
+}
+
+// validateAllowedURISANs checks the URI SANs of a request against the role allowed URI SANs, with the same glob
+// semantics as the built-in Vault PKI engine, where a * can match across slashes. Roles without allowed URI SANs accept
+// any URI, leaving it to the zone policy.
+func validateAllowedURISANs(role *roleEntry, uris []*url.URL) error {
+	if len(role.AllowedURISANs) == 0 {
+		return nil
+	}
+
+	for _, uri := range uris {
+		allowed := false
+		for _, pattern := range role.AllowedURISANs {
+			if glob.Glob(strings.TrimSpace(pattern), uri.String()) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf(errorTextURISANNotAllowed, uri)
+		}
+	}
+	return nil
+}
+
+const (
+	errorTextDomainNotAllowed   = `name %s is not allowed by the role "allowed_domains"`
+	errorTextWildcardNotAllowed = `wildcard name %s is not allowed by the role, "allow_wildcard_certificates" is false`
+	errorTextURISANNotAllowed   = `URI SAN %s is not allowed by the role "allowed_uri_sans"`
+	errorTextRequireCN          = `"common_name" is required by the role, "require_cn" is true`
+)
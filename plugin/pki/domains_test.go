@@ -0,0 +1,120 @@
+package pki
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+func TestRequestNames(t *testing.T) {
+	schema := pathVenafiCertEnroll(&backend{}).Fields
+	expected := []string{"a.example.com", "b.example.com", "c.example.com"}
+	for _, raw := range []interface{}{
+		"a.example.com,b.example.com,c.example.com",
+		" a.example.com , b.example.com,, c.example.com ",
+		[]interface{}{"a.example.com", "b.example.com", "c.example.com"},
+		[]interface{}{" a.example.com", "b.example.com, c.example.com ", ""},
+	} {
+		data := &framework.FieldData{Raw: map[string]interface{}{"alt_names": raw}, Schema: schema}
+		names, ok := requestNames(data, "alt_names")
+		if !ok || !reflect.DeepEqual(names, expected) {
+			t.Fatalf("Expecting %#v to give %v but got %v", raw, expected, names)
+		}
+	}
+
+	data := &framework.FieldData{Raw: map[string]interface{}{}, Schema: schema}
+	if names, ok := requestNames(data, "alt_names"); ok || names != nil {
+		t.Fatalf("Expecting no names when alt_names isn't set but got %v", names)
+	}
+}
+
+func TestValidateAllowedNames(t *testing.T) {
+	cases := []struct {
+		role    roleEntry
+		names   []string
+		allowed bool
+	}{
+		{roleEntry{}, []string{"anything.example.org"}, true},
+		{roleEntry{AllowedDomains: []string{"example.com"}}, []string{"example.com"}, false},
+		{roleEntry{AllowedDomains: []string{"example.com"}, AllowBareDomains: true}, []string{"Example.com"}, true},
+		{roleEntry{AllowedDomains: []string{"example.com"}, AllowBareDomains: true}, []string{"www.example.com"}, false},
+		{roleEntry{AllowedDomains: []string{"example.com"}, AllowSubdomains: true}, []string{"www.example.com", "*.example.com"}, true},
+		{roleEntry{AllowedDomains: []string{"example.com"}, AllowSubdomains: true, AllowWildcardCertificates: new(bool)}, []string{"*.example.com"}, false},
+		{roleEntry{AllowedDomains: []string{"example.com"}, AllowSubdomains: true}, []string{"www.example.com", "badexample.com"}, false},
+		{roleEntry{AllowedDomains: []string{"ftp*.example.com"}, AllowGlobDomains: true}, []string{"ftp01.example.com"}, true},
+		{roleEntry{AllowedDomains: []string{"ftp*.example.com"}}, []string{"ftp01.example.com"}, false},
+		{roleEntry{AllowedDomains: []string{"*.example.com"}, AllowGlobDomains: true}, []string{"a.b.example.com"}, true},
+		{roleEntry{AllowedDomains: []string{"*.example.com"}, AllowGlobDomains: true}, []string{"a.b.example.org"}, false},
+		{roleEntry{AllowedDomains: []string{"example.com"}, AllowBareDomains: true}, []string{"venafi@example.com", "192.168.1.1"}, true},
+		{roleEntry{AllowedDomains: []string{"example.com"}, AllowBareDomains: true}, []string{"venafi@example.org"}, false},
+	}
+	for _, c := range cases {
+		err := validateAllowedNames(&c.role, c.names)
+		if c.allowed && err != nil {
+			t.Fatalf("names %v should be allowed by %v: %s", c.names, c.role.AllowedDomains, err)
+		}
+		if !c.allowed && err == nil {
+			t.Fatalf("names %v should not be allowed by %v", c.names, c.role.AllowedDomains)
+		}
+	}
+
+	role := roleEntry{AllowedDomains: []string{"example.com"}, AllowSubdomains: true}
+	err := validateAllowedNames(&role, []string{"www.example.com", "www.example.org"})
+	if err == nil || !strings.Contains(err.Error(), "www.example.org") {
+		t.Fatalf("error should name the rejected domain, got %v", err)
+	}
+}
+
+func TestValidateWildcards(t *testing.T) {
+	allow, deny := true, false
+	if err := validateWildcards(&roleEntry{}, []string{"*.example.com"}); err != nil {
+		t.Fatalf("roles stored without allow_wildcard_certificates should allow wildcards: %s", err)
+	}
+	if err := validateWildcards(&roleEntry{AllowWildcardCertificates: &allow}, []string{"*.example.com"}); err != nil {
+		t.Fatalf("wildcards should be allowed: %s", err)
+	}
+	role := roleEntry{AllowWildcardCertificates: &deny}
+	if err := validateWildcards(&role, []string{"www.example.com", "*.example.com"}); err == nil {
+		t.Fatal("wildcards should not be allowed")
+	}
+	if err := validateWildcards(&role, []string{"www.example.com"}); err != nil {
+		t.Fatalf("names without wildcards should be allowed: %s", err)
+	}
+}
+
+func TestValidateAllowedURISANs(t *testing.T) {
+	parse := func(raw string) []*url.URL {
+		uri, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []*url.URL{uri}
+	}
+
+	cases := []struct {
+		allowedURISANs []string
+		uri            string
+		allowed        bool
+	}{
+		{nil, "spiffe://example.org/anything", true},
+		{[]string{"spiffe://example.org/ns/*/sa/*"}, "spiffe://example.org/ns/prod/sa/web", true},
+		{[]string{"spiffe://example.org/ns/*/sa/*"}, "spiffe://example.org/ns/prod/other/web", false},
+		{[]string{"spiffe://example.org/*"}, "spiffe://example.org/ns/a", true},
+		{[]string{"spiffe://example.org/*"}, "spiffe://example.com/ns/a", false},
+		{[]string{"https://example.com/a", "https://example.com/b"}, "https://example.com/b", true},
+		{[]string{"https://example.com/a"}, "https://example.com/c", false},
+	}
+	for _, c := range cases {
+		role := roleEntry{AllowedURISANs: c.allowedURISANs}
+		err := validateAllowedURISANs(&role, parse(c.uri))
+		if c.allowed && err != nil {
+			t.Fatalf("URI %s should be allowed by %v: %s", c.uri, c.allowedURISANs, err)
+		}
+		if !c.allowed && err == nil {
+			t.Fatalf("URI %s should not be allowed by %v", c.uri, c.allowedURISANs)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package e2e
 
 import (
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
@@ -158,6 +159,35 @@ var _ = Describe("Vault PKI Venafi backend e2e tests	", func() {
 						Expect(haveIssuerCN).To(Equal(endpoint.issuerCN))
 
 					})
+					It("Enrolling wrapped certificate for "+endpoint.name, func() {
+						wrappedCN := test.RandCN()
+						cmd = fmt.Sprintf(
+							`docker exec %s vault write -wrap-ttl=60s -format=json venafi-pki/issue/%s common_name=%s`,
+							vaultContainerName, endpoint.name, wrappedCN)
+
+						By("Should run " + cmd)
+						out, err, code = testRun(cmd)
+						Expect(code).To(BeZero())
+						Expect(out).NotTo(ContainSubstring("PRIVATE KEY"))
+
+						By("Should return wrapping token")
+						wrapped := vaultJSONWrappedResponse{}
+						Expect(json.Unmarshal([]byte(out), &wrapped)).To(BeZero())
+						Expect(wrapped.WrapInfo.Token).NotTo(BeEmpty())
+
+						By("Should unwrap certificate and private key")
+						cmd = fmt.Sprintf(`docker exec %s vault unwrap -format=json %s`, vaultContainerName, wrapped.WrapInfo.Token)
+						out, err, code = testRun(cmd)
+						Expect(code).To(BeZero())
+						cert := vaultJSONCertificate{}
+						Expect(json.Unmarshal([]byte(out), &cert)).To(BeZero())
+						_, keyPairErr := tls.X509KeyPair([]byte(cert.Data.Certificate), []byte(cert.Data.PrivateKey))
+						Expect(keyPairErr).To(BeZero())
+
+						By("Should not unwrap the same token twice")
+						out, err, code = testRun(cmd)
+						Expect(code).NotTo(BeZero())
+					})
 					It("Fetching "+endpoint.name+" endpoint certificate with CN "+cn, func() {
 						By("Should be listed in certificates list")
 						cmd = fmt.Sprintf(`docker exec %s vault list venafi-pki/certs`, vaultContainerName)
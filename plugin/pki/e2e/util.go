@@ -21,6 +21,12 @@ type vaultJSONCertificate struct {
 	Data VenafiCert
 }
 
+type vaultJSONWrappedResponse struct {
+	WrapInfo struct {
+		Token string `json:"token"`
+	} `json:"wrap_info"`
+}
+
 func splitAndFlat(parts ...interface{}) (ret []string) {
 	for _, part := range parts {
 		switch part := part.(type) {
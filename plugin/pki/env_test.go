@@ -1,17 +1,23 @@
 package pki
 
 import (
+	"bytes"
 	"context"
 	r "crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
 	"github.com/Venafi/vcert/v4/pkg/util"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
 	"log"
 	"math/rand"
 	"net"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -28,6 +34,8 @@ type testEnv struct {
 	TestRandString    string
 	RoleName          string
 	CertificateSerial string
+	PickupID          string
+	LeaseSecret       *logical.Secret
 	VenafiSecretName  string
 }
 
@@ -68,6 +76,11 @@ const (
 	venafiConfigFakeStoreBySerial           venafiConfigString = "venafiConfigFakeStoreBySerial"
 	venafiConfigFakeNoStore                 venafiConfigString = "venafiConfigFakeNoStore"
 	venafiConfigFakeNoStorePKey             venafiConfigString = "venafiConfigFakeNoStorePKey"
+	venafiConfigFakeNoReturnPKey            venafiConfigString = "venafiConfigFakeNoReturnPKey"
+	venafiConfigFakeServiceGenerated        venafiConfigString = "venafiConfigFakeServiceGenerated"
+	venafiConfigFakeUniqueCN                venafiConfigString = "venafiConfigFakeUniqueCN"
+	venafiConfigFakeCNOnlyPromote           venafiConfigString = "venafiConfigFakeCNOnlyPromote"
+	venafiConfigFakeCNOnlyFail              venafiConfigString = "venafiConfigFakeCNOnlyFail"
 	venafiConfigMixedTppAndCloud            venafiConfigString = "MixedTppCloud"
 	venafiConfigMixedTppAndToken            venafiConfigString = "MixedTppToken"
 	venafiConfigMixedTokenAndCloud          venafiConfigString = "MixedTokenCloud"
@@ -188,6 +201,34 @@ var venafiTestFakeConfigNoStorePKey = map[string]interface{}{
 	"store_pkey":     false,
 }
 
+var venafiTestFakeConfigNoReturnPKey = map[string]interface{}{
+	"generate_lease":     true,
+	"store_pkey":         true,
+	"return_private_key": false,
+}
+
+var venafiTestFakeConfigServiceGenerated = map[string]interface{}{
+	"generate_lease":         true,
+	"store_pkey":             true,
+	"service_generated_cert": true,
+}
+
+var venafiTestFakeConfigUniqueCN = map[string]interface{}{
+	"generate_lease": true,
+	"store_pkey":     true,
+	"unique_cn":      true,
+}
+
+var venafiTestFakeConfigCNOnlyPromote = map[string]interface{}{
+	"generate_lease":   true,
+	"cn_only_behavior": "promote",
+}
+
+var venafiTestFakeConfigCNOnlyFail = map[string]interface{}{
+	"generate_lease":   true,
+	"cn_only_behavior": "fail",
+}
+
 var venafiTestMixedTppAndCloudConfig = map[string]interface{}{
 	"url":      "xxxxxxxxxxx",
 	"apikey":   "xxxxxxxxxxxxxxxx",
@@ -548,13 +589,14 @@ func (e *testEnv) IssueCertificateAndSaveSerial(t *testing.T, data testData, con
 
 	data.cert = resp.Data["certificate"].(string)
 	if data.keyPassword != "" {
-		encryptedKey := resp.Data["private_key"].(string)
-		b, _ := pem.Decode([]byte(encryptedKey))
-		b.Bytes, err = x509.DecryptPEMBlock(b, []byte(data.keyPassword))
+		key, err := parsePrivateKeyPEM(resp.Data["private_key"].(string), data.keyPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data.privateKey, err = encodePKCS8PrivateKey(key, "")
 		if err != nil {
 			t.Fatal(err)
 		}
-		data.privateKey = string(pem.EncodeToMemory(b))
 	} else {
 		data.privateKey = resp.Data["private_key"].(string)
 	}
@@ -564,8 +606,23 @@ func (e *testEnv) IssueCertificateAndSaveSerial(t *testing.T, data testData, con
 
 	checkStandardCert(t, data)
 
+	if resp.Data["private_key_type"] != "rsa" {
+		t.Fatalf("expected private key type rsa, but got %v", resp.Data["private_key_type"])
+	}
+
 	//save certificate serial for the next test
 	e.CertificateSerial = resp.Data["serial_number"].(string)
+	e.PickupID = resp.Data["pickup_id"].(string)
+	if e.PickupID == "" {
+		t.Fatalf("expected the Venafi pickup ID in the issue response")
+	}
+	if resp.Secret != nil {
+		if resp.Secret.InternalData["role"] != e.RoleName || resp.Secret.InternalData["pickup_id"] != e.PickupID ||
+			resp.Secret.InternalData["thumbprint"] == "" {
+			t.Fatalf("expected the role and Venafi identifiers in the lease internal data, but got %#v", resp.Secret.InternalData)
+		}
+		e.LeaseSecret = resp.Secret
+	}
 }
 
 func (e *testEnv) IssueCertificateAndValidateTTL(t *testing.T, data testData) {
@@ -654,10 +711,6 @@ func (e *testEnv) SignCertificate(t *testing.T, data testData, configString vena
 		certificateRequest.DNSNames = append(certificateRequest.DNSNames, data.dnsNS)
 	}
 
-	if data.dnsIP != "" {
-		certificateRequest.DNSNames = append(certificateRequest.DNSNames, data.dnsIP)
-	}
-
 	if configString == venafiConfigFakeDeprecatedStoreByCN {
 		certificateRequest.DNSNames = append(certificateRequest.DNSNames, data.cn)
 	}
@@ -735,10 +788,6 @@ func (e *testEnv) SignCertificateWithTTL(t *testing.T, data testData, configStri
 		certificateRequest.DNSNames = append(certificateRequest.DNSNames, data.dnsNS)
 	}
 
-	if data.dnsIP != "" {
-		certificateRequest.DNSNames = append(certificateRequest.DNSNames, data.dnsIP)
-	}
-
 	if configString == venafiConfigFakeDeprecatedStoreByCN {
 		certificateRequest.DNSNames = append(certificateRequest.DNSNames, data.cn)
 	}
@@ -838,6 +887,9 @@ func (e *testEnv) ReadCertificate(t *testing.T, data testData, configString vena
 		Operation: logical.ReadOperation,
 		Path:      "cert/" + certId,
 		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"include_private_key": true,
+		},
 	})
 
 	if err != nil {
@@ -860,10 +912,21 @@ func (e *testEnv) ReadCertificate(t *testing.T, data testData, configString vena
 		t.Fatalf("expected a private_key to be in read data")
 	}
 
+	if resp.Data["role"] != e.RoleName || resp.Data["issued_at"] == nil {
+		t.Fatalf("expected the role %s and issue time to be in read data, got %v and %v", e.RoleName, resp.Data["role"], resp.Data["issued_at"])
+	}
+
 	data.cert = resp.Data["certificate"].(string)
 	data.privateKey = resp.Data["private_key"].(string)
 	checkStandardCert(t, data)
 
+	if expiration := resp.Data["expiration"].(int64); expiration != parsePEMCertificate(data.cert).NotAfter.Unix() {
+		t.Fatalf("expected expiration of the certificate but got %d", expiration)
+	}
+	if e.PickupID != "" && resp.Data["pickup_id"] != e.PickupID {
+		t.Fatalf("expected pickup ID %s of the issued certificate but got %#v", e.PickupID, resp.Data["pickup_id"])
+	}
+
 }
 
 func (e *testEnv) CheckThatThereIsNoCertificate(t *testing.T, certId string) {
@@ -883,41 +946,857 @@ func (e *testEnv) CheckThatThereIsNoCertificate(t *testing.T, certId string) {
 	if !certContain {
 		t.Fatalf("error should contain %s substring but it is %s", noCertError, err)
 	}
-
+
+}
+
+func (e *testEnv) CheckThatThereIsNoPKey(t *testing.T, certId string) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "cert/" + certId,
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"include_private_key": true,
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to read certificate, %#v", resp.Data["error"])
+	}
+
+	if resp == nil {
+		t.Fatalf("should be on output on issue certificate, but response is nil: %#v", resp)
+	}
+
+	if resp.Data["private_key"] != "" {
+		t.Fatalf("expected no private_key in the store")
+	}
+
+}
+
+func (e *testEnv) ListCertificates(t *testing.T, data testData, configString venafiConfigString) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "certs",
+		Storage:   e.Storage,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to list certificates, %#v", resp.Data["error"])
+	}
+
+	if resp.Data["keys"] == nil {
+		t.Fatalf("certificate list should not be empty, but response data is empty: %#v", resp.Data)
+	}
+
+	//check that we can read certificate from list
+	e.ReadCertificate(t, data, configString, resp.Data["keys"].([]string)[0])
+}
+
+func (e *testEnv) RevokeCertificate(t *testing.T, certId string) {
+
+	_, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revoke/" + e.RoleName,
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"certificate_uid": certId,
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// IssueCertificateAndCheckPrivateKeyInData checks the private key is only returned in the response data, the part Vault
+// wraps. Wrapping itself is done by Vault core and is covered by the e2e tests.
+func (e *testEnv) IssueCertificateAndCheckPrivateKeyInData(t *testing.T, data testData) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue/" + e.RoleName,
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"common_name": data.cn,
+			"alt_names":   data.dnsNS,
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to issue certificate, %#v", resp.Data["error"])
+	}
+
+	if resp == nil {
+		t.Fatalf("should be on output on issue certificate, but response is nil: %#v", resp)
+	}
+
+	//Vault only wraps the response Data, so sensitive values must never be kept in the secret internal data
+	if resp.Secret != nil {
+		if _, ok := resp.Secret.InternalData["private_key"]; ok {
+			t.Fatalf("private key should not be stored in the secret internal data")
+		}
+	}
+
+	data.cert = resp.Data["certificate"].(string)
+	data.privateKey = resp.Data["private_key"].(string)
+	_, err = tls.X509KeyPair([]byte(data.cert), []byte(data.privateKey))
+	if err != nil {
+		t.Fatalf("Error parsing certificate key pair of the response data: %s", err)
+	}
+}
+
+func (e *testEnv) ReadCAChain(t *testing.T) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "ca/" + e.RoleName,
+		Storage:   e.Storage,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to read CA chain: %s", resp.Error())
+	}
+
+	if _, ok := resp.Data["certificate"]; ok {
+		t.Fatalf("CA chain response should not contain a leaf certificate")
+	}
+	if _, ok := resp.Data["private_key"]; ok {
+		t.Fatalf("CA chain response should not contain a private key")
+	}
+
+	pemBlock, _ := pem.Decode([]byte(resp.Data["issuing_ca"].(string)))
+	if pemBlock == nil {
+		t.Fatalf("failed to decode issuing CA: %#v", resp.Data["issuing_ca"])
+	}
+	caCert, err := x509.ParseCertificate(pemBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caCert.IsCA {
+		t.Fatalf("issuing CA %s is not a CA certificate", caCert.Subject.CommonName)
+	}
+
+	chainResp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "ca_chain/" + e.RoleName,
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chainResp == nil || chainResp.IsError() || chainResp.Data["certificate_chain"] != resp.Data["certificate_chain"] {
+		t.Fatalf("expected the same chain on ca_chain/%s, got %#v", e.RoleName, chainResp)
+	}
+
+	//second read must be served from the cache and return the same chain
+	cached, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "ca/" + e.RoleName,
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Data["certificate_chain"] != resp.Data["certificate_chain"] {
+		t.Fatalf("cached CA chain %#v is different from %#v", cached.Data["certificate_chain"], resp.Data["certificate_chain"])
+	}
+}
+
+func (e *testEnv) IssueCertificateWithUniqueCN(t *testing.T, data testData) {
+
+	issue := func(force bool) *logical.Response {
+		resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/" + e.RoleName,
+			Storage:   e.Storage,
+			Data: map[string]interface{}{
+				"common_name": data.cn,
+				"force":       force,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil {
+			t.Fatalf("should be on output on issue certificate, but response is nil: %#v", resp)
+		}
+		return resp
+	}
+
+	first := issue(false)
+	if first.IsError() {
+		t.Fatalf("failed to issue certificate, %#v", first.Data["error"])
+	}
+
+	duplicate := issue(false)
+	if !duplicate.IsError() {
+		t.Fatalf("issuing a second certificate for %s should fail when unique_cn is set", data.cn)
+	}
+	if !strings.Contains(duplicate.Error().Error(), first.Data["serial_number"].(string)) {
+		t.Fatalf("rejection should return the existing serial %s, but got %s", first.Data["serial_number"], duplicate.Error())
+	}
+
+	forced := issue(true)
+	if forced.IsError() {
+		t.Fatalf("failed to issue certificate with force, %#v", forced.Data["error"])
+	}
+}
+
+func (e *testEnv) IssueCertificateWithoutReturningPrivateKey(t *testing.T, data testData) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue/" + e.RoleName,
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"common_name": data.cn,
+			"format":      "pem_bundle",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to issue certificate: %#v", resp)
+	}
+	if _, ok := resp.Data["private_key"]; ok {
+		t.Fatal("private key should not be returned when return_private_key is false")
+	}
+	if strings.Contains(resp.Data["bundle"].(string), "PRIVATE KEY") {
+		t.Fatal("bundle should not contain the private key when return_private_key is false")
+	}
+	for _, warning := range resp.Warnings {
+		if strings.Contains(warning, "private key") {
+			t.Fatalf("no private key warning expected when the key isn't returned, but got %q", warning)
+		}
+	}
+
+	resp, err = e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "cert/" + resp.Data["serial_number"].(string),
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to read certificate: %#v", resp)
+	}
+	if resp.Data["private_key"] == "" {
+		t.Fatal("private key should still be stored when return_private_key is false")
+	}
+}
+
+func (e *testEnv) ReadConnectionTest(t *testing.T) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "test/" + e.RoleName,
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to test connection: %#v", resp)
+	}
+	if resp.Data["connector_type"] != endpoint.ConnectorTypeFake.String() {
+		t.Fatalf("expected connector type %s but got %v", endpoint.ConnectorTypeFake, resp.Data["connector_type"])
+	}
+
+	resp, err = e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "test/missing-role",
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error testing the connection of a missing role but got %#v", resp)
+	}
+}
+
+func (e *testEnv) ReadHealth(t *testing.T) {
+
+	read := func() *logical.Response {
+		resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "health/" + e.RoleName,
+			Storage:   e.Storage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || resp.IsError() {
+			t.Fatalf("failed to read health: %#v", resp)
+		}
+		return resp
+	}
+
+	resp := read()
+	if resp.Data["status"] != healthStatusOK || resp.Data["cached"] != false {
+		t.Fatalf("expected a fresh ok status, got %#v", resp.Data)
+	}
+	resp = read()
+	if resp.Data["status"] != healthStatusOK || resp.Data["cached"] != true {
+		t.Fatalf("expected the cached ok status, got %#v", resp.Data)
+	}
+
+	//a failed check is answered with 503 and its error
+	e.Backend.(*backend).setHealth(e.RoleName, fmt.Errorf("failed to read zone configuration: connection refused"))
+	resp = read()
+	if resp.Data[logical.HTTPStatusCode] != http.StatusServiceUnavailable {
+		t.Fatalf("expected status code %d for a degraded connection, got %#v", http.StatusServiceUnavailable, resp.Data)
+	}
+	if !strings.Contains(resp.Data[logical.HTTPRawBody].(string), "connection refused") {
+		t.Fatalf("expected the last error in the degraded health, got %s", resp.Data[logical.HTTPRawBody])
+	}
+}
+
+func (e *testEnv) ReadWhoami(t *testing.T) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "whoami/" + e.RoleName,
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to read whoami: %#v", resp)
+	}
+	if resp.Data["connector_type"] != endpoint.ConnectorTypeFake.String() {
+		t.Fatalf("expected connector type %s but got %v", endpoint.ConnectorTypeFake, resp.Data["connector_type"])
+	}
+	if resp.Data["venafi_secret"] != e.VenafiSecretName || resp.Data["auth_method"] != authMethodNone {
+		t.Fatalf("expected venafi secret %s without authentication but got %#v", e.VenafiSecretName, resp.Data)
+	}
+
+	resp, err = e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "whoami/missing-role",
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error reading whoami of a missing role but got %#v", resp)
+	}
+}
+
+func (e *testEnv) IssueCertificateWithoutRoot(t *testing.T, data testData) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue/" + e.RoleName,
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"common_name":  data.cn,
+			"chain_option": "first",
+			"include_root": false,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to issue certificate: %#v", resp)
+	}
+	for _, caPEM := range resp.Data["ca_chain"].([]string) {
+		ca := parsePEMCertificate(caPEM)
+		if ca != nil && bytes.Equal(ca.RawSubject, ca.RawIssuer) {
+			t.Fatalf("expected the root CA %s to be removed from the chain", ca.Subject.CommonName)
+		}
+	}
+}
+
+func (e *testEnv) IssueCSROnlyAndSign(t *testing.T, data testData) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue/" + e.RoleName,
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"common_name": data.cn,
+			"csr_only":    true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to generate CSR: %#v", resp)
+	}
+	if _, ok := resp.Data["certificate"]; ok {
+		t.Fatalf("no certificate should be requested with csr_only")
+	}
+	csrPEM := resp.Data["csr"].(string)
+	privateKey := resp.Data["private_key"].(string)
+	pemBlock, _ := pem.Decode([]byte(csrPEM))
+	if pemBlock == nil {
+		t.Fatalf("failed to decode CSR %s", csrPEM)
+	}
+	csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.Subject.CommonName != data.cn {
+		t.Fatalf("expected CSR for %s but got %s", data.cn, csr.Subject.CommonName)
+	}
+
+	resp, err = e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "sign/" + e.RoleName,
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"csr": csrPEM,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to sign CSR: %#v", resp)
+	}
+
+	//the key of the CSR is stored with the signed certificate
+	resp, err = e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "cert/" + resp.Data["serial_number"].(string),
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"include_private_key": true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["private_key"] != privateKey {
+		t.Fatalf("expected the CSR private key to be stored with the certificate")
+	}
+}
+
+func (e *testEnv) IssueWithCSRAndKeyParams(t *testing.T, data testData) {
+
+	priv, err := rsa.GenerateKey(r.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(r.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: data.cn},
+		DNSNames: []string{data.cn},
+	}, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemCSR := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+
+	//the CSR takes precedence over the key parameters
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue/" + e.RoleName,
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"csr":      pemCSR,
+			"key_type": "ec",
+			"key_bits": 4096,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to issue certificate for a CSR: %#v", resp)
+	}
+	if _, ok := resp.Data["private_key"]; ok {
+		t.Fatalf("no private key should be generated when a CSR is given")
+	}
+	if !sliceContains(resp.Warnings, fmt.Sprintf(warningTextKeyFieldsIgnored, `key_type", "key_bits`)) {
+		t.Fatalf("expected a warning about the ignored key parameters, got %v", resp.Warnings)
+	}
+	pemBlock, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+	if pemBlock == nil {
+		t.Fatalf("failed to decode certificate %s", resp.Data["certificate"])
+	}
+	cert, err := x509.ParseCertificate(pemBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !publicKeysEqual(t, cert.PublicKey, &priv.PublicKey) {
+		t.Fatalf("expected the certificate to be issued for the key of the CSR")
+	}
+
+	resp, err = e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue/" + e.RoleName,
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"csr":      pemCSR,
+			"csr_only": true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() || resp.Error().Error() != errorTextCSRAndCSROnly {
+		t.Fatalf("expected csr and csr_only to be rejected, got %#v", resp)
+	}
+}
+
+func publicKeysEqual(t *testing.T, a, b interface{}) bool {
+	aDER, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bDER, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Equal(aDER, bDER)
+}
+
+func (e *testEnv) ReadPickupStatus(t *testing.T, data testData) {
+
+	//the fake connector issues right away, so the pickup ID of a request made with it is stored as if it had timed out
+	cl := fake.NewConnector(true, nil)
+	certReq := &certificate.Request{
+		Subject:   pkix.Name{CommonName: data.cn},
+		CsrOrigin: certificate.LocalGeneratedCSR,
+	}
+	if err := cl.GenerateRequest(nil, certReq); err != nil {
+		t.Fatal(err)
+	}
+	pickupID, err := cl.RequestCertificate(certReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storePickup(e.Context, e.Storage, &pickupEntry{
+		PickupID:    pickupID,
+		Role:        e.RoleName,
+		CommonName:  data.cn,
+		RequestedAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "pickup/" + e.RoleName + "/" + pickupID + "/status",
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to read pickup status: %s", resp.Error())
+	}
+
+	if resp.Data["state"] != pickupStateIssued {
+		t.Fatalf("pickup state should be %s, but got %#v", pickupStateIssued, resp.Data["state"])
+	}
+	if resp.Data["serial_number"] == "" {
+		t.Fatalf("issued pickup should have a serial number: %#v", resp.Data)
+	}
+	if resp.Data["elapsed"].(int64) < 60 {
+		t.Fatalf("elapsed time should be at least 60 seconds, but got %#v", resp.Data["elapsed"])
+	}
+
+	resp, err = e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "pickup/" + e.RoleName + "/unknown-" + e.TestRandString + "/status",
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("reading the status of an unknown pickup ID should fail: %#v", resp)
+	}
+}
+
+func (e *testEnv) RenewLease(t *testing.T) {
+
+	if e.LeaseSecret == nil {
+		t.Fatal("expected a lease from the issued certificate")
+	}
+	if !e.LeaseSecret.Renewable {
+		t.Fatal("expected the lease of the issued certificate to be renewable")
+	}
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   e.Storage,
+		Secret:    e.LeaseSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() || resp.Secret == nil {
+		t.Fatalf("failed to renew lease: %#v", resp)
+	}
+	expiration, err := time.Parse(time.RFC3339, e.LeaseSecret.InternalData["expiration"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Secret.TTL <= 0 || resp.Secret.TTL > time.Until(expiration)+time.Second {
+		t.Fatalf("expected the renewed lease to end before the certificate expires at %s, got TTL %s", expiration, resp.Secret.TTL)
+	}
+}
+
+func (e *testEnv) RevokeLease(t *testing.T) {
+
+	if e.LeaseSecret == nil {
+		t.Fatal("expected a lease from the issued certificate")
+	}
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   e.Storage,
+		Secret:    e.LeaseSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to revoke lease: %s", resp.Error())
+	}
+}
+
+func (e *testEnv) ValidateRequest(t *testing.T, data testData) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "validate/" + e.RoleName,
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"common_name": data.cn,
+			"alt_names":   fmt.Sprintf("%s,%s", data.dnsNS, data.dnsEmail),
+			"ip_sans":     []string{data.dnsIP},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to validate request: %#v", resp)
+	}
+	if resp.Data["valid"] != true {
+		t.Fatalf("request should be valid, but got %#v", resp.Data)
+	}
+	if resp.Data["common_name"] != data.cn {
+		t.Fatalf("expected common name %s, but got %#v", data.cn, resp.Data["common_name"])
+	}
+	if !sliceContains(resp.Data["dns_names"].([]string), data.dnsNS) {
+		t.Fatalf("expected DNS SAN %s, but got %#v", data.dnsNS, resp.Data["dns_names"])
+	}
+	if !sliceContains(resp.Data["ip_addresses"].([]string), data.dnsIP) {
+		t.Fatalf("expected IP SAN %s, but got %#v", data.dnsIP, resp.Data["ip_addresses"])
+	}
+	if _, ok := resp.Data["private_key"]; ok {
+		t.Fatal("validating a request should not return a private key")
+	}
+
+	resp, err = e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "validate/" + e.RoleName,
+		Storage:   e.Storage,
+		Data:      map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("a rejected request should not be an error: %#v", resp)
+	}
+	if resp.Data["valid"] != false || resp.Data["reason"] != errorTextNoDomains {
+		t.Fatalf("request without domains should not be valid, but got %#v", resp.Data)
+	}
+}
+
+func (e *testEnv) ReadMetrics(t *testing.T) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "metrics",
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to read metrics: %s", resp.Error())
+	}
+
+	metrics, ok := resp.Data[e.RoleName].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected metrics for role %s, but got %#v", e.RoleName, resp.Data)
+	}
+	if metrics["requests"].(int64) < 1 || metrics["issued"].(int64) < 1 || metrics["retrievals"].(int64) < 1 {
+		t.Fatalf("expected the issued certificates to be counted, but got %#v", metrics)
+	}
+	if metrics["requests"].(int64) != metrics["issued"].(int64)+metrics["failed"].(int64) {
+		t.Fatalf("expected every request to be issued or failed, but got %#v", metrics)
+	}
+}
+
+func (e *testEnv) ResumePickup(t *testing.T, data testData) {
+
+	//the request is made with the fake connector and stored with its key as if its retrieval had timed out
+	cl := fake.NewConnector(true, nil)
+	certReq := &certificate.Request{
+		Subject:   pkix.Name{CommonName: data.cn},
+		CsrOrigin: certificate.LocalGeneratedCSR,
+	}
+	if err := cl.GenerateRequest(nil, certReq); err != nil {
+		t.Fatal(err)
+	}
+	pickupID, err := cl.RequestCertificate(certReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := encodePKCS8PrivateKey(certReq.PrivateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storePickup(e.Context, e.Storage, &pickupEntry{
+		PickupID:    pickupID,
+		Role:        e.RoleName,
+		CommonName:  data.cn,
+		RequestedAt: time.Now(),
+		PrivateKey:  privateKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "pickup/" + e.RoleName + "/" + pickupID,
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to resume pickup: %s", resp.Error())
+	}
+	if resp.Data["common_name"] != data.cn {
+		t.Fatalf("expected certificate for %s, but got %#v", data.cn, resp.Data["common_name"])
+	}
+	key, err := parsePrivateKeyPEM(resp.Data["private_key"].(string), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := parseIssuedCertificate(resp.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, err := publicKeyID(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	certKeyID, err := publicKeyID(cert.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != certKeyID {
+		t.Fatalf("the returned private key doesn't match the certificate")
+	}
+	if resp.Secret == nil || resp.Secret.TTL <= 0 || resp.Secret.InternalData["pickup_id"] != pickupID {
+		t.Fatalf("expected a lease for the picked up certificate of a role generating leases, but got %#v", resp.Secret)
+	}
+
+	pickup, err := getPickup(e.Context, e.Storage, pickupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pickup != nil {
+		t.Fatalf("the pickup ID should be forgotten once the certificate is retrieved")
+	}
+
+	resp, err = e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "pickup/" + e.RoleName + "/" + pickupID,
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("resuming an unknown pickup ID should fail: %#v", resp)
+	}
 }
 
-func (e *testEnv) CheckThatThereIsNoPKey(t *testing.T, certId string) {
+func (e *testEnv) IssueCertificateWithOnlyCN(t *testing.T, data testData, expectedError string) {
 
 	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
-		Operation: logical.ReadOperation,
-		Path:      "cert/" + certId,
+		Operation: logical.UpdateOperation,
+		Path:      "issue/" + e.RoleName,
 		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"common_name": data.cn,
+		},
 	})
-
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	if resp != nil && resp.IsError() {
-		t.Fatalf("failed to read certificate, %#v", resp.Data["error"])
-	}
-
 	if resp == nil {
 		t.Fatalf("should be on output on issue certificate, but response is nil: %#v", resp)
 	}
 
-	if resp.Data["private_key"] != "" {
-		t.Fatalf("expected no private_key in the store")
+	if expectedError != "" {
+		if !resp.IsError() || resp.Error().Error() != expectedError {
+			t.Fatalf("Expecting error %s but got %#v", expectedError, resp.Data)
+		}
+		return
+	}
+	if resp.IsError() {
+		t.Fatalf("failed to issue certificate, %#v", resp.Data["error"])
 	}
 
+	pemBlock, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+	cert, err := x509.ParseCertificate(pemBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sliceContains(cert.DNSNames, data.cn) {
+		t.Fatalf("Common name %s should have been promoted to DNS SAN, but SANs are %v", data.cn, cert.DNSNames)
+	}
 }
 
-func (e *testEnv) ListCertificates(t *testing.T, data testData, configString venafiConfigString) {
+func (e *testEnv) IssueServiceGeneratedCertificate(t *testing.T, data testData) {
+
+	issueData := map[string]interface{}{
+		"common_name": data.cn,
+	}
+	if data.keyPassword != "" {
+		issueData["key_password"] = data.keyPassword
+	}
 
 	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
-		Operation: logical.ListOperation,
-		Path:      "certs",
+		Operation: logical.UpdateOperation,
+		Path:      "issue/" + e.RoleName,
 		Storage:   e.Storage,
+		Data:      issueData,
 	})
 
 	if err != nil {
@@ -925,31 +1804,38 @@ func (e *testEnv) ListCertificates(t *testing.T, data testData, configString ven
 	}
 
 	if resp != nil && resp.IsError() {
-		t.Fatalf("failed to list certificates, %#v", resp.Data["error"])
+		t.Fatalf("failed to issue certificate, %#v", resp.Data["error"])
 	}
 
-	if resp.Data["keys"] == nil {
-		t.Fatalf("certificate list should not be empty, but response data is empty: %#v", resp.Data)
+	if resp == nil {
+		t.Fatalf("should be on output on issue certificate, but response is nil: %#v", resp)
 	}
 
-	//check that we can read certificate from list
-	e.ReadCertificate(t, data, configString, resp.Data["keys"].([]string)[0])
-}
-
-func (e *testEnv) RevokeCertificate(t *testing.T, certId string) {
+	data.cert = resp.Data["certificate"].(string)
+	data.privateKey = resp.Data["private_key"].(string)
 
-	_, err := e.Backend.HandleRequest(e.Context, &logical.Request{
-		Operation: logical.UpdateOperation,
-		Path:      "revoke/" + e.RoleName,
-		Storage:   e.Storage,
-		Data: map[string]interface{}{
-			"certificate_uid": certId,
-		},
-	})
+	keyPEMBlock, _ := pem.Decode([]byte(data.privateKey))
+	if keyPEMBlock == nil {
+		t.Fatalf("Private key data is nil in the private key")
+	}
+	if data.keyPassword != "" {
+		key, err := parsePrivateKeyPEM(data.privateKey, data.keyPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data.privateKey, err = encodePKCS8PrivateKey(key, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
 
+	//the key must be the one generated by Venafi and not a locally generated one
+	_, err = tls.X509KeyPair([]byte(data.cert), []byte(data.privateKey))
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("Error parsing certificate key pair: %s", err)
 	}
+
+	e.CertificateSerial = resp.Data["serial_number"].(string)
 }
 
 func makeConfig(configString venafiConfigString) (roleData map[string]interface{}, err error) {
@@ -969,6 +1855,16 @@ func makeConfig(configString venafiConfigString) (roleData map[string]interface{
 		roleData = venafiTestFakeConfigNoStore
 	case venafiConfigFakeNoStorePKey:
 		roleData = venafiTestFakeConfigNoStorePKey
+	case venafiConfigFakeNoReturnPKey:
+		roleData = venafiTestFakeConfigNoReturnPKey
+	case venafiConfigFakeServiceGenerated:
+		roleData = venafiTestFakeConfigServiceGenerated
+	case venafiConfigFakeUniqueCN:
+		roleData = venafiTestFakeConfigUniqueCN
+	case venafiConfigFakeCNOnlyPromote:
+		roleData = venafiTestFakeConfigCNOnlyPromote
+	case venafiConfigFakeCNOnlyFail:
+		roleData = venafiTestFakeConfigCNOnlyFail
 	case venafiConfigTPP:
 		roleData = venafiTestTPPConfig
 	case venafiConfigTPPPredefined:
@@ -1280,6 +2176,25 @@ func (e *testEnv) FakeReadCertificateBySerial(t *testing.T) {
 	var config = venafiConfigFakeDeprecatedStoreBySerial
 	e.ReadCertificate(t, data, config, normalizeSerial(e.CertificateSerial))
 
+	//the serial number is normalized on read and the private key is only returned when asked for
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "cert/" + e.CertificateSerial,
+		Storage:   e.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to read certificate by serial %s: %#v", e.CertificateSerial, resp)
+	}
+	if resp.Data["certificate"] == nil {
+		t.Fatalf("expected a cert to be in read data")
+	}
+	if _, ok := resp.Data["private_key"]; ok {
+		t.Fatalf("private_key should not be returned unless include_private_key is set")
+	}
+
 }
 
 func (e *testEnv) FakeRevokeCertificate(t *testing.T) {
@@ -1297,6 +2212,253 @@ func (e *testEnv) FakeRevokeCertificate(t *testing.T) {
 
 }
 
+func (e *testEnv) FakeReadCAChain(t *testing.T) {
+
+	e.ReadCAChain(t)
+
+}
+
+func (e *testEnv) FakeReadPickupStatus(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-pickup." + domain
+
+	e.ReadPickupStatus(t, data)
+
+}
+
+func (e *testEnv) FakeValidateRequest(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-validate." + domain
+	data.dnsNS = "alt-" + data.cn
+	data.dnsIP = "192.168.1.1"
+	data.dnsEmail = "venafi@example.com"
+
+	e.ValidateRequest(t, data)
+
+}
+
+func (e *testEnv) FakeResumePickup(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-resume." + domain
+
+	e.ResumePickup(t, data)
+
+}
+
+func (e *testEnv) FakeIssueCertificateAndCheckPrivateKeyInData(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-wrapped." + domain
+	data.dnsNS = "alt-" + data.cn
+
+	e.IssueCertificateAndCheckPrivateKeyInData(t, data)
+
+}
+
+func (e *testEnv) FakeCreateRoleServiceGenerated(t *testing.T) {
+
+	var config = venafiConfigFakeServiceGenerated
+	e.writeRoleToBackend(t, config)
+
+}
+
+func (e *testEnv) FakeCreateRoleNoReturnPKey(t *testing.T) {
+
+	var config = venafiConfigFakeNoReturnPKey
+	e.writeRoleToBackend(t, config)
+
+}
+
+func (e *testEnv) FakeIssueCertificateWithoutReturningPrivateKey(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-nokey." + domain
+
+	e.IssueCertificateWithoutReturningPrivateKey(t, data)
+
+}
+
+func (e *testEnv) FakeCreateRoleUniqueCN(t *testing.T) {
+
+	var config = venafiConfigFakeUniqueCN
+	e.writeRoleToBackend(t, config)
+
+}
+
+func (e *testEnv) FakeIssueCertificateWithUniqueCN(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-unique." + domain
+
+	e.IssueCertificateWithUniqueCN(t, data)
+
+}
+
+func (e *testEnv) FakeIssueCertificateWithoutRoot(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-noroot." + domain
+
+	e.IssueCertificateWithoutRoot(t, data)
+
+}
+
+func (e *testEnv) IssueBatch(t *testing.T, data testData) {
+
+	resp, err := e.Backend.HandleRequest(e.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue-batch/" + e.RoleName,
+		Storage:   e.Storage,
+		Data: map[string]interface{}{
+			"requests": []interface{}{
+				map[string]interface{}{"common_name": "a-" + data.cn, "alt_names": "b-" + data.cn},
+				"not a request",
+				map[string]interface{}{"alt_names": ""},
+				map[string]interface{}{"common_name": "c-" + data.cn},
+			},
+			"concurrency": 2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to issue batch: %s", resp.Error())
+	}
+
+	results := resp.Data["results"].([]map[string]interface{})
+	if len(results) != 4 {
+		t.Fatalf("expected a result for each of the 4 requests, but got %d", len(results))
+	}
+	for _, i := range []int{0, 3} {
+		if results[i]["error"] != nil {
+			t.Fatalf("request %d of the batch should have been issued, but got error %s", i, results[i]["error"])
+		}
+		cert := parsePEMCertificate(results[i]["certificate"].(string))
+		if cert.Subject.CommonName != results[i]["common_name"] || results[i]["private_key"] == "" {
+			t.Fatalf("request %d of the batch should have returned its certificate and key, but got %#v", i, results[i])
+		}
+	}
+	if results[0]["common_name"] != "a-"+data.cn || results[3]["common_name"] != "c-"+data.cn {
+		t.Fatalf("results should be in the order of the requests, but got %s and %s", results[0]["common_name"], results[3]["common_name"])
+	}
+	for _, i := range []int{1, 2} {
+		if results[i]["error"] == nil {
+			t.Fatalf("request %d of the batch should have failed, but got %#v", i, results[i])
+		}
+	}
+}
+
+func (e *testEnv) FakeIssueBatch(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-batch." + domain
+
+	e.IssueBatch(t, data)
+
+}
+
+func (e *testEnv) FakeIssueCSROnlyAndSign(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-csr." + domain
+
+	e.IssueCSROnlyAndSign(t, data)
+
+}
+
+func (e *testEnv) FakeIssueWithCSRAndKeyParams(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-issue-csr." + domain
+
+	e.IssueWithCSRAndKeyParams(t, data)
+
+}
+
+func (e *testEnv) FakeCreateRoleCNOnlyPromote(t *testing.T) {
+
+	var config = venafiConfigFakeCNOnlyPromote
+	e.writeRoleToBackend(t, config)
+
+}
+
+func (e *testEnv) FakeCreateRoleCNOnlyFail(t *testing.T) {
+
+	var config = venafiConfigFakeCNOnlyFail
+	e.writeRoleToBackend(t, config)
+
+}
+
+func (e *testEnv) FakeIssueCertificateWithOnlyCNPromoted(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-cn-only." + domain
+
+	e.IssueCertificateWithOnlyCN(t, data, "")
+
+}
+
+func (e *testEnv) FakeIssueCertificateWithOnlyCNAllowed(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-cn-only." + domain
+
+	//the fake zone allows any DNS SAN without requiring one, so the common name is promoted rather than rejected
+	e.IssueCertificateWithOnlyCN(t, data, "")
+
+}
+
+func (e *testEnv) FakeIssueServiceGeneratedCertificate(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-service." + domain
+
+	e.IssueServiceGeneratedCertificate(t, data)
+
+}
+
+func (e *testEnv) FakeIssueServiceGeneratedCertificateWithPassword(t *testing.T) {
+
+	data := testData{}
+	randString := e.TestRandString
+	domain := "venafi.example.com"
+	data.cn = randString + "-service-password." + domain
+	data.keyPassword = "password"
+
+	e.IssueServiceGeneratedCertificate(t, data)
+
+}
+
 func (e *testEnv) FakeListCertificate(t *testing.T) {
 
 	data := testData{}
@@ -1755,10 +2917,6 @@ func checkStandardCert(t *testing.T, data testData) {
 
 	wantDNSNames := []string{data.dnsNS}
 
-	if data.dnsIP != "" {
-		wantDNSNames = append(wantDNSNames, data.dnsIP)
-	}
-
 	ips := make([]net.IP, 0, 2)
 	if data.onlyIP != "" {
 		ips = append(ips, net.ParseIP(data.onlyIP))
@@ -0,0 +1,36 @@
+package pki
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// isServerError validates if the error returned by vcert is caused by Venafi or the network instead of the request, so
+// it can be retried. Venafi Cloud wraps every error in verror.ServerError, even for a bad request, so the HTTP status
+// in the message is checked first and only transport failures are taken from the error chain.
+func isServerError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if statusCode := getStatusCode(err.Error()); statusCode != 0 {
+		return statusCode >= 500 || statusCode == HTTP_TOO_MANY_REQUESTS
+	}
+	if errors.Is(err, verror.ServerUnavailableError) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// venafiErrorResponse returns the response of a failed call to Venafi. Server side failures are returned as errors, so
+// Vault answers with a 500, while problems with the request are returned as a bad request.
+func venafiErrorResponse(err error, message string) (*logical.Response, error) {
+	if isServerError(err) {
+		return nil, errors.New(message)
+	}
+	return logical.ErrorResponse(message), nil
+}
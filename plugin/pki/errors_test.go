@@ -0,0 +1,68 @@
+package pki
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestIsServerError(t *testing.T) {
+	serverErrors := []error{
+		fmt.Errorf("Unexpected status code on TPP Certificate Retrieval. Status: 500 Internal Server Error"),
+		fmt.Errorf("Invalid status: 503 Service Unavailable Server response: "),
+		fmt.Errorf("unexpected status code on TPP Certificate Request.\n Status:\n 429 Too Many Requests"),
+		fmt.Errorf("%w: dial tcp: connection refused", verror.ServerUnavailableError),
+		&url.Error{Op: "Post", URL: "https://tpp.example.com", Err: &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}},
+	}
+	for _, err := range serverErrors {
+		if !isServerError(err) {
+			t.Fatalf("Expecting %q to be a server error", err)
+		}
+	}
+
+	clientErrors := []error{
+		nil,
+		fmt.Errorf("%w: unexpected status code on Venafi Cloud policy read. Status: 400 Bad Request", verror.ServerError),
+		fmt.Errorf("unexpected status code on TPP Authorize. Status: 401 Unauthorized"),
+		fmt.Errorf("%w: zone not found", verror.UserDataError),
+		fmt.Errorf("certificate request contains invalid data"),
+	}
+	for _, err := range clientErrors {
+		if isServerError(err) {
+			t.Fatalf("Expecting %q not to be a server error", err)
+		}
+	}
+}
+
+func TestGetStatusCode(t *testing.T) {
+	cases := map[string]int64{
+		"Invalid status: 429 Too Many Requests":                                                  429,
+		"unexpected status code on TPP Certificate Request.\n Status:\n 429 Too Many Requests":   429,
+		"Unexpected status code on TPP Certificate Retrieval. Status: 500 Internal Server Error": 500,
+		"certificate request contains invalid data":                                              0,
+	}
+	for msg, expected := range cases {
+		if statusCode := getStatusCode(msg); statusCode != expected {
+			t.Fatalf("Expecting status %d for %q but got %d", expected, msg, statusCode)
+		}
+	}
+	//rate limits are detected with the same parser as server errors
+	if !isRateLimitError(fmt.Errorf("unexpected status code on TPP Certificate Request. Status: 429 Too Many Requests")) {
+		t.Fatal("Expecting a 429 status to be a rate limit error")
+	}
+}
+
+func TestVenafiErrorResponse(t *testing.T) {
+	resp, err := venafiErrorResponse(fmt.Errorf("Invalid status: 502 Bad Gateway"), "failed to renew certificate")
+	if resp != nil || err == nil || err.Error() != "failed to renew certificate" {
+		t.Fatalf("Expecting a server failure to be returned as an error, got %#v, %v", resp, err)
+	}
+
+	resp, err = venafiErrorResponse(fmt.Errorf("Invalid status: 400 Bad Request"), "failed to renew certificate")
+	if err != nil || resp == nil || !resp.IsError() || resp.Error().Error() != "failed to renew certificate" {
+		t.Fatalf("Expecting a bad request to be returned as an error response, got %#v, %v", resp, err)
+	}
+}
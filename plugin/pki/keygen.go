@@ -0,0 +1,96 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+// defaultKeyGenTimeout bounds the generation of private keys of roles without key_gen_timeout
+const defaultKeyGenTimeout = 60 * time.Second
+
+// generatePrivateKey generates the private key of a locally generated CSR request. When the role sets
+// key_gen_concurrency, the generation waits for a free slot in the role's pool, so a burst of requests
+// queues up instead of saturating every CPU core at once. The request fails when the key isn't generated
+// within the role key_gen_timeout, e.g. a 4096 bits RSA key on a constrained host, instead of hanging.
+func (b *backend) generatePrivateKey(ctx context.Context, roleName string, role *roleEntry, certReq *certificate.Request) error {
+	if certReq.CsrOrigin != certificate.LocalGeneratedCSR || certReq.PrivateKey != nil {
+		return nil
+	}
+
+	timeout := role.keyGenTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var release func()
+	if role.KeyGenConcurrency > 0 {
+		slots := b.getKeyGenSlots(roleName, role.KeyGenConcurrency)
+		select {
+		case slots <- struct{}{}:
+			release = func() { <-slots }
+		case <-ctx.Done():
+			return keyGenError(ctx, timeout, "waiting for a key generation slot")
+		}
+	}
+
+	//the key is generated for a copy of the request, so a generation that times out and keeps running in the background
+	//doesn't change the request. It holds its slot until it ends.
+	keyReq := &certificate.Request{KeyType: certReq.KeyType, KeyLength: certReq.KeyLength, KeyCurve: certReq.KeyCurve}
+	done := make(chan error, 1)
+	go func() {
+		if release != nil {
+			defer release()
+		}
+		done <- keyReq.GeneratePrivateKey()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		certReq.PrivateKey = keyReq.PrivateKey
+		certReq.KeyLength = keyReq.KeyLength
+		return nil
+	case <-ctx.Done():
+		return keyGenError(ctx, timeout, "generating the private key")
+	}
+}
+
+// keyGenError describes why the key generation was abandoned. Running out of key_gen_timeout keeps
+// context.DeadlineExceeded in the error chain, so the request fails as a server error that can be retried.
+func keyGenError(ctx context.Context, timeout time.Duration, step string) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf(errorTextKeyGenTimeout, step, timeout, ctx.Err())
+	}
+	return fmt.Errorf("%s: %s", step, ctx.Err())
+}
+
+// keyGenTimeout returns how long the generation of a private key can take for the role
+func (r *roleEntry) keyGenTimeout() time.Duration {
+	if r.KeyGenTimeout <= 0 {
+		return defaultKeyGenTimeout
+	}
+	return r.KeyGenTimeout
+}
+
+func (b *backend) getKeyGenSlots(roleName string, concurrency int) chan struct{} {
+	b.keyGenLock.Lock()
+	defer b.keyGenLock.Unlock()
+
+	if b.keyGenSlots == nil {
+		b.keyGenSlots = make(map[string]chan struct{})
+	}
+
+	//a new pool is created when the role concurrency is updated, requests holding a slot of the old one just release it
+	slots, ok := b.keyGenSlots[roleName]
+	if !ok || cap(slots) != concurrency {
+		slots = make(chan struct{}, concurrency)
+		b.keyGenSlots[roleName] = slots
+	}
+	return slots
+}
+
+const errorTextKeyGenTimeout = `%s took longer than the key_gen_timeout of %s: %w`
@@ -0,0 +1,105 @@
+package pki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+func TestKeyGenSlots(t *testing.T) {
+	b, _ := createBackendWithStorage(t)
+
+	slots := b.getKeyGenSlots("role", 2)
+	if cap(slots) != 2 {
+		t.Fatalf("Expecting 2 key generation slots but got %d", cap(slots))
+	}
+	if b.getKeyGenSlots("role", 2) != slots {
+		t.Fatalf("Expecting the same key generation pool for the same role")
+	}
+	if cap(b.getKeyGenSlots("role", 4)) != 4 {
+		t.Fatalf("Expecting key generation pool to be resized when concurrency changes")
+	}
+
+	role := &roleEntry{KeyGenConcurrency: 1}
+	slots = b.getKeyGenSlots("busy", 1)
+	slots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	certReq := &certificate.Request{CsrOrigin: certificate.LocalGeneratedCSR, KeyLength: 2048}
+	if err := b.generatePrivateKey(ctx, "busy", role, certReq); err == nil {
+		t.Fatalf("Expecting key generation to wait for a free slot until the context is done")
+	}
+
+	<-slots
+	if err := b.generatePrivateKey(context.Background(), "busy", role, certReq); err != nil {
+		t.Fatal(err)
+	}
+	if certReq.PrivateKey == nil {
+		t.Fatalf("Expecting private key to be generated")
+	}
+}
+
+func TestKeyGenTimeout(t *testing.T) {
+	b, _ := createBackendWithStorage(t)
+
+	role := &roleEntry{KeyGenTimeout: time.Microsecond}
+	certReq := &certificate.Request{CsrOrigin: certificate.LocalGeneratedCSR, KeyLength: 4096}
+	err := b.generatePrivateKey(context.Background(), "slow", role, certReq)
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expecting key generation to time out but got %v", err)
+	}
+	if certReq.PrivateKey != nil {
+		t.Fatalf("Expecting no private key on the request after the generation timed out")
+	}
+	if !isServerError(err) {
+		t.Fatalf("Expecting a key generation timeout to be a server error")
+	}
+
+	if timeout := (&roleEntry{}).keyGenTimeout(); timeout != defaultKeyGenTimeout {
+		t.Fatalf("Expecting the default key generation timeout but got %s", timeout)
+	}
+}
+
+// BenchmarkKeyGenConcurrency issues bursts of RSA 4096 key generations and reports the p99 latency
+// with an unlimited pool and with a bounded one.
+func BenchmarkKeyGenConcurrency(b *testing.B) {
+	for _, concurrency := range []int{0, 2} {
+		concurrency := concurrency
+		b.Run(fmt.Sprintf("key_gen_concurrency=%d", concurrency), func(bb *testing.B) {
+			config := &roleEntry{KeyGenConcurrency: concurrency}
+			keyGenBackend := &backend{}
+			const burst = 8
+
+			var latencies []time.Duration
+			var lock sync.Mutex
+			for i := 0; i < bb.N; i++ {
+				var wg sync.WaitGroup
+				for j := 0; j < burst; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						start := time.Now()
+						certReq := &certificate.Request{CsrOrigin: certificate.LocalGeneratedCSR, KeyLength: 4096}
+						if err := keyGenBackend.generatePrivateKey(context.Background(), "bench", config, certReq); err != nil {
+							bb.Error(err)
+						}
+						lock.Lock()
+						latencies = append(latencies, time.Since(start))
+						lock.Unlock()
+					}()
+				}
+				wg.Wait()
+			}
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			p99 := latencies[(len(latencies)*99)/100]
+			bb.ReportMetric(float64(p99.Milliseconds()), "p99-ms")
+		})
+	}
+}
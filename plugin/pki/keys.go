@@ -0,0 +1,376 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/hashicorp/vault/sdk/framework"
+	"golang.org/x/crypto/pbkdf2"
+	"hash"
+	"strings"
+)
+
+const (
+	// defaultKeySize is used for RSA keys of roles without key_bits
+	defaultKeySize = 2048
+)
+
+const (
+	privateKeyFormatPKCS1 = "pkcs1"
+	privateKeyFormatPKCS8 = "pkcs8"
+)
+
+// validateKeyParams validates the key of the role can be generated, so a bad combination is rejected before contacting
+// Venafi. Key type "any" is only used for signing and has no key parameters.
+func validateKeyParams(keyType string, keyBits int, keyCurve string) error {
+	switch keyType {
+	case "", "any":
+		return nil
+	case "rsa":
+		if keyBits != 0 && keyBits != 2048 && keyBits != 3072 && keyBits != 4096 {
+			return fmt.Errorf(errorTextInvalidRSAKeyBits, keyBits)
+		}
+	case "ec":
+		if keyCurve != "P256" && keyCurve != "P384" && keyCurve != "P521" {
+			return fmt.Errorf(errorTextInvalidKeyCurve, keyCurve)
+		}
+	default:
+		return fmt.Errorf(errorTextInvalidKeyType, keyType)
+	}
+	return nil
+}
+
+// validateRSAKeyBits validates the size of an RSA key is within the role min_key_bits and max_key_bits. A size of 0 is
+// the default size used when the role doesn't set one.
+func validateRSAKeyBits(role *roleEntry, keyBits int) error {
+	if keyBits == 0 {
+		keyBits = defaultKeySize
+	}
+	if keyBits < role.MinKeyBits {
+		return fmt.Errorf(errorTextRSAKeyBitsTooSmall, keyBits, role.MinKeyBits)
+	}
+	if role.MaxKeyBits > 0 && keyBits > role.MaxKeyBits {
+		return fmt.Errorf(errorTextRSAKeyBitsTooLarge, keyBits, role.MaxKeyBits)
+	}
+	return nil
+}
+
+// validatePrivateKeyParams validates a private key given on the issue request is of the requested key type, and of its
+// size or curve. An RSA key of any size within the role limits is taken when no size was requested.
+func validatePrivateKeyParams(role *roleEntry, key crypto.Signer) error {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if role.KeyType != "rsa" {
+			return fmt.Errorf(errorTextPrivateKeyTypeMismatch, "rsa", role.KeyType)
+		}
+		bits := k.N.BitLen()
+		if role.KeyBits != 0 && bits != role.KeyBits {
+			return fmt.Errorf(errorTextPrivateKeyBitsMismatch, bits, role.KeyBits)
+		}
+		return validateRSAKeyBits(role, bits)
+	case *ecdsa.PrivateKey:
+		if role.KeyType != "ec" {
+			return fmt.Errorf(errorTextPrivateKeyTypeMismatch, "ec", role.KeyType)
+		}
+		curve := strings.Replace(k.Curve.Params().Name, "-", "", 1)
+		if curve != role.KeyCurve {
+			return fmt.Errorf(errorTextPrivateKeyCurveMismatch, curve, role.KeyCurve)
+		}
+		return nil
+	}
+	return fmt.Errorf(errorTextPrivateKeyUnsupported)
+}
+
+// privateKeyType names the algorithm of a private key as the built-in PKI engine does in "private_key_type"
+func privateKeyType(key crypto.Signer) string {
+	return publicKeyType(key.Public())
+}
+
+// publicKeyType returns the key type of a public key, e.g. of a CSR, as it's given to the roles
+func publicKeyType(pub crypto.PublicKey) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return "rsa"
+	case *ecdsa.PublicKey:
+		return "ec"
+	case ed25519.PublicKey:
+		return "ed25519"
+	}
+	return ""
+}
+
+// requestKeyRole returns the role with the key parameters of the issue request, which override the role ones within
+// the key sizes the role allows. The key type and curve can only be chosen when the role leaves the choice to callers,
+// with key_type "any" or several allowed_key_types.
+func requestKeyRole(role *roleEntry, data *framework.FieldData) (*roleEntry, error) {
+	keyRole := *role
+	if keyType, ok := data.GetOk("key_type"); ok {
+		keyRole.KeyType = keyType.(string)
+	}
+	if keyBits, ok := data.GetOk("key_bits"); ok {
+		keyRole.KeyBits = keyBits.(int)
+	}
+	if keyCurve, ok := data.GetOk("key_curve"); ok {
+		keyRole.KeyCurve = keyCurve.(string)
+	}
+
+	if keyRole.KeyType == "any" {
+		return nil, fmt.Errorf(errorTextInvalidKeyType, keyRole.KeyType)
+	}
+	if err := validateKeyParams(keyRole.KeyType, keyRole.KeyBits, keyRole.KeyCurve); err != nil {
+		return nil, err
+	}
+	if !keyRole.isAllowedKeyType(keyRole.KeyType) {
+		return nil, fmt.Errorf(errorTextKeyTypeNotAllowed, keyRole.KeyType, strings.Join(keyRole.AllowedKeyTypes, `", "`))
+	}
+	keyChoice := role.KeyType == "any" || len(role.AllowedKeyTypes) > 1
+	if !keyChoice && keyRole.KeyType != role.KeyType {
+		return nil, fmt.Errorf(errorTextKeyTypeOverride, keyRole.KeyType, role.KeyType)
+	}
+	if !keyChoice && keyRole.KeyType == "ec" && keyRole.KeyCurve != role.KeyCurve {
+		return nil, fmt.Errorf(errorTextKeyCurveOverride, keyRole.KeyCurve, role.KeyCurve)
+	}
+	if keyRole.KeyType == "rsa" {
+		if err := validateRSAKeyBits(&keyRole, keyRole.KeyBits); err != nil {
+			return nil, err
+		}
+	}
+	return &keyRole, nil
+}
+
+// keyGenerationFields are the issue parameters that only apply to keys generated by the backend
+var keyGenerationFields = []string{"key_type", "key_bits", "key_curve", "private_key", "key_password", "private_key_format"}
+
+// requestCSR returns the CSR given to an issue request, which takes precedence over generating a key
+func requestCSR(data *framework.FieldData) string {
+	csr, ok := data.GetOk("csr")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(csr.(string))
+}
+
+// ignoredKeyFields returns the key generation parameters of an issue request that are ignored because it has a CSR
+func ignoredKeyFields(data *framework.FieldData) []string {
+	var ignored []string
+	for _, field := range keyGenerationFields {
+		if _, ok := data.GetOk(field); ok {
+			ignored = append(ignored, field)
+		}
+	}
+	return ignored
+}
+
+func isValidPrivateKeyFormat(format string) bool {
+	return format == "" || format == privateKeyFormatPKCS1 || format == privateKeyFormatPKCS8
+}
+
+// encodePrivateKey returns the PEM of a private key returned to callers, in the "private_key_format" of the role or
+// request. Keys with a password are always encrypted as PKCS#8, the legacy PEM encryption being insecure.
+func encodePrivateKey(key crypto.Signer, format string, password string) (string, error) {
+	if format == privateKeyFormatPKCS8 || password != "" {
+		return encodePKCS8PrivateKey(key, password)
+	}
+	pcc := &certificate.PEMCollection{}
+	if err := pcc.AddPrivateKey(key, nil); err != nil {
+		return "", err
+	}
+	return pcc.PrivateKey, nil
+}
+
+// encodePKCS8PrivateKey marshals the key as a PKCS#8 PEM block, the format expected by Java keystores and some ingress
+// controllers. With a password the key is encrypted with PBES2, using PBKDF2 with HMAC-SHA256 and AES-256-CBC, as
+// openssl does by default.
+func encodePKCS8PrivateKey(key crypto.Signer, password string) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal private key as PKCS#8: %s", err)
+	}
+	if password == "" {
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+	}
+
+	encrypted, err := encryptPKCS8(der, []byte(password))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt PKCS#8 private key: %s", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted})), nil
+}
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+const (
+	pbkdf2Iterations = 100000
+	//the iteration count of keys given by callers is capped, so a key can't make the backend derive its key for hours
+	maxPBKDF2Iterations = 10000000
+)
+
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+func encryptPKCS8(der, password []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key(password, salt, pbkdf2Iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	encrypted := append(der[:len(der):len(der)], bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pbkdf2Iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		EncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData:       encrypted,
+	})
+}
+
+// decryptPKCS8 decrypts a PBES2 encrypted PKCS#8 key using PBKDF2 and AES-CBC, which covers the keys encrypted by the
+// backend and by openssl with its defaults
+func decryptPKCS8(der, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted PKCS#8 private key: %s", err)
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported PKCS#8 encryption %s, only PBES2 is supported", info.EncryptionAlgorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse PBES2 parameters: %s", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported PBES2 key derivation %s, only PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, fmt.Errorf("failed to parse PBKDF2 parameters: %s", err)
+	}
+
+	if kdfParams.IterationCount <= 0 || kdfParams.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf(errorTextPBKDF2Iterations, kdfParams.IterationCount, maxPBKDF2Iterations)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case kdfParams.PRF.Algorithm == nil, kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 function %s", kdfParams.PRF.Algorithm)
+	}
+
+	var keyLength int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLength = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLength = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, fmt.Errorf("unsupported PBES2 encryption %s", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid AES-CBC initialization vector")
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key(password, kdfParams.Salt, kdfParams.IterationCount, keyLength, prf))
+	if err != nil {
+		return nil, err
+	}
+	encrypted := info.EncryptedData
+	if len(encrypted) == 0 || len(encrypted)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted PKCS#8 private key length")
+	}
+	decrypted := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, encrypted)
+
+	//a wrong password is detected by the padding, as with x509.DecryptPEMBlock
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(decrypted[len(decrypted)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, x509.IncorrectPasswordError
+	}
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+const (
+	errorTextInvalidRSAKeyBits    = `"key_bits" %d is not valid for "rsa" keys, use 2048, 3072 or 4096`
+	errorTextInvalidKeyCurve      = `"key_curve" %q is not valid for "ec" keys, use "P256", "P384" or "P521"`
+	errorTextInvalidKeyType       = `"key_type" %q is not valid, use "rsa" or "ec"`
+	errorTextRSAKeyBitsTooSmall   = `RSA key of %d bits is smaller than the role "min_key_bits" %d`
+	errorTextRSAKeyBitsTooLarge   = `RSA key of %d bits is larger than the role "max_key_bits" %d`
+	errorTextKeyTypeNotAllowed    = `"key_type" %q is not allowed by the role, use "%s"`
+	errorTextCSRKeyTypeNotAllowed = `CSR key type %q is not allowed by the role, use "%s"`
+	errorTextKeyTypeOverride      = `"key_type" %q can't be requested, the role only issues %q keys`
+	errorTextKeyCurveOverride     = `"key_curve" %q can't be requested, the role only issues keys on curve %q`
+
+	errorTextPrivateKeyTypeMismatch  = `"private_key" is an %s key but the requested key type is %q`
+	errorTextPrivateKeyBitsMismatch  = `"private_key" is an RSA key of %d bits but %d bits were requested`
+	errorTextPrivateKeyCurveMismatch = `"private_key" is an EC key on curve %s but curve %s was requested`
+	errorTextPBKDF2Iterations        = "invalid PBKDF2 iteration count %d of the encrypted private key, it must be between 1 and %d"
+	errorTextPrivateKeyUnsupported   = `"private_key" must be an RSA or EC key`
+)
@@ -0,0 +1,150 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const limitsConfigPath = "config/limits"
+
+// limitsConfig holds the limits applied to all the roles of the mount
+type limitsConfig struct {
+	MaxConcurrentRequests int `json:"max_concurrent_requests"`
+}
+
+func pathConfigLimits(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/limits$",
+		Fields: map[string]*framework.FieldSchema{
+			"max_concurrent_requests": {
+				Type: framework.TypeInt,
+				Description: `The maximum number of certificate requests and retrievals sent to Venafi at the same time by all
+the roles of the mount, the others wait for a free slot. Defaults to 0, no limit`,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigLimitsRead,
+			logical.UpdateOperation: b.pathConfigLimitsWrite,
+		},
+
+		HelpSynopsis:    pathConfigLimitsHelpSyn,
+		HelpDescription: pathConfigLimitsHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigLimitsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getLimitsConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"max_concurrent_requests": config.MaxConcurrentRequests,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigLimitsWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getLimitsConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if maxConcurrentRequests, ok := data.GetOk("max_concurrent_requests"); ok {
+		config.MaxConcurrentRequests = maxConcurrentRequests.(int)
+	}
+	if config.MaxConcurrentRequests < 0 {
+		return logical.ErrorResponse(errorTextMaxConcurrentRequestsNegative), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(limitsConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	b.requestSlotsLock.Lock()
+	b.requestLimit = config.MaxConcurrentRequests
+	b.requestLimitLoaded = true
+	b.requestSlotsLock.Unlock()
+	return nil, nil
+}
+
+func getLimitsConfig(ctx context.Context, s logical.Storage) (*limitsConfig, error) {
+	config := &limitsConfig{}
+	entry, err := s.Get(ctx, limitsConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(config); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// withRequestSlot runs call, which sends a request to Venafi, once a slot of the mount is free when the mount limits
+// its concurrent requests, so a burst of requests queues up instead of overwhelming Venafi
+func (b *backend) withRequestSlot(ctx context.Context, call func() error) error {
+	slots, err := b.getRequestSlots(ctx)
+	if err != nil {
+		return err
+	}
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for a Venafi request slot: %s", ctx.Err())
+		}
+	}
+	return call()
+}
+
+// getRequestSlots returns the pool of request slots of the mount, or nil when the mount doesn't limit its requests.
+// The limit is read from the storage the first time and again after it's invalidated.
+func (b *backend) getRequestSlots(ctx context.Context) (chan struct{}, error) {
+	b.requestSlotsLock.Lock()
+	defer b.requestSlotsLock.Unlock()
+
+	//backends without storage, as in unit tests, have no limits
+	if !b.requestLimitLoaded && b.storage != nil {
+		config, err := getLimitsConfig(ctx, b.storage)
+		if err != nil {
+			return nil, err
+		}
+		b.requestLimit = config.MaxConcurrentRequests
+		b.requestLimitLoaded = true
+	}
+	if b.requestLimit <= 0 {
+		return nil, nil
+	}
+
+	//a new pool is created when the limit is updated, requests holding a slot of the old one just release it
+	if cap(b.requestSlots) != b.requestLimit {
+		b.requestSlots = make(chan struct{}, b.requestLimit)
+	}
+	return b.requestSlots, nil
+}
+
+// invalidate forgets the cached limits when they're written on another node
+func (b *backend) invalidate(ctx context.Context, key string) {
+	if key == limitsConfigPath {
+		b.requestSlotsLock.Lock()
+		b.requestLimitLoaded = false
+		b.requestSlotsLock.Unlock()
+	}
+}
+
+const (
+	errorTextMaxConcurrentRequestsNegative = `"max_concurrent_requests" can't be negative`
+
+	pathConfigLimitsHelpSyn  = `Configure the limits of the mount.`
+	pathConfigLimitsHelpDesc = `This path configures the limits applied to all the roles of the mount. With max_concurrent_requests
+the certificate requests and retrievals sent to Venafi at the same time are capped, the others wait for a free slot
+instead of opening more connections, which protects a shared Venafi Platform from being overwhelmed.`
+)
@@ -0,0 +1,115 @@
+package pki
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestConfigLimits(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(data map[string]interface{}) *logical.Response {
+		resp, err := integrationTestEnv.Backend.HandleRequest(integrationTestEnv.Context, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config/limits",
+			Storage:   integrationTestEnv.Storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := write(map[string]interface{}{"max_concurrent_requests": -1}); resp == nil || !resp.IsError() {
+		t.Fatalf("negative max_concurrent_requests should be rejected: %#v", resp)
+	}
+	if resp := write(map[string]interface{}{"max_concurrent_requests": 2}); resp != nil && resp.IsError() {
+		t.Fatalf("failed to write limits: %s", resp.Error())
+	}
+
+	resp, err := integrationTestEnv.Backend.HandleRequest(integrationTestEnv.Context, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/limits",
+		Storage:   integrationTestEnv.Storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["max_concurrent_requests"] != 2 {
+		t.Fatalf("expected max_concurrent_requests 2, got %#v", resp.Data)
+	}
+
+	b := integrationTestEnv.Backend.(*backend)
+	slots, err := b.getRequestSlots(integrationTestEnv.Context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cap(slots) != 2 {
+		t.Fatalf("expected 2 request slots, got %d", cap(slots))
+	}
+
+	//the limit is read again from the storage once invalidated
+	b.invalidate(integrationTestEnv.Context, limitsConfigPath)
+	if err := integrationTestEnv.Storage.Delete(integrationTestEnv.Context, limitsConfigPath); err != nil {
+		t.Fatal(err)
+	}
+	slots, err = b.getRequestSlots(integrationTestEnv.Context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slots != nil {
+		t.Fatalf("expected no request slots without limits, got %d", cap(slots))
+	}
+}
+
+func TestWithRequestSlot(t *testing.T) {
+	b := &backend{requestLimit: 2, requestLimitLoaded: true}
+	ctx := context.Background()
+
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := b.withRequestSlot(ctx, func() error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxRunning > 2 {
+		t.Fatalf("expected at most 2 requests at the same time, got %d", maxRunning)
+	}
+
+	//a request waiting for a slot gives up when its context is cancelled
+	slots, _ := b.getRequestSlots(ctx)
+	slots <- struct{}{}
+	slots <- struct{}{}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := b.withRequestSlot(cancelled, func() error { return nil }); err == nil {
+		t.Fatal("waiting for a slot should fail when the context is cancelled")
+	}
+}
@@ -0,0 +1,152 @@
+package pki
+
+import (
+	"context"
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"sort"
+	"time"
+)
+
+// The enrollments are also emitted to the telemetry of Vault, labeled with the role, under these keys
+var (
+	metricKeyIssued        = []string{"venafi", "enroll", "issued"}
+	metricKeyFailed        = []string{"venafi", "enroll", "failed"}
+	metricKeyPending       = []string{"venafi", "enroll", "pending"}
+	metricKeyPendingPoll   = []string{"venafi", "retrieve", "pending_poll"}
+	metricKeyRetrievalTime = []string{"venafi", "retrieve", "time"}
+)
+
+// roleMetrics counts the enrollments of a role since the plugin started, so rising pending times and failure rates
+// can be alerted on
+type roleMetrics struct {
+	Requests         int64
+	Issued           int64
+	Failed           int64
+	Pending          int64
+	PendingPolls     int64
+	Retrievals       int64
+	RetrievalTime    time.Duration
+	MaxRetrievalTime time.Duration
+}
+
+func pathMetrics(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "metrics$",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathMetricsRead,
+		},
+
+		HelpSynopsis:    pathMetricsHelpSyn,
+		HelpDescription: pathMetricsHelpDesc,
+	}
+}
+
+// updateMetrics applies update to the metrics of the role
+func (b *backend) updateMetrics(roleName string, update func(m *roleMetrics)) {
+	if roleName == "" {
+		return
+	}
+	b.metricsLock.Lock()
+	defer b.metricsLock.Unlock()
+
+	if b.metrics == nil {
+		b.metrics = make(map[string]*roleMetrics)
+	}
+	m, ok := b.metrics[roleName]
+	if !ok {
+		m = &roleMetrics{}
+		b.metrics[roleName] = m
+	}
+	update(m)
+}
+
+// metricLabels returns the labels of the telemetry of the role
+func metricLabels(roleName string) []metrics.Label {
+	return []metrics.Label{{Name: "role", Value: roleName}}
+}
+
+// recordRetrieval adds the time spent retrieving a certificate from Venafi since start to the metrics of the role
+func (b *backend) recordRetrieval(roleName string, start time.Time) {
+	metrics.MeasureSinceWithLabels(metricKeyRetrievalTime, start, metricLabels(roleName))
+	elapsed := time.Since(start)
+	b.updateMetrics(roleName, func(m *roleMetrics) {
+		m.Retrievals++
+		m.RetrievalTime += elapsed
+		if elapsed > m.MaxRetrievalTime {
+			m.MaxRetrievalTime = elapsed
+		}
+	})
+}
+
+// recordPending counts a request of the role that was still pending in Venafi when it timed out
+func (b *backend) recordPending(roleName string) {
+	metrics.IncrCounterWithLabels(metricKeyPending, 1, metricLabels(roleName))
+	b.updateMetrics(roleName, func(m *roleMetrics) { m.Pending++ })
+}
+
+// recordPendingPoll counts a check of the status of a pending certificate of the role
+func (b *backend) recordPendingPoll(roleName string) {
+	metrics.IncrCounterWithLabels(metricKeyPendingPoll, 1, metricLabels(roleName))
+	b.updateMetrics(roleName, func(m *roleMetrics) { m.PendingPolls++ })
+}
+
+// recordOutcome counts an issue or sign request of the role as issued or failed
+func (b *backend) recordOutcome(roleName string, resp *logical.Response, err error) {
+	failed := err != nil || (resp != nil && resp.IsError())
+	if failed {
+		metrics.IncrCounterWithLabels(metricKeyFailed, 1, metricLabels(roleName))
+	} else {
+		metrics.IncrCounterWithLabels(metricKeyIssued, 1, metricLabels(roleName))
+	}
+	b.updateMetrics(roleName, func(m *roleMetrics) {
+		m.Requests++
+		if failed {
+			m.Failed++
+		} else {
+			m.Issued++
+		}
+	})
+}
+
+func (b *backend) pathMetricsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.metricsLock.Lock()
+	defer b.metricsLock.Unlock()
+
+	roles := make([]string, 0, len(b.metrics))
+	for roleName := range b.metrics {
+		roles = append(roles, roleName)
+	}
+	sort.Strings(roles)
+
+	respData := map[string]interface{}{}
+	for _, roleName := range roles {
+		m := b.metrics[roleName]
+		var avgRetrieval float64
+		if m.Retrievals > 0 {
+			avgRetrieval = (m.RetrievalTime / time.Duration(m.Retrievals)).Seconds()
+		}
+		respData[roleName] = map[string]interface{}{
+			"requests":              m.Requests,
+			"issued":                m.Issued,
+			"failed":                m.Failed,
+			"pending":               m.Pending,
+			"pending_polls":         m.PendingPolls,
+			"retrievals":            m.Retrievals,
+			"avg_retrieval_seconds": avgRetrieval,
+			"max_retrieval_seconds": m.MaxRetrievalTime.Seconds(),
+		}
+	}
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+const (
+	pathMetricsHelpSyn  = `Returns the enrollment metrics of each role.`
+	pathMetricsHelpDesc = `This endpoint returns, for each role, how many issue and sign requests were made since the plugin
+started and how many were issued, failed or were still pending in Venafi when they timed out. It also returns how many
+times the status of pending certificates was checked and how long retrieving them took. The same metrics are emitted to
+the telemetry of Vault with the role as label, which should be preferred for monitoring.`
+)
@@ -0,0 +1,50 @@
+package pki
+
+import (
+	"fmt"
+	"github.com/armon/go-metrics"
+	"testing"
+	"time"
+)
+
+func TestRecordTelemetry(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Hour, time.Hour)
+	cfg := metrics.DefaultConfig("vault")
+	cfg.EnableHostname = false
+	cfg.EnableRuntimeMetrics = false
+	if _, err := metrics.NewGlobal(cfg, sink); err != nil {
+		t.Fatal(err)
+	}
+	defer metrics.NewGlobal(metrics.DefaultConfig(""), &metrics.BlackholeSink{})
+
+	b, _ := createBackendWithStorage(t)
+	b.recordOutcome("web", nil, nil)
+	b.recordOutcome("web", nil, fmt.Errorf("failed"))
+	b.recordOutcome("web", nil, nil)
+	b.recordPending("web")
+	b.recordRetrieval("web", time.Now().Add(-time.Second))
+
+	intervals := sink.Data()
+	if len(intervals) == 0 {
+		t.Fatal("Expecting metrics to be emitted to the telemetry")
+	}
+	counters := intervals[0].Counters
+	for key, expected := range map[string]int{
+		"vault.venafi.enroll.issued;role=web":  2,
+		"vault.venafi.enroll.failed;role=web":  1,
+		"vault.venafi.enroll.pending;role=web": 1,
+	} {
+		if counters[key].Count != expected {
+			t.Fatalf("Expecting counter %s to be %d but got %#v", key, expected, counters[key])
+		}
+	}
+	if timer := intervals[0].Samples["vault.venafi.retrieve.time;role=web"]; timer.Count != 1 || timer.Max < 1000 {
+		t.Fatalf("Expecting the retrieval time of the role to be measured but got %#v", timer)
+	}
+
+	//the metrics endpoint counts the same
+	m := b.metrics["web"]
+	if m.Requests != 3 || m.Issued != 2 || m.Failed != 1 || m.Pending != 1 || m.Retrievals != 1 {
+		t.Fatalf("Expecting the metrics of the role to be kept for the metrics endpoint but got %#v", m)
+	}
+}
@@ -3,6 +3,7 @@ package pki
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
@@ -66,15 +67,32 @@ Example for Venafi Cloud: e33f3e40-4e7e-11ea-8da3-b3c196ebeb0b`,
 				Description: `Use service generated CSR for Venafi Platfrom (ignored if Saas endpoint used)`,
 				Default:     false,
 			},
+			"csr_origin": {
+				Type: framework.TypeString,
+				Description: `Where the key pair and CSR are generated. Can be "local" or "service" to have Venafi Platform generate
+them, which is the same as setting "service_generated_cert"`,
+			},
 			"store_pkey": {
 				Type:        framework.TypeBool,
 				Description: `Set it to true to store certificates privates key in certificate fields`,
 			},
+			"return_private_key": {
+				Type: framework.TypeBool,
+				Description: `If set, the private key is returned with the certificate. Set it to false to keep keys out of the
+responses, e.g. to read them on a separate path with "store_pkey". Defaults to true`,
+				Default: true,
+			},
 			"chain_option": {
 				Type:        framework.TypeString,
 				Description: `Specify ordering certificates in chain. Root can be "first" or "last"`,
 				Default:     "last",
 			},
+			"bundle_order": {
+				Type: framework.TypeString,
+				Description: `Order of the PEM blocks in the "bundle" field returned when format is "pem_bundle". Can be
+"key-cert-chain", "cert-chain-key" or "cert-key-chain"`,
+				Default: defaultBundleOrder,
+			},
 			"key_type": {
 				Type:    framework.TypeString,
 				Default: "rsa",
@@ -83,16 +101,41 @@ Example for Venafi Cloud: e33f3e40-4e7e-11ea-8da3-b3c196ebeb0b`,
 			},
 			"key_bits": {
 				Type:    framework.TypeInt,
-				Default: 2048,
-				Description: `The number of bits to use. You will almost
-certainly want to change this if you adjust
-the key_type. Default: 2048`,
+				Default: defaultKeySize,
+				Description: `The number of bits to use for RSA keys: 2048, 3072 or 4096.
+Ignored for EC keys. Default: 2048`,
 			},
 			"key_curve": {
 				Type:        framework.TypeString,
 				Default:     "P256",
 				Description: `Key curve for EC key type. Valid values are: "P256","P384","P521"`,
 			},
+			"cn_transform": {
+				Type: framework.TypeString,
+				Description: `Template applied to the common name before requesting the certificate. {{cn}} is replaced
+by the requested common name, other variables are taken from the cn_transform_vars request parameter or from
+the metadata of the requesting entity. Example: "{{env}}-{{cn}}"`,
+			},
+			"require_alt_names": {
+				Type: framework.TypeBool,
+				Description: `If set, issue requests must include at least one DNS name in alt_names,
+even when common_name is present. IP and email SANs do not satisfy this requirement.`,
+			},
+			"min_key_bits": {
+				Type: framework.TypeInt,
+				Description: `The minimum number of bits of RSA keys, requested in issue requests or in the CSRs
+submitted for signing. Defaults to 0 (any valid size)`,
+			},
+			"max_key_bits": {
+				Type: framework.TypeInt,
+				Description: `The maximum number of bits of RSA keys, requested in issue requests or in the CSRs
+submitted for signing. Defaults to 0 (any valid size)`,
+			},
+			"key_gen_concurrency": {
+				Type: framework.TypeInt,
+				Description: `The maximum number of private keys generated at the same time for this role.
+Additional requests wait for a free slot. Defaults to 0 (unlimited)`,
+			},
 			"ttl": {
 				Type:        framework.TypeDurationSecond,
 				Description: `The certificate validity if no specific certificate validity is requested.`,
@@ -117,6 +160,241 @@ attached to them. Defaults to "false".`,
 				Description: "Timeout of waiting certificate",
 				Default:     180,
 			},
+			"post_issuance_validators": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Rules the issued certificate must pass before it's returned. Can be "require_ocsp", "not_ca",
+"min_key_bits=<bits>" and "root_sha256=<fingerprint>", the latter repeated for every approved root. Use comma to separate multiple rules`,
+			},
+			"tag_origin": {
+				Type: framework.TypeBool,
+				Description: `When true, the Vault namespace and mount path the certificate is issued from are set in the Venafi
+custom field named by "origin_custom_field", so the certificate can be traced back to its mount. The namespace is read from
+the X-Vault-Namespace header, which must be added to the mount "passthrough_request_headers"`,
+			},
+			"origin_custom_field": {
+				Type: framework.TypeString,
+				Description: `Name of the Venafi custom field set with the Vault mount when "tag_origin" is true. The field must be
+defined for the zone on Venafi Platform, requests fail otherwise`,
+			},
+			"tag_requester": {
+				Type: framework.TypeBool,
+				Description: `When true, the token display name and entity ID of the Vault client requesting the certificate are
+set in the Venafi custom field named by "requester_custom_field", so the Venafi inventory shows which Vault identity
+requested each certificate`,
+			},
+			"requester_custom_field": {
+				Type: framework.TypeString,
+				Description: `Name of the Venafi custom field set with the requesting Vault identity when "tag_requester" is true.
+The field must be defined for the zone on Venafi Platform, requests fail otherwise`,
+			},
+			"origin": {
+				Type: framework.TypeString,
+				Description: `Origin recorded by Venafi for the certificates requested with the role, so they can be told apart
+from the ones issued by other tools. Defaults to "HashiCorp Vault"`,
+			},
+			"verify_chain": {
+				Type: framework.TypeString,
+				Description: `Verify that each certificate of the chain returned by Venafi is signed by another one of the chain and
+that the certificate matches the requested common name and DNS names. "warn" returns the problems found as warnings,
+"error" refuses to return and store the certificate, "off" skips the verification`,
+				Default: verifyChainOff,
+			},
+			"poll_backoff_base": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Time to wait before checking again a certificate pending in Venafi for the first time",
+				Default:     1,
+			},
+			"poll_backoff_factor": {
+				Type:        framework.TypeInt,
+				Description: "Factor the wait between checks of a pending certificate is multiplied by after each check",
+				Default:     defaultPollBackoffFactor,
+			},
+			"poll_backoff_max": {
+				Type: framework.TypeDurationSecond,
+				Description: `Maximum wait between checks of a pending certificate. Each wait is randomized between half and all of the
+backoff delay so pending requests don't poll in lockstep. The whole wait is still limited by "server_timeout"`,
+				Default: 30,
+			},
+			"private_key_format": {
+				Type:        framework.TypeString,
+				Description: `Format of returned private keys. Can be "pkcs1" (PKCS#1 for RSA, SEC1 for EC) or "pkcs8"`,
+				Default:     privateKeyFormatPKCS1,
+			},
+			"allowed_domains": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Domains the common name and SANs of certificates are checked against, as with the built-in PKI
+engine. When empty any name is passed to Venafi. Use comma to separate multiple values`,
+			},
+			"allow_bare_domains": {
+				Type:        framework.TypeBool,
+				Description: `If set, the domains in "allowed_domains" can be requested themselves`,
+			},
+			"allow_subdomains": {
+				Type: framework.TypeBool,
+				Description: `If set, subdomains of the domains in "allowed_domains" can be requested, including wildcards
+when "allow_wildcard_certificates" is true`,
+			},
+			"allow_glob_domains": {
+				Type:        framework.TypeBool,
+				Description: `If set, domains in "allowed_domains" can contain glob patterns, e.g. "ftp*.example.com"`,
+			},
+			"require_cn": {
+				Type: framework.TypeBool,
+				Description: `If set, issue requests must include a common_name instead of taking the first of alt_names,
+and CSRs submitted for signing must have a common name`,
+			},
+			"allow_wildcard_certificates": {
+				Type:        framework.TypeBool,
+				Description: `If set, wildcards can be requested in the common name and DNS SANs. Defaults to true`,
+				Default:     true,
+			},
+			"add_wildcard_apex": {
+				Type: framework.TypeBool,
+				Description: `If set, the apex domain of the wildcards requested in the common name or DNS SANs is added to the DNS
+SANs, e.g. example.com for *.example.com. Doesn't apply to CSRs submitted for signing`,
+			},
+			"allowed_uri_sans": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `URI SANs that can be requested, which can contain glob patterns as with the built-in PKI
+engine, where * also matches slashes, e.g. "spiffe://example.org/*". When empty any URI is passed to Venafi. Use comma
+to separate multiple values`,
+			},
+			"custom_fields": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Default custom fields set on requests in format 'key=value'. A field given on the issue or sign path
+replaces the role values of the same field. Use comma to separate multiple values: 'key1=value1,key2=value2'`,
+			},
+			"organization": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Default organization (O) of the certificate subject. Use comma to separate multiple values",
+			},
+			"ou": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Default organizational unit (OU) of the certificate subject. Use comma to separate multiple values",
+			},
+			"locality": {
+				Type:        framework.TypeString,
+				Description: "Default locality (L) of the certificate subject",
+			},
+			"province": {
+				Type:        framework.TypeString,
+				Description: "Default province or state (ST) of the certificate subject",
+			},
+			"country": {
+				Type:        framework.TypeString,
+				Description: "Default country (C) of the certificate subject",
+			},
+			"retrieve_timeout": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long to wait for a certificate pending in Venafi, e.g. for an approval, before giving up
+and returning its pickup ID. Defaults to "server_timeout" when unset`,
+			},
+			"poll_interval": {
+				Type: framework.TypeDurationSecond,
+				Description: `Fixed wait between checks of a pending certificate. When unset the wait is given by
+"poll_backoff_base", "poll_backoff_factor" and "poll_backoff_max"`,
+			},
+			"work_to_do_timeout": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long Venafi Platform waits for the workflow of a pending certificate, e.g. an approval, on
+each retrieval before answering, so it's picked up as soon as it's issued. Ignored for Venafi Cloud`,
+			},
+			"refetch_missing_chain": {
+				Type:        framework.TypeBool,
+				Description: `Retrieve the certificate again from Venafi Cloud when it's returned without its chain. Ignored for Venafi Platform`,
+				Default:     true,
+			},
+			"rate_limit_max_attempts": {
+				Type:        framework.TypeInt,
+				Description: "Number of times a request rate limited by Venafi (HTTP 429) or failing with a retryable error is retried before failing",
+				Default:     defaultRateLimitMaxAttempts,
+			},
+			"rate_limit_max_wait": {
+				Type: framework.TypeDurationSecond,
+				Description: `The maximum time to wait before retrying a request rate limited by Venafi or failing with a retryable
+error, even if Retry-After asks for longer. vcert doesn't expose the response headers, so Retry-After is only honored
+when Venafi includes it in the error text`,
+				Default: 30,
+			},
+			"retryable_error_substrings": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Errors from Venafi containing any of these substrings (case insensitive) are treated as transient
+and retried like rate limited requests. Use comma to separate multiple values`,
+			},
+			"cn_only_behavior": {
+				Type: framework.TypeString,
+				Description: `What to do when a request has a common name but no DNS name in "alt_names". "append" always adds
+the common name as a DNS SAN. "promote" and "fail" read the zone configuration and, when the zone allows DNS SANs, add
+the common name as a DNS SAN; otherwise the common name is not added. "fail" rejects the request instead when the zone
+allows DNS SANs but not the common name`,
+				Default: cnOnlyBehaviorAppend,
+			},
+			"signature_algorithm": {
+				Type: framework.TypeString,
+				Description: `Algorithm locally generated CSRs are signed with, for zones that require a given hash, e.g.
+"SHA384-RSA", "SHA256-RSAPSS" or "ECDSA-SHA384". It must match the key type. Defaults to the algorithm of the key`,
+			},
+			"lease_max_ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `The maximum duration of the leases generated with "generate_lease", which otherwise last until the
+certificate expires. Leases never exceed the max lease TTL of the mount`,
+			},
+			"key_gen_timeout": {
+				Type: framework.TypeDurationSecond,
+				Description: `Maximum time to generate the private key of a request, including the wait for a "key_gen_concurrency"
+slot, before the request fails. Defaults to 60s`,
+			},
+			"reset_abandoned_requests": {
+				Type: framework.TypeBool,
+				Description: `Reset the pending request on Venafi Platform when the certificate can't be retrieved in time or the
+request is cancelled, instead of leaving it open. Such requests can't be picked up later. Requires a Venafi secret with
+an access token`,
+			},
+			"revoke_on_lease_end": {
+				Type: framework.TypeBool,
+				Description: `When true, the certificate is revoked in Venafi when its lease generated with "generate_lease" ends,
+either revoked or expired. Leases can be shorter than the certificate, so certificates in use can be revoked this way`,
+			},
+			"revoke_by_dn": {
+				Type: framework.TypeBool,
+				Description: `When true, certificates the backend didn't store can be revoked with the role by giving their TPP
+certificate DN, even though they may not have been issued by the role`,
+			},
+			"allowed_key_types": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Key types, "rsa" or "ec", that requests can ask for with "key_type". Must include the role
+"key_type". Any key type Venafi accepts if not set`,
+			},
+			"additional_zones": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Zones equivalent to "zone" that requests are spread across in round robin, for throughput and
+resilience. A zone failing on the Venafi side is skipped for a minute and the request is sent to the next one`,
+			},
+			"lease_default_ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `The duration of the leases generated with "generate_lease", when shorter than the certificate
+lifetime or when the certificate expiration can't be determined. Leases last until the certificate expires if not set`,
+			},
+			"lease_round_to": {
+				Type: framework.TypeDurationSecond,
+				Description: `Round the duration of the leases generated with "generate_lease" down to a multiple of this duration,
+e.g. 719h instead of 719h59m58s. Defaults to 1h`,
+			},
+			"renew_before": {
+				Type: framework.TypeString,
+				Description: `When certificates should be renewed, returned as "renew_after" with each certificate: a percentage
+of the certificate lifetime left, e.g. "33%", or a duration before the expiration, e.g. "720h". Defaults to "33%"`,
+			},
+			"round_validity_to": {
+				Type: framework.TypeDurationSecond,
+				Description: `Round the requested validity to the nearest multiple of this duration (e.g. 24h), so certificates
+expire on predictable boundaries. Rounding goes down instead when rounding up would exceed "max_ttl"`,
+			},
+			"unique_cn": {
+				Type: framework.TypeBool,
+				Description: `When true, a certificate is not issued if a stored certificate with the same common name has
+neither expired nor been revoked, unless the request sets "force". Use renewal instead of issuing duplicate certificates`,
+			},
 			"venafi_secret": {
 				Type:        framework.TypeString,
 				Description: `The name of the credentials object to be used for authentication`,
@@ -156,8 +434,30 @@ const (
 	errorTextStoreByAndStoreByCNOrSerialConflict = `Can't specify both story_by and store_by_cn or store_by_serial options '`
 	errorTextNoStoreAndStoreByCNOrSerialConflict = `Can't specify both no_store and store_by_cn or store_by_serial options '`
 	errorTextNoStoreAndStoreByConflict           = `Can't specify both no_store and store_by options '`
+	errorTextReturnPrivateKeyNotStored           = `"return_private_key" can only be false when "store_pkey" is true and "no_store" isn't set`
 	errTextStoreByWrongOption                    = "Option store_by can be %s or %s, not %s"
+	errTextBundleOrderWrongOption                = "Option bundle_order can be %s, %s or %s, not %s"
+	errTextPrivateKeyFormatWrongOption           = "Option private_key_format can be %s or %s, not %s"
+	errTextCNOnlyBehaviorWrongOption             = "Option cn_only_behavior can be %s, %s or %s, not %s"
+	errTextVerifyChainWrongOption                = "Option verify_chain can be %s, %s or %s, not %s"
 	errorTextVenafiSecretEmpty                   = `"venafi_secret" argument is required`
+	errorTextRateLimitMaxAttemptsNegative        = `"rate_limit_max_attempts" can't be negative`
+	errorTextKeyGenConcurrencyNegative           = `"key_gen_concurrency" can't be negative`
+	errorTextKeyGenTimeoutNegative               = `"key_gen_timeout" can't be negative`
+	errorTextAllowedKeyTypesWrongOption          = `"allowed_key_types" can only contain "rsa" or "ec", not %q`
+	errorTextKeyBitsRange                        = `"min_key_bits" and "max_key_bits" can't be negative and "min_key_bits" can't be greater than "max_key_bits"`
+	errorTextTagOriginNoCustomField              = `"origin_custom_field" is required when "tag_origin" is true`
+	errorTextTagRequesterNoCustomField           = `"requester_custom_field" is required when "tag_requester" is true`
+	errorTextUnknownRole                         = "unknown role %q"
+	errTextCSROriginWrongOption                  = "Option csr_origin can be %s or %s, not %s"
+	errorTextCSROriginConflict                   = `"csr_origin" "local" conflicts with "service_generated_cert"`
+	errorTextPollBackoffNegative                 = `"poll_backoff_base", "poll_backoff_factor" and "poll_backoff_max" can't be negative`
+	errorTextRetrieveTimeoutNegative             = `"retrieve_timeout" and "poll_interval" can't be negative`
+	errorTextWorkToDoTimeoutNegative             = `"work_to_do_timeout" can't be negative`
+	errorTextCNTransformNoVariables              = `"cn_transform" must contain at least one variable, for example {{cn}}`
+	errorTextRoundValidityToTooSmall             = `"round_validity_to" must be at least one hour, validity is requested in hours`
+	errorTextRoundValidityToExceedsMaxTTL        = `"round_validity_to" value must be less than "max_ttl" value`
+	errorTextLeaseTTLNegative                    = `"lease_max_ttl", "lease_default_ttl" and "lease_round_to" values can't be negative`
 )
 
 func (b *backend) getRole(ctx context.Context, s logical.Storage, n string) (*roleEntry, error) {
@@ -182,6 +482,8 @@ func (b *backend) pathRoleDelete(ctx context.Context, req *logical.Request, data
 	if err != nil {
 		return nil, err
 	}
+	b.invalidateCAChain(data.Get("name").(string))
+	b.invalidateCustomFields(data.Get("name").(string))
 
 	return nil, nil
 }
@@ -268,6 +570,12 @@ func (b *backend) pathRoleUpdate(ctx context.Context, req *logical.Request, data
 		entry.StorePrivateKey = storePkey
 	}
 
+	_, isSet = data.GetOk("return_private_key")
+	returnPrivateKey := data.Get("return_private_key").(bool)
+	if isSet {
+		entry.ReturnPrivateKey = &returnPrivateKey
+	}
+
 	_, isSet = data.GetOk("key_type")
 	keyType := data.Get("key_type").(string)
 	if isSet && (entry.KeyType != keyType) {
@@ -286,6 +594,36 @@ func (b *backend) pathRoleUpdate(ctx context.Context, req *logical.Request, data
 		entry.KeyCurve = keyCurve
 	}
 
+	_, isSet = data.GetOk("min_key_bits")
+	minKeyBits := data.Get("min_key_bits").(int)
+	if isSet && (entry.MinKeyBits != minKeyBits) {
+		entry.MinKeyBits = minKeyBits
+	}
+
+	_, isSet = data.GetOk("max_key_bits")
+	maxKeyBits := data.Get("max_key_bits").(int)
+	if isSet && (entry.MaxKeyBits != maxKeyBits) {
+		entry.MaxKeyBits = maxKeyBits
+	}
+
+	_, isSet = data.GetOk("key_gen_concurrency")
+	keyGenConcurrency := data.Get("key_gen_concurrency").(int)
+	if isSet && (entry.KeyGenConcurrency != keyGenConcurrency) {
+		entry.KeyGenConcurrency = keyGenConcurrency
+	}
+
+	_, isSet = data.GetOk("cn_transform")
+	cnTransform := data.Get("cn_transform").(string)
+	if isSet && (entry.CNTransform != cnTransform) {
+		entry.CNTransform = cnTransform
+	}
+
+	_, isSet = data.GetOk("require_alt_names")
+	requireAltNames := data.Get("require_alt_names").(bool)
+	if isSet && (entry.RequireAltNames != requireAltNames) {
+		entry.RequireAltNames = requireAltNames
+	}
+
 	_, isSet = data.GetOk("max_ttl")
 	maxTtl := time.Duration(data.Get("max_ttl").(int)) * time.Second
 	if isSet && (entry.MaxTTL != maxTtl) {
@@ -310,6 +648,285 @@ func (b *backend) pathRoleUpdate(ctx context.Context, req *logical.Request, data
 		entry.ServerTimeout = serverTimeout
 	}
 
+	_, isSet = data.GetOk("refetch_missing_chain")
+	refetchMissingChain := data.Get("refetch_missing_chain").(bool)
+	if isSet {
+		entry.RefetchMissingChain = &refetchMissingChain
+	}
+
+	_, isSet = data.GetOk("rate_limit_max_attempts")
+	rateLimitMaxAttempts := data.Get("rate_limit_max_attempts").(int)
+	if isSet {
+		entry.RateLimitMaxAttempts = &rateLimitMaxAttempts
+	}
+
+	_, isSet = data.GetOk("rate_limit_max_wait")
+	rateLimitMaxWait := time.Duration(data.Get("rate_limit_max_wait").(int)) * time.Second
+	if isSet && (entry.RateLimitMaxWait != rateLimitMaxWait) {
+		entry.RateLimitMaxWait = rateLimitMaxWait
+	}
+
+	retryableErrorSubstrings, isSet := data.GetOk("retryable_error_substrings")
+	if isSet {
+		entry.RetryableErrorSubstrings = retryableErrorSubstrings.([]string)
+	}
+
+	_, isSet = data.GetOk("bundle_order")
+	bundleOrder := data.Get("bundle_order").(string)
+	if isSet && (entry.BundleOrder != bundleOrder) {
+		entry.BundleOrder = bundleOrder
+	}
+
+	postIssuanceValidators, isSet := data.GetOk("post_issuance_validators")
+	if isSet {
+		entry.PostIssuanceValidators = postIssuanceValidators.([]string)
+	}
+
+	_, isSet = data.GetOk("tag_origin")
+	tagOrigin := data.Get("tag_origin").(bool)
+	if isSet && (entry.TagOrigin != tagOrigin) {
+		entry.TagOrigin = tagOrigin
+	}
+
+	_, isSet = data.GetOk("origin_custom_field")
+	originCustomField := data.Get("origin_custom_field").(string)
+	if isSet && (entry.OriginCustomField != originCustomField) {
+		entry.OriginCustomField = originCustomField
+	}
+
+	_, isSet = data.GetOk("tag_requester")
+	tagRequester := data.Get("tag_requester").(bool)
+	if isSet && (entry.TagRequester != tagRequester) {
+		entry.TagRequester = tagRequester
+	}
+
+	_, isSet = data.GetOk("requester_custom_field")
+	requesterCustomField := data.Get("requester_custom_field").(string)
+	if isSet && (entry.RequesterCustomField != requesterCustomField) {
+		entry.RequesterCustomField = requesterCustomField
+	}
+
+	_, isSet = data.GetOk("origin")
+	origin := data.Get("origin").(string)
+	if isSet && (entry.Origin != origin) {
+		entry.Origin = origin
+	}
+
+	_, isSet = data.GetOk("poll_backoff_base")
+	pollBackoffBase := time.Duration(data.Get("poll_backoff_base").(int)) * time.Second
+	if isSet && (entry.PollBackoffBase != pollBackoffBase) {
+		entry.PollBackoffBase = pollBackoffBase
+	}
+
+	_, isSet = data.GetOk("poll_backoff_factor")
+	pollBackoffFactor := data.Get("poll_backoff_factor").(int)
+	if isSet && (entry.PollBackoffFactor != pollBackoffFactor) {
+		entry.PollBackoffFactor = pollBackoffFactor
+	}
+
+	_, isSet = data.GetOk("poll_backoff_max")
+	pollBackoffMax := time.Duration(data.Get("poll_backoff_max").(int)) * time.Second
+	if isSet && (entry.PollBackoffMax != pollBackoffMax) {
+		entry.PollBackoffMax = pollBackoffMax
+	}
+
+	_, isSet = data.GetOk("private_key_format")
+	privateKeyFormat := data.Get("private_key_format").(string)
+	if isSet && (entry.PrivateKeyFormat != privateKeyFormat) {
+		entry.PrivateKeyFormat = privateKeyFormat
+	}
+
+	allowedDomains, isSet := data.GetOk("allowed_domains")
+	if isSet {
+		entry.AllowedDomains = allowedDomains.([]string)
+	}
+
+	customFields, isSet := data.GetOk("custom_fields")
+	if isSet {
+		entry.CustomFields = customFields.([]string)
+	}
+
+	_, isSet = data.GetOk("csr_origin")
+	csrOrigin := data.Get("csr_origin").(string)
+	if isSet && (entry.CSROrigin != csrOrigin) {
+		entry.CSROrigin = csrOrigin
+	}
+
+	_, isSet = data.GetOk("allow_bare_domains")
+	allowBareDomains := data.Get("allow_bare_domains").(bool)
+	if isSet && (entry.AllowBareDomains != allowBareDomains) {
+		entry.AllowBareDomains = allowBareDomains
+	}
+
+	_, isSet = data.GetOk("allow_subdomains")
+	allowSubdomains := data.Get("allow_subdomains").(bool)
+	if isSet && (entry.AllowSubdomains != allowSubdomains) {
+		entry.AllowSubdomains = allowSubdomains
+	}
+
+	_, isSet = data.GetOk("allow_glob_domains")
+	allowGlobDomains := data.Get("allow_glob_domains").(bool)
+	if isSet && (entry.AllowGlobDomains != allowGlobDomains) {
+		entry.AllowGlobDomains = allowGlobDomains
+	}
+
+	_, isSet = data.GetOk("require_cn")
+	requireCN := data.Get("require_cn").(bool)
+	if isSet && (entry.RequireCN != requireCN) {
+		entry.RequireCN = requireCN
+	}
+
+	_, isSet = data.GetOk("allow_wildcard_certificates")
+	allowWildcardCertificates := data.Get("allow_wildcard_certificates").(bool)
+	if isSet {
+		entry.AllowWildcardCertificates = &allowWildcardCertificates
+	}
+
+	_, isSet = data.GetOk("add_wildcard_apex")
+	addWildcardApex := data.Get("add_wildcard_apex").(bool)
+	if isSet && (entry.AddWildcardApex != addWildcardApex) {
+		entry.AddWildcardApex = addWildcardApex
+	}
+
+	allowedURISANs, isSet := data.GetOk("allowed_uri_sans")
+	if isSet {
+		entry.AllowedURISANs = allowedURISANs.([]string)
+	}
+
+	organization, isSet := data.GetOk("organization")
+	if isSet {
+		entry.Organization = organization.([]string)
+	}
+
+	ou, isSet := data.GetOk("ou")
+	if isSet {
+		entry.OU = ou.([]string)
+	}
+
+	_, isSet = data.GetOk("locality")
+	locality := data.Get("locality").(string)
+	if isSet && (entry.Locality != locality) {
+		entry.Locality = locality
+	}
+
+	_, isSet = data.GetOk("province")
+	province := data.Get("province").(string)
+	if isSet && (entry.Province != province) {
+		entry.Province = province
+	}
+
+	_, isSet = data.GetOk("country")
+	country := data.Get("country").(string)
+	if isSet && (entry.Country != country) {
+		entry.Country = country
+	}
+
+	_, isSet = data.GetOk("retrieve_timeout")
+	retrieveTimeout := time.Duration(data.Get("retrieve_timeout").(int)) * time.Second
+	if isSet && (entry.RetrieveTimeout != retrieveTimeout) {
+		entry.RetrieveTimeout = retrieveTimeout
+	}
+
+	_, isSet = data.GetOk("poll_interval")
+	pollInterval := time.Duration(data.Get("poll_interval").(int)) * time.Second
+	if isSet && (entry.PollInterval != pollInterval) {
+		entry.PollInterval = pollInterval
+	}
+
+	_, isSet = data.GetOk("work_to_do_timeout")
+	workToDoTimeout := time.Duration(data.Get("work_to_do_timeout").(int)) * time.Second
+	if isSet && (entry.WorkToDoTimeout != workToDoTimeout) {
+		entry.WorkToDoTimeout = workToDoTimeout
+	}
+
+	_, isSet = data.GetOk("verify_chain")
+	verifyChain := data.Get("verify_chain").(string)
+	if isSet && (entry.VerifyChain != verifyChain) {
+		entry.VerifyChain = verifyChain
+	}
+
+	_, isSet = data.GetOk("cn_only_behavior")
+	cnOnlyBehavior := data.Get("cn_only_behavior").(string)
+	if isSet && (entry.CNOnlyBehavior != cnOnlyBehavior) {
+		entry.CNOnlyBehavior = cnOnlyBehavior
+	}
+
+	_, isSet = data.GetOk("signature_algorithm")
+	signatureAlgorithm := data.Get("signature_algorithm").(string)
+	if isSet && (entry.SignatureAlgorithm != signatureAlgorithm) {
+		entry.SignatureAlgorithm = signatureAlgorithm
+	}
+
+	_, isSet = data.GetOk("lease_max_ttl")
+	leaseMaxTTL := time.Duration(data.Get("lease_max_ttl").(int)) * time.Second
+	if isSet && (entry.LeaseMaxTTL != leaseMaxTTL) {
+		entry.LeaseMaxTTL = leaseMaxTTL
+	}
+
+	_, isSet = data.GetOk("key_gen_timeout")
+	keyGenTimeout := time.Duration(data.Get("key_gen_timeout").(int)) * time.Second
+	if isSet && (entry.KeyGenTimeout != keyGenTimeout) {
+		entry.KeyGenTimeout = keyGenTimeout
+	}
+
+	additionalZones, isSet := data.GetOk("additional_zones")
+	if isSet {
+		entry.AdditionalZones = additionalZones.([]string)
+	}
+
+	allowedKeyTypes, isSet := data.GetOk("allowed_key_types")
+	if isSet {
+		entry.AllowedKeyTypes = allowedKeyTypes.([]string)
+	}
+
+	_, isSet = data.GetOk("revoke_on_lease_end")
+	revokeOnLeaseEnd := data.Get("revoke_on_lease_end").(bool)
+	if isSet && (entry.RevokeOnLeaseEnd != revokeOnLeaseEnd) {
+		entry.RevokeOnLeaseEnd = revokeOnLeaseEnd
+	}
+
+	_, isSet = data.GetOk("revoke_by_dn")
+	revokeByDN := data.Get("revoke_by_dn").(bool)
+	if isSet && (entry.RevokeByDN != revokeByDN) {
+		entry.RevokeByDN = revokeByDN
+	}
+
+	_, isSet = data.GetOk("reset_abandoned_requests")
+	resetAbandonedRequests := data.Get("reset_abandoned_requests").(bool)
+	if isSet && (entry.ResetAbandonedRequests != resetAbandonedRequests) {
+		entry.ResetAbandonedRequests = resetAbandonedRequests
+	}
+
+	_, isSet = data.GetOk("lease_default_ttl")
+	leaseDefaultTTL := time.Duration(data.Get("lease_default_ttl").(int)) * time.Second
+	if isSet && (entry.LeaseDefaultTTL != leaseDefaultTTL) {
+		entry.LeaseDefaultTTL = leaseDefaultTTL
+	}
+
+	_, isSet = data.GetOk("lease_round_to")
+	leaseRoundTo := time.Duration(data.Get("lease_round_to").(int)) * time.Second
+	if isSet && (entry.LeaseRoundTo != leaseRoundTo) {
+		entry.LeaseRoundTo = leaseRoundTo
+	}
+
+	_, isSet = data.GetOk("renew_before")
+	renewBefore := data.Get("renew_before").(string)
+	if isSet && (entry.RenewBefore != renewBefore) {
+		entry.RenewBefore = renewBefore
+	}
+
+	_, isSet = data.GetOk("round_validity_to")
+	roundValidityTo := time.Duration(data.Get("round_validity_to").(int)) * time.Second
+	if isSet && (entry.RoundValidityTo != roundValidityTo) {
+		entry.RoundValidityTo = roundValidityTo
+	}
+
+	_, isSet = data.GetOk("unique_cn")
+	uniqueCN := data.Get("unique_cn").(bool)
+	if isSet && (entry.UniqueCN != uniqueCN) {
+		entry.UniqueCN = uniqueCN
+	}
+
 	_, isSet = data.GetOk("venafi_secret")
 	venafiSecret := data.Get("venafi_secret").(string)
 	if isSet && (entry.VenafiSecret != venafiSecret) {
@@ -345,24 +962,82 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		}
 
 	} else {
+		allowWildcardCertificates := data.Get("allow_wildcard_certificates").(bool)
+		returnPrivateKey := data.Get("return_private_key").(bool)
+		rateLimitMaxAttempts := data.Get("rate_limit_max_attempts").(int)
+		refetchMissingChain := data.Get("refetch_missing_chain").(bool)
 		entry = &roleEntry{
-			ChainOption:      data.Get("chain_option").(string),
-			StoreByCN:        data.Get("store_by_cn").(bool),
-			StoreBySerial:    data.Get("store_by_serial").(bool),
-			StoreBy:          data.Get("store_by").(string),
-			NoStore:          data.Get("no_store").(bool),
-			ServiceGenerated: data.Get("service_generated_cert").(bool),
-			StorePrivateKey:  data.Get("store_pkey").(bool),
-			KeyType:          data.Get("key_type").(string),
-			KeyBits:          data.Get("key_bits").(int),
-			KeyCurve:         data.Get("key_curve").(string),
-			MaxTTL:           time.Duration(data.Get("max_ttl").(int)) * time.Second,
-			TTL:              time.Duration(data.Get("ttl").(int)) * time.Second,
-			IssuerHint:       data.Get("issuer_hint").(string),
-			GenerateLease:    data.Get("generate_lease").(bool),
-			ServerTimeout:    time.Duration(data.Get("server_timeout").(int)) * time.Second,
-			VenafiSecret:     data.Get("venafi_secret").(string),
-			Zone:             data.Get("zone").(string),
+			ChainOption:               data.Get("chain_option").(string),
+			StoreByCN:                 data.Get("store_by_cn").(bool),
+			StoreBySerial:             data.Get("store_by_serial").(bool),
+			StoreBy:                   data.Get("store_by").(string),
+			NoStore:                   data.Get("no_store").(bool),
+			ServiceGenerated:          data.Get("service_generated_cert").(bool),
+			StorePrivateKey:           data.Get("store_pkey").(bool),
+			KeyType:                   data.Get("key_type").(string),
+			KeyBits:                   data.Get("key_bits").(int),
+			KeyCurve:                  data.Get("key_curve").(string),
+			KeyGenConcurrency:         data.Get("key_gen_concurrency").(int),
+			RequireAltNames:           data.Get("require_alt_names").(bool),
+			CNTransform:               data.Get("cn_transform").(string),
+			MaxTTL:                    time.Duration(data.Get("max_ttl").(int)) * time.Second,
+			TTL:                       time.Duration(data.Get("ttl").(int)) * time.Second,
+			IssuerHint:                data.Get("issuer_hint").(string),
+			GenerateLease:             data.Get("generate_lease").(bool),
+			ServerTimeout:             time.Duration(data.Get("server_timeout").(int)) * time.Second,
+			RefetchMissingChain:       &refetchMissingChain,
+			RateLimitMaxAttempts:      &rateLimitMaxAttempts,
+			RateLimitMaxWait:          time.Duration(data.Get("rate_limit_max_wait").(int)) * time.Second,
+			RetryableErrorSubstrings:  data.Get("retryable_error_substrings").([]string),
+			UniqueCN:                  data.Get("unique_cn").(bool),
+			RoundValidityTo:           time.Duration(data.Get("round_validity_to").(int)) * time.Second,
+			BundleOrder:               data.Get("bundle_order").(string),
+			CNOnlyBehavior:            data.Get("cn_only_behavior").(string),
+			PollBackoffBase:           time.Duration(data.Get("poll_backoff_base").(int)) * time.Second,
+			PollBackoffFactor:         data.Get("poll_backoff_factor").(int),
+			PollBackoffMax:            time.Duration(data.Get("poll_backoff_max").(int)) * time.Second,
+			TagOrigin:                 data.Get("tag_origin").(bool),
+			PostIssuanceValidators:    data.Get("post_issuance_validators").([]string),
+			RetrieveTimeout:           time.Duration(data.Get("retrieve_timeout").(int)) * time.Second,
+			PollInterval:              time.Duration(data.Get("poll_interval").(int)) * time.Second,
+			Organization:              data.Get("organization").([]string),
+			OU:                        data.Get("ou").([]string),
+			Locality:                  data.Get("locality").(string),
+			Province:                  data.Get("province").(string),
+			Country:                   data.Get("country").(string),
+			AllowedDomains:            data.Get("allowed_domains").([]string),
+			AllowBareDomains:          data.Get("allow_bare_domains").(bool),
+			AllowSubdomains:           data.Get("allow_subdomains").(bool),
+			AllowGlobDomains:          data.Get("allow_glob_domains").(bool),
+			PrivateKeyFormat:          data.Get("private_key_format").(string),
+			CustomFields:              data.Get("custom_fields").([]string),
+			CSROrigin:                 data.Get("csr_origin").(string),
+			MinKeyBits:                data.Get("min_key_bits").(int),
+			MaxKeyBits:                data.Get("max_key_bits").(int),
+			RequireCN:                 data.Get("require_cn").(bool),
+			AllowWildcardCertificates: &allowWildcardCertificates,
+			AllowedURISANs:            data.Get("allowed_uri_sans").([]string),
+			OriginCustomField:         data.Get("origin_custom_field").(string),
+			ReturnPrivateKey:          &returnPrivateKey,
+			WorkToDoTimeout:           time.Duration(data.Get("work_to_do_timeout").(int)) * time.Second,
+			Origin:                    data.Get("origin").(string),
+			VerifyChain:               data.Get("verify_chain").(string),
+			AddWildcardApex:           data.Get("add_wildcard_apex").(bool),
+			RenewBefore:               data.Get("renew_before").(string),
+			SignatureAlgorithm:        data.Get("signature_algorithm").(string),
+			LeaseMaxTTL:               time.Duration(data.Get("lease_max_ttl").(int)) * time.Second,
+			LeaseDefaultTTL:           time.Duration(data.Get("lease_default_ttl").(int)) * time.Second,
+			AdditionalZones:           data.Get("additional_zones").([]string),
+			KeyGenTimeout:             time.Duration(data.Get("key_gen_timeout").(int)) * time.Second,
+			AllowedKeyTypes:           data.Get("allowed_key_types").([]string),
+			ResetAbandonedRequests:    data.Get("reset_abandoned_requests").(bool),
+			TagRequester:              data.Get("tag_requester").(bool),
+			RevokeOnLeaseEnd:          data.Get("revoke_on_lease_end").(bool),
+			RevokeByDN:                data.Get("revoke_by_dn").(bool),
+			RequesterCustomField:      data.Get("requester_custom_field").(string),
+			LeaseRoundTo:              time.Duration(data.Get("lease_round_to").(int)) * time.Second,
+			VenafiSecret:              data.Get("venafi_secret").(string),
+			Zone:                      data.Get("zone").(string),
 		}
 	}
 
@@ -379,12 +1054,17 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 	if err := req.Storage.Put(ctx, jsonEntry); err != nil {
 		return nil, err
 	}
+	b.invalidateCAChain(name)
+	b.invalidateCustomFields(name)
 
 	var logResp *logical.Response
 
 	respData := map[string]interface{}{}
 
 	warnings := getCredentialsWarnings(b, ctx, req.Storage, entry.VenafiSecret)
+	if entry.NoStore && entry.StorePrivateKey {
+		warnings = append(warnings, `"store_pkey" is ignored as "no_store" is set, neither certificates nor private keys are stored`)
+	}
 
 	if cap(warnings) > 0 {
 		logResp = &logical.Response{
@@ -412,6 +1092,82 @@ func validateEntry(entry *roleEntry) (err error) {
 		)
 	}
 
+	if err := validateKeyParams(entry.KeyType, entry.KeyBits, entry.KeyCurve); err != nil {
+		return err
+	}
+	if err := validateSignatureAlgorithm(entry.SignatureAlgorithm, entry.KeyType); err != nil {
+		return err
+	}
+	if entry.MinKeyBits < 0 || entry.MaxKeyBits < 0 || (entry.MaxKeyBits > 0 && entry.MinKeyBits > entry.MaxKeyBits) {
+		return fmt.Errorf(errorTextKeyBitsRange)
+	}
+	if entry.KeyType == "rsa" {
+		if err := validateRSAKeyBits(entry, entry.KeyBits); err != nil {
+			return err
+		}
+	}
+	for _, keyType := range entry.AllowedKeyTypes {
+		if keyType != "rsa" && keyType != "ec" {
+			return fmt.Errorf(errorTextAllowedKeyTypesWrongOption, keyType)
+		}
+	}
+	if entry.KeyType != "" && entry.KeyType != "any" && !entry.isAllowedKeyType(entry.KeyType) {
+		return fmt.Errorf(errorTextKeyTypeNotAllowed, entry.KeyType, strings.Join(entry.AllowedKeyTypes, `", "`))
+	}
+
+	if _, _, err := parseRenewBefore(entry.renewBefore()); err != nil {
+		return err
+	}
+
+	if entry.RoundValidityTo != 0 && entry.RoundValidityTo < time.Hour {
+		return fmt.Errorf(errorTextRoundValidityToTooSmall)
+	}
+	if entry.MaxTTL > 0 && entry.RoundValidityTo > entry.MaxTTL {
+		return fmt.Errorf(errorTextRoundValidityToExceedsMaxTTL)
+	}
+
+	if entry.LeaseMaxTTL < 0 || entry.LeaseDefaultTTL < 0 || entry.LeaseRoundTo < 0 {
+		return fmt.Errorf(errorTextLeaseTTLNegative)
+	}
+
+	if entry.rateLimitMaxAttempts() < 0 {
+		return fmt.Errorf(errorTextRateLimitMaxAttemptsNegative)
+	}
+
+	if entry.CNTransform != "" && !strings.Contains(entry.CNTransform, "{{") {
+		return fmt.Errorf(errorTextCNTransformNoVariables)
+	}
+
+	if _, err := parseValidatorRules(entry.PostIssuanceValidators); err != nil {
+		return err
+	}
+
+	if entry.TagOrigin && strings.TrimSpace(entry.OriginCustomField) == "" {
+		return fmt.Errorf(errorTextTagOriginNoCustomField)
+	}
+	if entry.TagRequester && strings.TrimSpace(entry.RequesterCustomField) == "" {
+		return fmt.Errorf(errorTextTagRequesterNoCustomField)
+	}
+
+	if entry.PollBackoffBase < 0 || entry.PollBackoffFactor < 0 || entry.PollBackoffMax < 0 {
+		return fmt.Errorf(errorTextPollBackoffNegative)
+	}
+
+	if entry.RetrieveTimeout < 0 || entry.PollInterval < 0 {
+		return fmt.Errorf(errorTextRetrieveTimeoutNegative)
+	}
+
+	if entry.WorkToDoTimeout < 0 {
+		return fmt.Errorf(errorTextWorkToDoTimeoutNegative)
+	}
+
+	if entry.KeyGenConcurrency < 0 {
+		return fmt.Errorf(errorTextKeyGenConcurrencyNegative)
+	}
+	if entry.KeyGenTimeout < 0 {
+		return fmt.Errorf(errorTextKeyGenTimeoutNegative)
+	}
+
 	if (entry.StoreByCN || entry.StoreBySerial) && entry.StoreBy != "" {
 		return fmt.Errorf(errorTextStoreByAndStoreByCNOrSerialConflict)
 	}
@@ -421,6 +1177,10 @@ func validateEntry(entry *roleEntry) (err error) {
 	if entry.StoreBy != "" && entry.NoStore {
 		return fmt.Errorf(errorTextNoStoreAndStoreByConflict)
 	}
+	//a private key that is neither returned nor stored is lost
+	if !entry.returnPrivateKey() && (!entry.StorePrivateKey || entry.NoStore) {
+		return fmt.Errorf(errorTextReturnPrivateKeyNotStored)
+	}
 	if entry.StoreBy != "" {
 		if (entry.StoreBy != storeBySerialString) && (entry.StoreBy != storeByCNString) {
 			return fmt.Errorf(
@@ -429,6 +1189,40 @@ func validateEntry(entry *roleEntry) (err error) {
 		}
 	}
 
+	switch entry.CNOnlyBehavior {
+	case "", cnOnlyBehaviorAppend, cnOnlyBehaviorPromote, cnOnlyBehaviorFail:
+	default:
+		return fmt.Errorf(errTextCNOnlyBehaviorWrongOption, cnOnlyBehaviorAppend, cnOnlyBehaviorPromote, cnOnlyBehaviorFail, entry.CNOnlyBehavior)
+	}
+
+	switch entry.VerifyChain {
+	case "", verifyChainOff, verifyChainWarn, verifyChainError:
+	default:
+		return fmt.Errorf(errTextVerifyChainWrongOption, verifyChainOff, verifyChainWarn, verifyChainError, entry.VerifyChain)
+	}
+
+	switch entry.CSROrigin {
+	case "", csrOriginService:
+	case csrOriginLocal:
+		if entry.ServiceGenerated {
+			return fmt.Errorf(errorTextCSROriginConflict)
+		}
+	default:
+		return fmt.Errorf(errTextCSROriginWrongOption, csrOriginLocal, csrOriginService, entry.CSROrigin)
+	}
+
+	if !isValidCustomFields(entry.CustomFields) {
+		return fmt.Errorf(errorTextInvalidCustomFields)
+	}
+
+	if !isValidPrivateKeyFormat(entry.PrivateKeyFormat) {
+		return fmt.Errorf(errTextPrivateKeyFormatWrongOption, privateKeyFormatPKCS1, privateKeyFormatPKCS8, entry.PrivateKeyFormat)
+	}
+
+	if entry.BundleOrder != "" && !isValidBundleOrder(entry.BundleOrder) {
+		return fmt.Errorf(errTextBundleOrderWrongOption, bundleOrderKeyCertChain, bundleOrderCertChainKey, bundleOrderCertKeyChain, entry.BundleOrder)
+	}
+
 	//StoreBySerial and StoreByCN options are deprecated
 	//if one of them is set we will set store_by option
 	//if both are set then we set store_by to serial
@@ -459,42 +1253,231 @@ func getCredentialsWarnings(b *backend, ctx context.Context, s logical.Storage,
 type roleEntry struct {
 
 	//Venafi values
-	ChainOption      string        `json:"chain_option"`
-	StoreByCN        bool          `json:"store_by_cn"`
-	StoreBySerial    bool          `json:"store_by_serial"`
-	StoreBy          string        `json:"store_by"`
-	NoStore          bool          `json:"no_store"`
-	ServiceGenerated bool          `json:"service_generated_cert"`
-	StorePrivateKey  bool          `json:"store_pkey"`
-	KeyType          string        `json:"key_type"`
-	KeyBits          int           `json:"key_bits"`
-	KeyCurve         string        `json:"key_curve"`
-	LeaseMax         string        `json:"lease_max"`
-	Lease            string        `json:"lease"`
-	TTL              time.Duration `json:"ttl_duration"`
-	MaxTTL           time.Duration `json:"max_ttl_duration"`
-	IssuerHint       string        `json:"issuer_hint"`
-	GenerateLease    bool          `json:"generate_lease,omitempty"`
-	DeprecatedMaxTTL string        `json:"max_ttl"`
-	DeprecatedTTL    string        `json:"ttl"`
-	ServerTimeout    time.Duration `json:"server_timeout"`
-	VenafiSecret     string        `json:"venafi_secret"`
-	Zone             string        `json:"zone"`
+	ChainOption              string        `json:"chain_option"`
+	StoreByCN                bool          `json:"store_by_cn"`
+	StoreBySerial            bool          `json:"store_by_serial"`
+	StoreBy                  string        `json:"store_by"`
+	NoStore                  bool          `json:"no_store"`
+	ServiceGenerated         bool          `json:"service_generated_cert"`
+	StorePrivateKey          bool          `json:"store_pkey"`
+	KeyType                  string        `json:"key_type"`
+	KeyBits                  int           `json:"key_bits"`
+	KeyCurve                 string        `json:"key_curve"`
+	LeaseMax                 string        `json:"lease_max"`
+	Lease                    string        `json:"lease"`
+	TTL                      time.Duration `json:"ttl_duration"`
+	MaxTTL                   time.Duration `json:"max_ttl_duration"`
+	IssuerHint               string        `json:"issuer_hint"`
+	GenerateLease            bool          `json:"generate_lease,omitempty"`
+	DeprecatedMaxTTL         string        `json:"max_ttl"`
+	DeprecatedTTL            string        `json:"ttl"`
+	ServerTimeout            time.Duration `json:"server_timeout"`
+	VenafiSecret             string        `json:"venafi_secret"`
+	Zone                     string        `json:"zone"`
+	RateLimitMaxAttempts     *int          `json:"rate_limit_max_attempts,omitempty"`
+	RateLimitMaxWait         time.Duration `json:"rate_limit_max_wait"`
+	RequireAltNames          bool          `json:"require_alt_names"`
+	KeyGenConcurrency        int           `json:"key_gen_concurrency"`
+	RefetchMissingChain      *bool         `json:"refetch_missing_chain,omitempty"`
+	CNTransform              string        `json:"cn_transform"`
+	RetryableErrorSubstrings []string      `json:"retryable_error_substrings"`
+	UniqueCN                 bool          `json:"unique_cn"`
+	RoundValidityTo          time.Duration `json:"round_validity_to"`
+	BundleOrder              string        `json:"bundle_order"`
+	CNOnlyBehavior           string        `json:"cn_only_behavior"`
+	PollBackoffBase          time.Duration `json:"poll_backoff_base"`
+	PollBackoffFactor        int           `json:"poll_backoff_factor"`
+	PollBackoffMax           time.Duration `json:"poll_backoff_max"`
+	TagOrigin                bool          `json:"tag_origin"`
+	OriginCustomField        string        `json:"origin_custom_field"`
+	PostIssuanceValidators   []string      `json:"post_issuance_validators"`
+	RetrieveTimeout          time.Duration `json:"retrieve_timeout"`
+	PollInterval             time.Duration `json:"poll_interval"`
+	Organization             []string      `json:"organization"`
+	OU                       []string      `json:"ou"`
+	Locality                 string        `json:"locality"`
+	Province                 string        `json:"province"`
+	Country                  string        `json:"country"`
+	AllowedDomains           []string      `json:"allowed_domains"`
+	AllowBareDomains         bool          `json:"allow_bare_domains"`
+	AllowSubdomains          bool          `json:"allow_subdomains"`
+	AllowGlobDomains         bool          `json:"allow_glob_domains"`
+	PrivateKeyFormat         string        `json:"private_key_format"`
+	CustomFields             []string      `json:"custom_fields"`
+	CSROrigin                string        `json:"csr_origin"`
+	MinKeyBits               int           `json:"min_key_bits"`
+	MaxKeyBits               int           `json:"max_key_bits"`
+	RequireCN                bool          `json:"require_cn"`
+	//a pointer so roles stored before the option was added keep allowing wildcards
+	AllowWildcardCertificates *bool    `json:"allow_wildcard_certificates,omitempty"`
+	AllowedURISANs            []string `json:"allowed_uri_sans"`
+	//a pointer so roles stored before the option was added keep returning private keys
+	ReturnPrivateKey   *bool         `json:"return_private_key,omitempty"`
+	WorkToDoTimeout    time.Duration `json:"work_to_do_timeout"`
+	Origin             string        `json:"origin"`
+	VerifyChain        string        `json:"verify_chain"`
+	AddWildcardApex    bool          `json:"add_wildcard_apex"`
+	RenewBefore        string        `json:"renew_before"`
+	SignatureAlgorithm string        `json:"signature_algorithm"`
+	LeaseMaxTTL        time.Duration `json:"lease_max_ttl"`
+	LeaseDefaultTTL    time.Duration `json:"lease_default_ttl"`
+	LeaseRoundTo       time.Duration `json:"lease_round_to"`
+	AdditionalZones    []string      `json:"additional_zones"`
+	KeyGenTimeout      time.Duration `json:"key_gen_timeout"`
+	AllowedKeyTypes    []string      `json:"allowed_key_types"`
+	//requests left pending are reset on Venafi Platform
+	ResetAbandonedRequests bool   `json:"reset_abandoned_requests"`
+	TagRequester           bool   `json:"tag_requester"`
+	RequesterCustomField   string `json:"requester_custom_field"`
+	RevokeOnLeaseEnd       bool   `json:"revoke_on_lease_end"`
+	//certificates that weren't stored can be revoked by TPP certificate DN
+	RevokeByDN bool `json:"revoke_by_dn"`
+}
+
+// defaultLeaseRoundTo is the granularity of the generated leases of roles without "lease_round_to"
+const defaultLeaseRoundTo = time.Hour
+
+// leaseRoundTo returns the duration the generated leases are rounded down to
+func (r *roleEntry) leaseRoundTo() time.Duration {
+	if r.LeaseRoundTo == 0 {
+		return defaultLeaseRoundTo
+	}
+	return r.LeaseRoundTo
+}
+
+// isAllowedKeyType validates if keys of the type can be requested, which all types can be on roles without
+// "allowed_key_types"
+func (r *roleEntry) isAllowedKeyType(keyType string) bool {
+	return len(r.AllowedKeyTypes) == 0 || sliceContains(r.AllowedKeyTypes, keyType)
+}
+
+// allowWildcardCertificates returns if wildcards can be requested, which roles allow unless told otherwise
+func (r *roleEntry) allowWildcardCertificates() bool {
+	return r.AllowWildcardCertificates == nil || *r.AllowWildcardCertificates
+}
+
+// requestOrigin returns the origin set on the requests of the role
+func (r *roleEntry) requestOrigin() string {
+	if origin := strings.TrimSpace(r.Origin); origin != "" {
+		return origin
+	}
+	return utilityName
+}
+
+// rateLimitMaxAttempts returns how many times a rate limited request is retried, with a default for the roles stored
+// before the option existed
+func (r *roleEntry) rateLimitMaxAttempts() int {
+	if r.RateLimitMaxAttempts == nil {
+		return defaultRateLimitMaxAttempts
+	}
+	return *r.RateLimitMaxAttempts
+}
+
+// rateLimitMaxWait returns the maximum wait before retrying a rate limited request, with a default for the roles stored
+// before the option existed
+func (r *roleEntry) rateLimitMaxWait() time.Duration {
+	if r.RateLimitMaxWait == 0 {
+		return defaultRateLimitMaxWait
+	}
+	return r.RateLimitMaxWait
+}
+
+// pollBackoffFactor returns the factor the wait between checks of a pending certificate grows by, with a default for
+// the roles stored before the option existed
+func (r *roleEntry) pollBackoffFactor() int {
+	if r.PollBackoffFactor == 0 {
+		return defaultPollBackoffFactor
+	}
+	return r.PollBackoffFactor
+}
+
+// pollBackoffMax returns the maximum wait between checks of a pending certificate, with a default for the roles stored
+// before the option existed
+func (r *roleEntry) pollBackoffMax() time.Duration {
+	if r.PollBackoffMax == 0 {
+		return defaultPollBackoffMax
+	}
+	return r.PollBackoffMax
+}
+
+// refetchMissingChain returns if a chain missing from a Venafi Cloud certificate is read in a second call, which roles
+// do unless told otherwise
+func (r *roleEntry) refetchMissingChain() bool {
+	return r.RefetchMissingChain == nil || *r.RefetchMissingChain
+}
+
+// returnPrivateKey returns if private keys are returned with the certificates, which roles do unless told otherwise
+func (r *roleEntry) returnPrivateKey() bool {
+	return r.ReturnPrivateKey == nil || *r.ReturnPrivateKey
 }
 
 func (r *roleEntry) ToResponseData() map[string]interface{} {
 	responseData := map[string]interface{}{
-		"venafi_secret":          r.VenafiSecret,
-		"role_zone":              r.Zone,
-		"store_by":               r.StoreBy,
-		"no_store":               r.NoStore,
-		"service_generated_cert": r.ServiceGenerated,
-		"store_pkey":             r.StorePrivateKey,
-		"ttl":                    int64(r.TTL.Seconds()),
-		"issuer_hint":            r.IssuerHint,
-		"max_ttl":                int64(r.MaxTTL.Seconds()),
-		"generate_lease":         r.GenerateLease,
-		"chain_option":           r.ChainOption,
+		"venafi_secret":               r.VenafiSecret,
+		"role_zone":                   r.Zone,
+		"store_by":                    r.StoreBy,
+		"no_store":                    r.NoStore,
+		"service_generated_cert":      r.ServiceGenerated,
+		"store_pkey":                  r.StorePrivateKey,
+		"ttl":                         int64(r.TTL.Seconds()),
+		"issuer_hint":                 r.IssuerHint,
+		"max_ttl":                     int64(r.MaxTTL.Seconds()),
+		"generate_lease":              r.GenerateLease,
+		"chain_option":                r.ChainOption,
+		"require_alt_names":           r.RequireAltNames,
+		"key_gen_concurrency":         r.KeyGenConcurrency,
+		"refetch_missing_chain":       r.refetchMissingChain(),
+		"cn_transform":                r.CNTransform,
+		"retryable_error_substrings":  r.RetryableErrorSubstrings,
+		"unique_cn":                   r.UniqueCN,
+		"round_validity_to":           int64(r.RoundValidityTo.Seconds()),
+		"renew_before":                r.renewBefore(),
+		"signature_algorithm":         r.SignatureAlgorithm,
+		"lease_max_ttl":               int64(r.LeaseMaxTTL.Seconds()),
+		"lease_default_ttl":           int64(r.LeaseDefaultTTL.Seconds()),
+		"lease_round_to":              int64(r.leaseRoundTo().Seconds()),
+		"additional_zones":            r.AdditionalZones,
+		"key_gen_timeout":             int64(r.keyGenTimeout().Seconds()),
+		"allowed_key_types":           r.AllowedKeyTypes,
+		"reset_abandoned_requests":    r.ResetAbandonedRequests,
+		"tag_requester":               r.TagRequester,
+		"requester_custom_field":      r.RequesterCustomField,
+		"revoke_on_lease_end":         r.RevokeOnLeaseEnd,
+		"revoke_by_dn":                r.RevokeByDN,
+		"bundle_order":                r.BundleOrder,
+		"cn_only_behavior":            r.CNOnlyBehavior,
+		"poll_backoff_base":           int64(r.PollBackoffBase.Seconds()),
+		"poll_backoff_factor":         r.pollBackoffFactor(),
+		"poll_backoff_max":            int64(r.pollBackoffMax().Seconds()),
+		"tag_origin":                  r.TagOrigin,
+		"origin_custom_field":         r.OriginCustomField,
+		"post_issuance_validators":    r.PostIssuanceValidators,
+		"retrieve_timeout":            int64(r.RetrieveTimeout.Seconds()),
+		"poll_interval":               int64(r.PollInterval.Seconds()),
+		"organization":                r.Organization,
+		"ou":                          r.OU,
+		"locality":                    r.Locality,
+		"province":                    r.Province,
+		"country":                     r.Country,
+		"allowed_domains":             r.AllowedDomains,
+		"allow_bare_domains":          r.AllowBareDomains,
+		"allow_subdomains":            r.AllowSubdomains,
+		"allow_glob_domains":          r.AllowGlobDomains,
+		"private_key_format":          r.PrivateKeyFormat,
+		"custom_fields":               r.CustomFields,
+		"csr_origin":                  r.CSROrigin,
+		"min_key_bits":                r.MinKeyBits,
+		"max_key_bits":                r.MaxKeyBits,
+		"require_cn":                  r.RequireCN,
+		"allow_wildcard_certificates": r.allowWildcardCertificates(),
+		"add_wildcard_apex":           r.AddWildcardApex,
+		"allowed_uri_sans":            r.AllowedURISANs,
+		"return_private_key":          r.returnPrivateKey(),
+		"work_to_do_timeout":          int64(r.WorkToDoTimeout.Seconds()),
+		"origin":                      r.requestOrigin(),
+		"verify_chain":                r.VerifyChain,
+		"rate_limit_max_attempts":     r.rateLimitMaxAttempts(),
+		"rate_limit_max_wait":         int64(r.rateLimitMaxWait().Seconds()),
 	}
 	return responseData
 }
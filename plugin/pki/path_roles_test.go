@@ -1,8 +1,11 @@
 package pki
 
 import (
+	"context"
 	"fmt"
+	"github.com/hashicorp/vault/sdk/logical"
 	"testing"
+	"time"
 )
 
 func TestRoleValidate(t *testing.T) {
@@ -98,6 +101,20 @@ func TestRoleValidate(t *testing.T) {
 		t.Fatalf("Expecting error %s but got %s", errorTextNoStoreAndStoreByConflict, err)
 	}
 
+	returnPrivateKey := false
+	for _, entry := range []*roleEntry{
+		{VenafiSecret: "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx", ReturnPrivateKey: &returnPrivateKey},
+		{VenafiSecret: "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx", ReturnPrivateKey: &returnPrivateKey, StorePrivateKey: true, NoStore: true},
+	} {
+		err = validateEntry(entry)
+		if err == nil {
+			t.Fatalf("Expecting error")
+		}
+		if err.Error() != errorTextReturnPrivateKeyNotStored {
+			t.Fatalf("Expecting error %s but got %s", errorTextReturnPrivateKeyNotStored, err)
+		}
+	}
+
 	entry = &roleEntry{
 		VenafiSecret: "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
 		StoreBy:      "sebial",
@@ -137,4 +154,162 @@ func TestRoleValidate(t *testing.T) {
 	if entry.StoreBy != storeByCNString {
 		t.Fatalf("Expecting store_by parameter will be set to %s", storeByCNString)
 	}
+
+	entry = &roleEntry{
+		VenafiSecret:    "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
+		RoundValidityTo: 30 * time.Minute,
+	}
+	err = validateEntry(entry)
+	if err == nil || err.Error() != errorTextRoundValidityToTooSmall {
+		t.Fatalf("Expecting error %s but got %v", errorTextRoundValidityToTooSmall, err)
+	}
+
+	entry = &roleEntry{
+		VenafiSecret:    "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
+		MaxTTL:          24 * time.Hour,
+		RoundValidityTo: 48 * time.Hour,
+	}
+	err = validateEntry(entry)
+	if err == nil || err.Error() != errorTextRoundValidityToExceedsMaxTTL {
+		t.Fatalf("Expecting error %s but got %v", errorTextRoundValidityToExceedsMaxTTL, err)
+	}
+
+	entry = &roleEntry{
+		VenafiSecret: "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
+		TagOrigin:    true,
+	}
+	err = validateEntry(entry)
+	if err == nil || err.Error() != errorTextTagOriginNoCustomField {
+		t.Fatalf("Expecting error %s but got %v", errorTextTagOriginNoCustomField, err)
+	}
+
+	entry = &roleEntry{
+		VenafiSecret: "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
+		TagRequester: true,
+	}
+	err = validateEntry(entry)
+	if err == nil || err.Error() != errorTextTagRequesterNoCustomField {
+		t.Fatalf("Expecting error %s but got %v", errorTextTagRequesterNoCustomField, err)
+	}
+
+	entry = &roleEntry{
+		VenafiSecret: "testSecret",
+		CustomFields: []string{"Cost Center"},
+	}
+	err = validateEntry(entry)
+	if err == nil || err.Error() != errorTextInvalidCustomFields {
+		t.Fatalf("Expecting error %s but got %v", errorTextInvalidCustomFields, err)
+	}
+
+	entry = &roleEntry{
+		VenafiSecret:     "testSecret",
+		PrivateKeyFormat: "der",
+	}
+	err = validateEntry(entry)
+	expectedError := fmt.Sprintf(errTextPrivateKeyFormatWrongOption, privateKeyFormatPKCS1, privateKeyFormatPKCS8, "der")
+	if err == nil || err.Error() != expectedError {
+		t.Fatalf("Expecting error %s but got %v", expectedError, err)
+	}
+
+	entry = &roleEntry{
+		VenafiSecret: "testSecret",
+		CSROrigin:    "vault",
+	}
+	err = validateEntry(entry)
+	expectedError = fmt.Sprintf(errTextCSROriginWrongOption, csrOriginLocal, csrOriginService, "vault")
+	if err == nil || err.Error() != expectedError {
+		t.Fatalf("Expecting error %s but got %v", expectedError, err)
+	}
+
+	entry = &roleEntry{
+		VenafiSecret:     "testSecret",
+		CSROrigin:        csrOriginLocal,
+		ServiceGenerated: true,
+	}
+	err = validateEntry(entry)
+	if err == nil || err.Error() != errorTextCSROriginConflict {
+		t.Fatalf("Expecting error %s but got %v", errorTextCSROriginConflict, err)
+	}
+
+	entry = &roleEntry{
+		VenafiSecret: "testSecret",
+		MinKeyBits:   4096,
+		MaxKeyBits:   2048,
+	}
+	err = validateEntry(entry)
+	if err == nil || err.Error() != errorTextKeyBitsRange {
+		t.Fatalf("Expecting error %s but got %v", errorTextKeyBitsRange, err)
+	}
+
+	entry = &roleEntry{
+		VenafiSecret: "testSecret",
+		KeyType:      "rsa",
+		MinKeyBits:   3072,
+	}
+	err = validateEntry(entry)
+	expectedError = fmt.Sprintf(errorTextRSAKeyBitsTooSmall, defaultKeySize, 3072)
+	if err == nil || err.Error() != expectedError {
+		t.Fatalf("Expecting error %s but got %v", expectedError, err)
+	}
+}
+
+func TestRoleNoStoreWarning(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	s := &logical.InmemStorage{}
+
+	resp, err := integrationTestEnv.Backend.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/no-store",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"venafi_secret": "fake",
+			"no_store":      true,
+			"store_pkey":    true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() || !sliceContains(resp.Warnings, `"store_pkey" is ignored as "no_store" is set, neither certificates nor private keys are stored`) {
+		t.Fatalf("Expecting a warning about store_pkey being ignored but got %#v", resp)
+	}
+}
+
+func TestRoleStoredBeforeOptions(t *testing.T) {
+	ctx := context.Background()
+	s := &logical.InmemStorage{}
+	//a role stored before refetch_missing_chain, the rate limit options and the poll backoff options existed
+	if err := s.Put(ctx, &logical.StorageEntry{Key: "role/upgraded", Value: []byte(`{"venafi_secret":"fake","zone":"zone"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := createBackendWithStorage(t)
+	role, err := b.getRole(ctx, s, "upgraded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !role.refetchMissingChain() {
+		t.Fatal("Expecting the missing chain to be refetched for a role stored before refetch_missing_chain")
+	}
+	if role.rateLimitMaxAttempts() != defaultRateLimitMaxAttempts {
+		t.Fatalf("Expecting %d attempts for a role stored before rate_limit_max_attempts but got %d", defaultRateLimitMaxAttempts, role.rateLimitMaxAttempts())
+	}
+	if role.rateLimitMaxWait() != defaultRateLimitMaxWait {
+		t.Fatalf("Expecting a maximum wait of %s for a role stored before rate_limit_max_wait but got %s", defaultRateLimitMaxWait, role.rateLimitMaxWait())
+	}
+	if role.pollBackoffFactor() != defaultPollBackoffFactor || role.pollBackoffMax() != defaultPollBackoffMax {
+		t.Fatalf("Expecting a backoff factor of %d up to %s for a role stored before the poll backoff options but got %d up to %s",
+			defaultPollBackoffFactor, defaultPollBackoffMax, role.pollBackoffFactor(), role.pollBackoffMax())
+	}
+	if delay := nextPollDelay(defaultPollBackoffBase, role); delay != defaultPollBackoffFactor*defaultPollBackoffBase {
+		t.Fatalf("Expecting the poll delay to back off for a role stored before the poll backoff options but got %s", delay)
+	}
+	data := role.ToResponseData()
+	if data["refetch_missing_chain"] != true || data["rate_limit_max_attempts"] != defaultRateLimitMaxAttempts ||
+		data["poll_backoff_factor"] != defaultPollBackoffFactor || data["poll_backoff_max"] != int64(defaultPollBackoffMax.Seconds()) {
+		t.Fatalf("Expecting the defaults to be read on the role but got %#v", data)
+	}
 }
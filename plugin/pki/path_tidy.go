@@ -0,0 +1,257 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"net/http"
+	"time"
+)
+
+const (
+	tidyStateRunning  = "running"
+	tidyStateFinished = "finished"
+	tidyStateError    = "error"
+)
+
+// tidyStatus reports the progress of the last tidy operation, which runs in the background
+type tidyStatus struct {
+	State          string
+	SafetyBuffer   time.Duration
+	TimeStarted    time.Time
+	TimeFinished   time.Time
+	CertsChecked   int
+	CertsDeleted   int
+	KeysDeleted    int
+	PickupsDeleted int
+	IndexDeleted   int
+	Err            error
+}
+
+func pathTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy$",
+		Fields: map[string]*framework.FieldSchema{
+			"safety_buffer": {
+				Type: framework.TypeDurationSecond,
+				Description: `The amount of extra time that must have passed beyond certificate expiration before it is removed
+from the backend storage. Defaults to 72 hours`,
+				Default: 259200, //72h
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathTidyWrite,
+		},
+
+		HelpSynopsis:    pathTidyHelpSyn,
+		HelpDescription: pathTidyHelpDesc,
+	}
+}
+
+func pathTidyStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy-status$",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathTidyStatusRead,
+		},
+
+		HelpSynopsis:    pathTidyStatusHelpSyn,
+		HelpDescription: pathTidyStatusHelpDesc,
+	}
+}
+
+func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	safetyBuffer := time.Duration(data.Get("safety_buffer").(int)) * time.Second
+	if safetyBuffer < 0 {
+		return logical.ErrorResponse("safety_buffer must be greater than or equal to zero"), nil
+	}
+
+	b.tidyLock.Lock()
+	defer b.tidyLock.Unlock()
+	if b.tidy != nil && b.tidy.State == tidyStateRunning {
+		resp := &logical.Response{}
+		resp.AddWarning("Tidy operation already in progress.")
+		return resp, nil
+	}
+	b.tidy = &tidyStatus{
+		State:        tidyStateRunning,
+		SafetyBuffer: safetyBuffer,
+		TimeStarted:  time.Now(),
+	}
+
+	//the request context is cancelled when the response is sent, so the tidy runs with its own
+	s := req.Storage
+	go func() {
+		checked, deleted, err := b.tidyCertStore(context.Background(), s, safetyBuffer)
+		var keysDeleted, pickupsDeleted, indexDeleted int
+		if err == nil {
+			keysDeleted, err = tidyPendingKeys(context.Background(), s)
+		}
+		if err == nil {
+			pickupsDeleted, err = tidyPickups(context.Background(), s)
+		}
+		if err == nil {
+			indexDeleted, err = tidyCNIndex(context.Background(), s)
+		}
+
+		b.tidyLock.Lock()
+		defer b.tidyLock.Unlock()
+		b.tidy.CertsChecked = checked
+		b.tidy.CertsDeleted = deleted
+		b.tidy.KeysDeleted = keysDeleted
+		b.tidy.PickupsDeleted = pickupsDeleted
+		b.tidy.IndexDeleted = indexDeleted
+		b.tidy.TimeFinished = time.Now()
+		if err != nil {
+			b.tidy.State = tidyStateError
+			b.tidy.Err = err
+			b.Logger().Error("Tidy operation failed", "error", err)
+			return
+		}
+		b.tidy.State = tidyStateFinished
+		b.Logger().Info(fmt.Sprintf("Tidy operation removed %d of %d stored certificates, %d expired CSR keys, %d expired pickups and %d stale common name index entries",
+			deleted, checked, keysDeleted, pickupsDeleted, indexDeleted))
+	}()
+
+	resp := &logical.Response{}
+	resp.AddWarning("Tidy operation successfully started. Any information from the operation will be printed to Vault's server logs and is available on tidy-status.")
+	return logical.RespondWithStatusCode(resp, req, http.StatusAccepted)
+}
+
+func (b *backend) pathTidyStatusRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.tidyLock.Lock()
+	defer b.tidyLock.Unlock()
+
+	if b.tidy == nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"state": "inactive",
+			},
+		}, nil
+	}
+
+	respData := map[string]interface{}{
+		"state":           b.tidy.State,
+		"safety_buffer":   int64(b.tidy.SafetyBuffer.Seconds()),
+		"time_started":    b.tidy.TimeStarted.Format(time.RFC3339),
+		"certs_checked":   b.tidy.CertsChecked,
+		"certs_deleted":   b.tidy.CertsDeleted,
+		"keys_deleted":    b.tidy.KeysDeleted,
+		"pickups_deleted": b.tidy.PickupsDeleted,
+		"index_deleted":   b.tidy.IndexDeleted,
+	}
+	if !b.tidy.TimeFinished.IsZero() {
+		respData["time_finished"] = b.tidy.TimeFinished.Format(time.RFC3339)
+	}
+	if b.tidy.Err != nil {
+		respData["error"] = b.tidy.Err.Error()
+	}
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+// tidyCertStore deletes the stored certificates that expired more than safetyBuffer ago. Entries whose certificate
+// can't be parsed have no expiration and are kept.
+func (b *backend) tidyCertStore(ctx context.Context, s logical.Storage, safetyBuffer time.Duration) (checked, deleted int, err error) {
+	keys, err := s.List(ctx, "certs/")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list stored certificates: %s", err)
+	}
+
+	for _, key := range keys {
+		cert, path, err := getStoredCert(ctx, s, key)
+		if err != nil {
+			return checked, deleted, err
+		}
+		if cert == nil {
+			continue
+		}
+		checked++
+		if cert.Expiration == 0 {
+			b.Logger().Warn(fmt.Sprintf("Keeping %s, its certificate can't be parsed", path))
+			continue
+		}
+		if time.Now().After(time.Unix(cert.Expiration, 0).Add(safetyBuffer)) {
+			if err := s.Delete(ctx, path); err != nil {
+				return checked, deleted, fmt.Errorf("failed to delete %s: %s", path, err)
+			}
+			if parsed := parsePEMCertificate(cert.Certificate); parsed != nil {
+				if err := unindexCertByCN(ctx, s, parsed); err != nil {
+					return checked, deleted, err
+				}
+			}
+			deleted++
+		}
+	}
+	return checked, deleted, nil
+}
+
+// tidyPendingKeys deletes the keys of CSRs generated with csr_only that expired before their CSR was signed
+func tidyPendingKeys(ctx context.Context, s logical.Storage) (deleted int, err error) {
+	keys, err := s.List(ctx, "csr-keys/")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list CSR keys: %s", err)
+	}
+
+	for _, key := range keys {
+		entry, err := s.Get(ctx, "csr-keys/"+key)
+		if err != nil {
+			return deleted, err
+		}
+		if entry == nil {
+			continue
+		}
+		var pending pendingKeyEntry
+		if err := entry.DecodeJSON(&pending); err != nil {
+			return deleted, err
+		}
+		if pending.expired() {
+			if err := s.Delete(ctx, "csr-keys/"+key); err != nil {
+				return deleted, fmt.Errorf("failed to delete CSR key %s: %s", key, err)
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// tidyPickups deletes the pending requests kept longer than pickupEntryTTL, which can no longer be picked up
+func tidyPickups(ctx context.Context, s logical.Storage) (deleted int, err error) {
+	keys, err := s.List(ctx, "pickups/")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pickups: %s", err)
+	}
+
+	for _, key := range keys {
+		pickup, err := getPickup(ctx, s, key)
+		if err != nil {
+			return deleted, err
+		}
+		if pickup == nil {
+			continue
+		}
+		if pickup.expired() {
+			if err := s.Delete(ctx, "pickups/"+key); err != nil {
+				return deleted, fmt.Errorf("failed to delete pickup %s: %s", key, err)
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+const (
+	pathTidyHelpSyn  = `Tidy up the backend by removing expired certificates from storage.`
+	pathTidyHelpDesc = `This endpoint allows expired certificates stored by the backend to be removed. They are deleted once the
+"safety_buffer" has passed since their expiration. The keys of CSRs generated with csr_only that were never signed, and
+the pending requests that were never picked up, are deleted once expired. The common name index used by unique_cn is
+built if it wasn't yet, and its entries whose certificate was deleted or replaced are removed. The operation runs in the
+background; its result is logged and can be read on tidy-status.`
+
+	pathTidyStatusHelpSyn  = `Returns the status of the tidy operation.`
+	pathTidyStatusHelpDesc = `This endpoint returns the state of the last tidy operation, when it started and finished, and how
+many stored certificates it checked and deleted, and how many expired CSR keys, pickups and stale common name index entries
+it deleted.`
+)
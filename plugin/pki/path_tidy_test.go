@@ -0,0 +1,106 @@
+package pki
+
+import (
+	"context"
+	"github.com/hashicorp/vault/sdk/logical"
+	"testing"
+	"time"
+)
+
+func TestTidyCertStore(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	s := &logical.InmemStorage{}
+
+	stored := map[string]int64{
+		"certs/expired.example.com":       time.Now().Add(-96 * time.Hour).Unix(),
+		"certs/within-buffer.example.com": time.Now().Add(-time.Hour).Unix(),
+		"certs/valid.example.com":         time.Now().Add(time.Hour).Unix(),
+		"certs/no-expiration.example.com": 0,
+	}
+	for key, expiration := range stored {
+		entry, err := logical.StorageEntryJSON(key, VenafiCert{Certificate: "not a certificate", Expiration: expiration})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checked, deleted, err := integrationTestEnv.Backend.(*backend).tidyCertStore(ctx, s, 72*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 4 || deleted != 1 {
+		t.Fatalf("Expecting 1 of 4 certificates deleted but got %d of %d", deleted, checked)
+	}
+	keys, err := s.List(ctx, "certs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if key == "expired.example.com" {
+			t.Fatalf("Expecting the expired certificate to be deleted")
+		}
+	}
+}
+
+func TestTidyPendingKeys(t *testing.T) {
+	ctx := context.Background()
+	s := &logical.InmemStorage{}
+
+	for key, createdAt := range map[string]time.Time{
+		"csr-keys/expired": time.Now().Add(-pendingKeyTTL - time.Hour),
+		"csr-keys/recent":  time.Now(),
+	} {
+		entry, err := logical.StorageEntryJSON(key, pendingKeyEntry{PrivateKey: "key", Role: "csr", CreatedAt: createdAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := tidyPendingKeys(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.List(ctx, "csr-keys/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 || len(keys) != 1 || keys[0] != "recent" {
+		t.Fatalf("Expecting only the expired key to be deleted but got %d deleted and %v kept", deleted, keys)
+	}
+}
+
+func TestTidyPickups(t *testing.T) {
+	ctx := context.Background()
+	s := &logical.InmemStorage{}
+
+	for _, pickup := range []*pickupEntry{
+		{PickupID: "expired", Role: "approved", RequestedAt: time.Now().Add(-pickupEntryTTL - time.Hour)},
+		{PickupID: "recent", Role: "approved", RequestedAt: time.Now()},
+	} {
+		if err := storePickup(ctx, s, pickup); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := tidyPickups(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.List(ctx, "pickups/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 || len(keys) != 1 || keys[0] != "recent" {
+		t.Fatalf("Expecting only the expired pickup to be deleted but got %d deleted and %v kept", deleted, keys)
+	}
+}
@@ -0,0 +1,195 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"strings"
+	"time"
+)
+
+const (
+	// CA certificates change rarely, so the chain read from Venafi is kept in memory for this long
+	caChainCacheTTL = 1 * time.Hour
+)
+
+type cachedCAChain struct {
+	chain     []string
+	expiresAt time.Time
+}
+
+func pathVenafiCA(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "ca(_chain)?/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: `The desired role with configuration for this request`,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathVenafiCARead,
+		},
+
+		HelpSynopsis:    pathVenafiCAHelpSyn,
+		HelpDescription: pathVenafiCAHelpDesc,
+	}
+}
+
+func (b *backend) pathVenafiCARead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, roleName)), nil
+	}
+
+	chain, ok := b.getCachedCAChain(roleName)
+	if !ok {
+		b.Logger().Debug(fmt.Sprintf("Reading CA chain for role %s from Venafi", roleName))
+		cl, timeout, err := b.ClientVenafi(ctx, req.Storage, data, req, roleName)
+		if err != nil {
+			return venafiErrorResponse(err, err.Error())
+		}
+
+		chain, err = fetchCAChain(cl, timeout)
+		if err != nil {
+			return venafiErrorResponse(err, err.Error())
+		}
+		b.setCachedCAChain(roleName, chain)
+	}
+
+	respData := map[string]interface{}{
+		"certificate_chain": strings.Join(chain, "\n"),
+	}
+	if len(chain) > 0 {
+		respData["issuing_ca"] = chain[0]
+	}
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+// fetchCAChain reads the issuing CA and root chain of the connector's zone. vcert has no call to read the zone CA
+// directly, so the chain of any certificate already issued in the zone is used, discarding the leaf.
+func fetchCAChain(cl endpoint.Connector, timeout time.Duration) ([]string, error) {
+	if cl.GetType() == endpoint.ConnectorTypeFake {
+		return []string{strings.TrimSpace(fake.CaCertPEM)}, nil
+	}
+
+	limit := 1
+	certs, err := cl.ListCertificates(endpoint.Filter{Limit: &limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificates in zone: %s", err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in zone to read the CA chain from")
+	}
+
+	pcc, err := cl.RetrieveCertificate(&certificate.Request{
+		Thumbprint:  certs[0].Thumbprint,
+		ChainOption: certificate.ChainOptionRootLast,
+		Timeout:     timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve CA chain: %s", err)
+	}
+	if len(pcc.Chain) == 0 {
+		return nil, fmt.Errorf("Venafi returned an empty CA chain")
+	}
+
+	return pcc.Chain, nil
+}
+
+// findIssuingCA returns the certificate of the chain that signed the leaf certificate, whatever order Venafi returned
+// the chain in. It falls back to the first certificate of the chain when none can be identified.
+func findIssuingCA(certPEM string, chain []string) string {
+	if len(chain) == 0 {
+		return ""
+	}
+
+	leaf := parsePEMCertificate(certPEM)
+	if leaf != nil {
+		for _, caPEM := range chain {
+			ca := parsePEMCertificate(caPEM)
+			if ca != nil && bytes.Equal(ca.RawSubject, leaf.RawIssuer) && leaf.CheckSignatureFrom(ca) == nil {
+				return caPEM
+			}
+		}
+	}
+	return chain[0]
+}
+
+// chainWithoutRoot removes the self-signed root CA certificate from the chain, keeping the order of the others
+func chainWithoutRoot(chain []string) []string {
+	var withoutRoot []string
+	for _, caPEM := range chain {
+		ca := parsePEMCertificate(caPEM)
+		if ca != nil && bytes.Equal(ca.RawSubject, ca.RawIssuer) && ca.CheckSignatureFrom(ca) == nil {
+			continue
+		}
+		withoutRoot = append(withoutRoot, caPEM)
+	}
+	return withoutRoot
+}
+
+func parsePEMCertificate(certPEM string) *x509.Certificate {
+	pemBlock, _ := pem.Decode([]byte(certPEM))
+	if pemBlock == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(pemBlock.Bytes)
+	if err != nil {
+		return nil
+	}
+	return cert
+}
+
+func (b *backend) getCachedCAChain(roleName string) ([]string, bool) {
+	b.caChainLock.Lock()
+	defer b.caChainLock.Unlock()
+
+	cached, ok := b.caChainCache[roleName]
+	if !ok || time.Now().After(cached.expiresAt) {
+		return nil, false
+	}
+	return cached.chain, true
+}
+
+func (b *backend) setCachedCAChain(roleName string, chain []string) {
+	b.caChainLock.Lock()
+	defer b.caChainLock.Unlock()
+
+	if b.caChainCache == nil {
+		b.caChainCache = make(map[string]cachedCAChain)
+	}
+	b.caChainCache[roleName] = cachedCAChain{chain: chain, expiresAt: time.Now().Add(caChainCacheTTL)}
+}
+
+// invalidateCAChain drops the cached chain of a role, so a changed zone or Venafi secret is picked up on the next read.
+// It's called when the role or its Venafi secret is written.
+func (b *backend) invalidateCAChain(roleName string) {
+	b.caChainLock.Lock()
+	defer b.caChainLock.Unlock()
+
+	delete(b.caChainCache, roleName)
+}
+
+const (
+	pathVenafiCAHelpSyn  = `Read the issuing CA and root chain of a role's zone.`
+	pathVenafiCAHelpDesc = `This path returns the CA chain used by the role's Venafi zone, without any leaf certificate or private key,
+so it can be distributed to clients that need to trust the issued certificates. It is also available on ca_chain/<role>.
+The chain is read from a certificate already issued in the zone, listed and retrieved from Venafi, and cached for an
+hour or until the role or its Venafi secret is written. A zone without any certificate has no chain to read.`
+)
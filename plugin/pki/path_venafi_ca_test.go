@@ -0,0 +1,77 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// issueTestCertificate creates a certificate signed by parent, or a self-signed one when parent is nil
+func issueTestCertificate(t *testing.T, serial int64, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (
+	string, *x509.Certificate, *ecdsa.PrivateKey) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), cert, key
+}
+
+func TestFindIssuingCA(t *testing.T) {
+	rootPEM, root, rootKey := issueTestCertificate(t, 1, "Test Root", true, nil, nil)
+	issuerPEM, issuer, issuerKey := issueTestCertificate(t, 2, "Test Issuing CA", true, root, rootKey)
+	leafPEM, _, _ := issueTestCertificate(t, 3, "leaf.example.com", false, issuer, issuerKey)
+
+	if ca := findIssuingCA(leafPEM, []string{issuerPEM, rootPEM}); ca != issuerPEM {
+		t.Fatalf("Expecting the issuing CA with the root last but got %s", ca)
+	}
+	if ca := findIssuingCA(leafPEM, []string{rootPEM, issuerPEM}); ca != issuerPEM {
+		t.Fatalf("Expecting the issuing CA with the root first but got %s", ca)
+	}
+	if ca := findIssuingCA(leafPEM, []string{rootPEM}); ca != rootPEM {
+		t.Fatalf("Expecting the first chain certificate when the issuer is missing but got %s", ca)
+	}
+	if ca := findIssuingCA(leafPEM, nil); ca != "" {
+		t.Fatalf("Expecting no issuing CA without a chain but got %s", ca)
+	}
+}
+
+func TestChainWithoutRoot(t *testing.T) {
+	rootPEM, root, rootKey := issueTestCertificate(t, 1, "Test Root", true, nil, nil)
+	issuerPEM, _, _ := issueTestCertificate(t, 2, "Test Issuing CA", true, root, rootKey)
+
+	for _, chain := range [][]string{{issuerPEM, rootPEM}, {rootPEM, issuerPEM}} {
+		withoutRoot := chainWithoutRoot(chain)
+		if len(withoutRoot) != 1 || withoutRoot[0] != issuerPEM {
+			t.Fatalf("Expecting only the issuing CA to be kept but got %d certificates", len(withoutRoot))
+		}
+	}
+	if withoutRoot := chainWithoutRoot([]string{issuerPEM}); len(withoutRoot) != 1 {
+		t.Fatalf("Expecting a chain without root to be kept")
+	}
+}
@@ -0,0 +1,173 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchConcurrency = 4
+	maxBatchConcurrency     = 16
+	maxBatchSize            = 100
+)
+
+func pathVenafiCertBatch(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issue-batch/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: `The desired role with configuration for the requests of the batch`,
+			},
+			"requests": {
+				Type: framework.TypeSlice,
+				Description: `List of certificate requests, each an object with the parameters of an issue request, e.g.
+{"common_name": "a.example.com", "alt_names": "b.example.com"}. Up to 100 requests`,
+			},
+			"concurrency": {
+				Type:        framework.TypeInt,
+				Description: `The maximum number of requests enrolled at the same time, up to 16. Defaults to 4`,
+				Default:     defaultBatchConcurrency,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathVenafiIssueBatch,
+		},
+
+		HelpSynopsis:    pathVenafiCertBatchHelpSyn,
+		HelpDescription: pathVenafiCertBatchHelpDesc,
+	}
+}
+
+// pathVenafiIssueBatch issues a certificate for every request of the batch with up to concurrency workers enrolling
+// requests at the same time. Each worker has its own Venafi client, reused for all of its requests, since the zone of
+// the client of a role with additional zones changes when a zone fails. A failed request doesn't fail the batch, its
+// error is returned in its result.
+func (b *backend) pathVenafiIssueBatch(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, roleName)), nil
+	}
+	if role.KeyType == "any" {
+		return logical.ErrorResponse("role key type \"any\" not allowed for issuing certificates, only signing"), nil
+	}
+
+	requests := data.Get("requests").([]interface{})
+	if len(requests) == 0 {
+		return logical.ErrorResponse(errorTextBatchEmpty), nil
+	}
+	if len(requests) > maxBatchSize {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextBatchTooLarge, len(requests), maxBatchSize)), nil
+	}
+	concurrency := data.Get("concurrency").(int)
+	if concurrency < 1 || concurrency > maxBatchConcurrency {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextBatchConcurrency, maxBatchConcurrency)), nil
+	}
+
+	results := make([]map[string]interface{}, len(requests))
+	items := make(map[int]*framework.FieldData, len(requests))
+	schema := pathVenafiCertEnroll(b).Fields
+	for i, request := range requests {
+		raw, ok := request.(map[string]interface{})
+		if !ok {
+			results[i] = map[string]interface{}{"error": fmt.Sprintf(errorTextBatchInvalidRequest, i)}
+			continue
+		}
+		itemRaw := make(map[string]interface{}, len(raw)+1)
+		for k, v := range raw {
+			itemRaw[k] = v
+		}
+		itemRaw["role"] = roleName
+		itemData := &framework.FieldData{Raw: itemRaw, Schema: schema}
+		if err := itemData.Validate(); err != nil {
+			results[i] = map[string]interface{}{"error": err.Error()}
+			continue
+		}
+		items[i] = itemData
+	}
+
+	workers := concurrency
+	if len(items) < workers {
+		workers = len(items)
+	}
+	jobs := make(chan int, len(items))
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+
+	//the clients are created before any request is enrolled, so a batch that can't connect to Venafi issues nothing
+	clients := make([]endpoint.Connector, workers)
+	timeouts := make([]time.Duration, workers)
+	for w := range clients {
+		clients[w], timeouts[w], err = b.ClientVenafi(ctx, req.Storage, data, req, roleName)
+		if err != nil {
+			return venafiErrorResponse(err, err.Error())
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := range clients {
+		wg.Add(1)
+		go func(cl endpoint.Connector, timeout time.Duration) {
+			defer wg.Done()
+			for i := range jobs {
+				resp, err := b.pathVenafiCertObtain(ctx, req, items[i], role, false, false, cl, timeout)
+				b.recordOutcome(roleName, resp, err)
+				results[i] = batchResult(items[i], resp, err)
+			}
+		}(clients[w], timeouts[w])
+	}
+	wg.Wait()
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"results": results,
+		},
+	}
+	if role.returnPrivateKey() {
+		resp.AddWarning(warningTextPrivateKeyACL)
+	}
+	return resp, nil
+}
+
+// batchResult is the result of a request of a batch: the response data with its warnings, or the error
+func batchResult(itemData *framework.FieldData, resp *logical.Response, err error) map[string]interface{} {
+	if err != nil {
+		return map[string]interface{}{"common_name": itemData.Get("common_name"), "error": err.Error()}
+	}
+	if resp == nil {
+		return map[string]interface{}{"common_name": itemData.Get("common_name"), "error": "no response"}
+	}
+	if resp.IsError() {
+		return map[string]interface{}{"common_name": itemData.Get("common_name"), "error": resp.Error().Error()}
+	}
+	result := resp.Data
+	if len(resp.Warnings) > 0 {
+		result["warnings"] = resp.Warnings
+	}
+	return result
+}
+
+const (
+	errorTextBatchEmpty          = `"requests" is empty`
+	errorTextBatchTooLarge       = `batch of %d requests is larger than the maximum of %d`
+	errorTextBatchConcurrency    = `"concurrency" must be between 1 and %d`
+	errorTextBatchInvalidRequest = `request %d is not an object with the parameters of an issue request`
+
+	pathVenafiCertBatchHelpSyn  = `Issue certificates for a batch of requests.`
+	pathVenafiCertBatchHelpDesc = `This path issues a certificate for every request of the batch, each with the parameters of an issue
+request, enrolling several requests at the same time with a connection to Venafi for each of them. The results are
+returned in the order of the requests; a request that fails has its error in its result instead of failing the batch. Leases are
+not generated for the certificates of a batch.`
+)
@@ -2,6 +2,7 @@ package pki
 
 import (
 	"context"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
@@ -11,6 +12,8 @@ import (
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/helper/consts"
 	"net"
+	"net/mail"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
@@ -34,15 +37,120 @@ func pathVenafiCertEnroll(b *backend) *framework.Path {
 			},
 			"alt_names": {
 				Type:        framework.TypeCommaStringSlice,
-				Description: "Alternative names for created certificate. Email and IP addresses can be specified too",
+				Description: "Alternative names for created certificate, comma separated or as a JSON array. Email and IP addresses can be specified too",
 			},
 			"ip_sans": {
 				Type:        framework.TypeCommaStringSlice,
 				Description: "The requested IP SANs, if any, in a comma-delimited list",
 			},
+			"email_sans": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "The requested email SANs, if any, in a comma-delimited list",
+			},
+			"uri_sans": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "The requested URI SANs, if any, in a comma-delimited list, e.g. a SPIFFE ID",
+			},
+			"exclude_cn_from_sans": {
+				Type:        framework.TypeBool,
+				Description: `If set, the common name is only in the subject and isn't added to the DNS SANs`,
+			},
+			"key_usage": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Key usages requested in the CSR: "digital_signature", "content_commitment", "key_encipherment",
+"data_encipherment", "key_agreement", "cert_sign", "crl_sign", "encipher_only" or "decipher_only". The zone policy and
+the CA decide if they are used. Needs a locally generated CSR`,
+			},
+			"ext_key_usage": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Extended key usages requested in the CSR: "server_auth", "client_auth", "code_signing",
+"email_protection", "time_stamping" or "ocsp_signing". The zone policy and the CA decide if they are used. Needs a
+locally generated CSR`,
+			},
 			"key_password": {
+				Type: framework.TypeString,
+				Description: `Password for encrypting private key. Encrypted keys are returned as PKCS#8, with PBES2 and AES-256,
+whatever the "private_key_format"`,
+			},
+			"private_key": {
+				Type: framework.TypeString,
+				Description: `An existing unencrypted PEM private key, RSA or EC, to request the certificate for instead of
+generating a new one. It must match the requested key type, size or curve`,
+			},
+			"key_type": {
+				Type: framework.TypeString,
+				Description: `The type of key to generate, "rsa" or "ec", overriding the role one. Only allowed when the role
+"key_type" is "any" or it has several "allowed_key_types"`,
+			},
+			"key_bits": {
+				Type:        framework.TypeInt,
+				Description: `The number of bits of RSA keys, overriding the role one. It must be within the role "min_key_bits" and "max_key_bits"`,
+			},
+			"key_curve": {
+				Type: framework.TypeString,
+				Description: `The curve of EC keys, overriding the role one: "P256", "P384" or "P521". Only allowed when the
+role "key_type" is "any" or it has several "allowed_key_types"`,
+			},
+			"organization": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Organization (O) of the certificate subject, overriding the role one. Use comma to separate multiple values",
+			},
+			"ou": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Organizational unit (OU) of the certificate subject, overriding the role one. Use comma to separate multiple values",
+			},
+			"locality": {
+				Type:        framework.TypeString,
+				Description: "Locality (L) of the certificate subject, overriding the role one",
+			},
+			"province": {
+				Type:        framework.TypeString,
+				Description: "Province or state (ST) of the certificate subject, overriding the role one",
+			},
+			"country": {
+				Type:        framework.TypeString,
+				Description: "Country (C) of the certificate subject, overriding the role one",
+			},
+			"private_key_format": {
+				Type:        framework.TypeString,
+				Description: `Format of the returned private key, overriding the role one. Can be "pkcs1" or "pkcs8"`,
+			},
+			"cn_transform_vars": {
+				Type: framework.TypeKVPairs,
+				Description: `Values for the variables used by the role cn_transform template, in format 'key=value'.
+They take precedence over the metadata of the requesting entity`,
+			},
+			"force": {
+				Type:        framework.TypeBool,
+				Description: `Issue the certificate even if the role has unique_cn set and a valid certificate with the same common name is already stored`,
+			},
+			"csr": {
+				Type: framework.TypeString,
+				Description: `An existing PEM-format CSR to request the certificate for, as on the sign path. It takes precedence over
+key generation: no key is generated and the key parameters are ignored with a warning`,
+			},
+			"csr_only": {
+				Type: framework.TypeBool,
+				Description: `Only generate the private key and a CSR following the zone policy, without requesting the certificate.
+The CSR can be submitted later on the sign path`,
+			},
+			"friendly_name": {
+				Type: framework.TypeString,
+				Description: `Name of the certificate object in the Venafi Platform policy folder, instead of the common name. Useful
+when several certificates share a common name. Ignored for Venafi Cloud`,
+			},
+			"instance": {
+				Type: framework.TypeString,
+				Description: `Device and application the certificate is installed on, in format 'device:application', e.g.
+"web01:nginx", so Trust Protection Platform can provision it. The application defaults to "Default". Ignored for Venafi Cloud`,
+			},
+			"tls_address": {
 				Type:        framework.TypeString,
-				Description: "Password for encrypting private key",
+				Description: `Address in format 'host:port' where the certificate of "instance" is served, used to validate it`,
+			},
+			"replace_instance": {
+				Type:        framework.TypeBool,
+				Description: `Replace the association of the certificate with "instance" if it already exists instead of failing`,
 			},
 			"custom_fields": {
 				Type:        framework.TypeCommaStringSlice,
@@ -53,6 +161,24 @@ func pathVenafiCertEnroll(b *backend) *framework.Path {
 				Description: `The requested Time To Live for the certificate; sets the expiration date.
 If not specified the role default is used. Cannot be larger than the role max TTL.`,
 			},
+			"format": {
+				Type:        framework.TypeString,
+				Description: `Format for returned data. Can be "pem", "der", "pem_bundle" or "kubernetes". With "der" the certificates and private key are base64 encoded DER. With "pem_bundle" the "bundle" field holds the certificate, chain and private key in a single PEM. With "kubernetes" the "tls.crt" and "tls.key" fields hold the certificate with its chain and the private key, base64 encoded as in a Kubernetes TLS secret`,
+				Default:     formatPEM,
+			},
+			"bundle_order": {
+				Type:        framework.TypeString,
+				Description: `Order of the PEM blocks in the "bundle" field, overriding the role one. Can be "key-cert-chain", "cert-chain-key" or "cert-key-chain"`,
+			},
+			"chain_option": {
+				Type:        framework.TypeString,
+				Description: `Order of the certificates in the chain, overriding the role one. Root can be "first" or "last"`,
+			},
+			"include_root": {
+				Type:        framework.TypeBool,
+				Description: `Include the root CA certificate in the returned chain. Some TLS servers reject chains that include it`,
+				Default:     true,
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
@@ -83,10 +209,45 @@ If not specified the role default is used. Cannot be larger than the role max TT
 				Type:        framework.TypeString,
 				Description: `The desired role with configuration for this request`,
 			},
+			"instance": {
+				Type: framework.TypeString,
+				Description: `Device and application the certificate is installed on, in format 'device:application', e.g.
+"web01:nginx", so Trust Protection Platform can provision it. The application defaults to "Default". Ignored for Venafi Cloud`,
+			},
+			"tls_address": {
+				Type:        framework.TypeString,
+				Description: `Address in format 'host:port' where the certificate of "instance" is served, used to validate it`,
+			},
+			"replace_instance": {
+				Type:        framework.TypeBool,
+				Description: `Replace the association of the certificate with "instance" if it already exists instead of failing`,
+			},
 			"custom_fields": {
 				Type:        framework.TypeCommaStringSlice,
 				Description: "Use to specify custom fields in format 'key=value'. Use comma to separate multiple values: 'key1=value1,key2=value2'",
 			},
+			"force": {
+				Type:        framework.TypeBool,
+				Description: `Issue the certificate even if the role has unique_cn set and a valid certificate with the same common name is already stored`,
+			},
+			"format": {
+				Type:        framework.TypeString,
+				Description: `Format for returned data. Can be "pem", "der", "pem_bundle" or "kubernetes". With "der" the certificates and private key are base64 encoded DER. With "pem_bundle" the "bundle" field holds the certificate, chain and private key in a single PEM. With "kubernetes" the "tls.crt" and "tls.key" fields hold the certificate with its chain and the private key, base64 encoded as in a Kubernetes TLS secret`,
+				Default:     formatPEM,
+			},
+			"bundle_order": {
+				Type:        framework.TypeString,
+				Description: `Order of the PEM blocks in the "bundle" field, overriding the role one. Can be "key-cert-chain", "cert-chain-key" or "cert-key-chain"`,
+			},
+			"chain_option": {
+				Type:        framework.TypeString,
+				Description: `Order of the certificates in the chain, overriding the role one. Root can be "first" or "last"`,
+			},
+			"include_root": {
+				Type:        framework.TypeBool,
+				Description: `Include the root CA certificate in the returned chain. Some TLS servers reject chains that include it`,
+				Default:     true,
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
@@ -109,14 +270,16 @@ func (b *backend) pathVenafiIssue(ctx context.Context, req *logical.Request, dat
 		return nil, err
 	}
 	if role == nil {
-		return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", roleName)), nil
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, roleName)), nil
 	}
 
-	if role.KeyType == "any" {
+	if role.KeyType == "any" && requestCSR(data) == "" {
 		return logical.ErrorResponse("role key type \"any\" not allowed for issuing certificates, only signing"), nil
 	}
 
-	return b.pathVenafiCertObtain(ctx, req, data, role, false)
+	resp, err := b.pathVenafiCertObtain(ctx, req, data, role, false, false, nil, 0)
+	b.recordOutcome(roleName, resp, err)
+	return resp, err
 }
 
 // pathSign issues a certificate from a submitted CSR, subject to role
@@ -130,19 +293,24 @@ func (b *backend) pathVenafiSign(ctx context.Context, req *logical.Request, data
 		return nil, err
 	}
 	if role == nil {
-		return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", roleName)), nil
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, roleName)), nil
 	}
 
-	return b.pathVenafiCertObtain(ctx, req, data, role, true)
+	resp, err := b.pathVenafiCertObtain(ctx, req, data, role, true, false, nil, 0)
+	b.recordOutcome(roleName, resp, err)
+	return resp, err
 }
 
-func (b *backend) pathVenafiCertObtain(ctx context.Context, req *logical.Request, data *framework.FieldData, role *roleEntry, signCSR bool) (
-	*logical.Response, error) {
+// pathVenafiCertObtain issues a certificate or signs a CSR for the role. A nil client means one is created for the
+// request, otherwise the given one is used with its server timeout, as for the requests of a batch. With validateOnly
+// the request is checked and built but not sent to Venafi.
+func (b *backend) pathVenafiCertObtain(ctx context.Context, req *logical.Request, data *framework.FieldData, role *roleEntry, signCSR bool,
+	validateOnly bool, cl endpoint.Connector, timeout time.Duration) (*logical.Response, error) {
 
 	// When utilizing performance standbys in Vault Enterprise, this forces the call to be redirected to the primary since
 	// a storage call is made after the API calls to issue the certificate.  This prevents the certificate from being
 	// issued twice in this scenario.
-	if !role.NoStore && b.System().ReplicationState().
+	if !validateOnly && !role.NoStore && b.System().ReplicationState().
 		HasState(consts.ReplicationPerformanceStandby|consts.ReplicationPerformanceSecondary) {
 		return nil, logical.ErrReadOnly
 	}
@@ -150,12 +318,27 @@ func (b *backend) pathVenafiCertObtain(ctx context.Context, req *logical.Request
 	b.Logger().Debug("Getting the role\n")
 	roleName := data.Get("role").(string)
 
-	b.Logger().Debug("Creating Venafi client:")
-	cl, timeout, err := b.ClientVenafi(ctx, req.Storage, data, req, roleName)
-	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+	//a CSR given to an issue request is signed instead of generating a key
+	var warnings []string
+	if !signCSR && requestCSR(data) != "" {
+		if data.Get("csr_only").(bool) {
+			return logical.ErrorResponse(errorTextCSRAndCSROnly), nil
+		}
+		if ignored := ignoredKeyFields(data); len(ignored) > 0 {
+			warnings = append(warnings, fmt.Sprintf(warningTextKeyFieldsIgnored, strings.Join(ignored, `", "`)))
+		}
+		signCSR = true
+	}
+
+	if !signCSR {
+		keyRole, err := requestKeyRole(role, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		role = keyRole
 	}
 
+	var err error
 	var certReq *certificate.Request
 	var reqData requestData
 
@@ -165,17 +348,38 @@ func (b *backend) pathVenafiCertObtain(ctx context.Context, req *logical.Request
 
 	commonNameRaw, ok := data.GetOk("common_name")
 	if ok {
-		reqData.commonName = commonNameRaw.(string)
+		reqData.commonName = strings.TrimSpace(commonNameRaw.(string))
+	}
+
+	altNames, ok := requestNames(data, "alt_names")
+	if ok {
+		reqData.altNames = altNames
+	}
+
+	ipSANs, ok := requestNames(data, "ip_sans")
+	if ok {
+		reqData.ipSANs = ipSANs
 	}
 
-	altNamesRaw, ok := data.GetOk("alt_names")
+	emailSANs, ok := requestNames(data, "email_sans")
 	if ok {
-		reqData.altNames = altNamesRaw.([]string)
+		reqData.emailSANs = emailSANs
 	}
 
-	ipSANsRaw, ok := data.GetOk("ip_sans")
+	uriSANsRaw, ok := data.GetOk("uri_sans")
 	if ok {
-		reqData.ipSANs = ipSANsRaw.([]string)
+		reqData.uriSANs = uriSANsRaw.([]string)
+	}
+
+	if excludeCNRaw, ok := data.GetOk("exclude_cn_from_sans"); ok {
+		reqData.omitCNFromSANs = excludeCNRaw.(bool)
+	}
+
+	if keyUsageRaw, ok := data.GetOk("key_usage"); ok {
+		reqData.keyUsages = keyUsageRaw.([]string)
+	}
+	if extKeyUsageRaw, ok := data.GetOk("ext_key_usage"); ok {
+		reqData.extKeyUsages = extKeyUsageRaw.([]string)
 	}
 
 	keyPasswordRaw, ok := data.GetOk("key_password")
@@ -183,14 +387,54 @@ func (b *backend) pathVenafiCertObtain(ctx context.Context, req *logical.Request
 		reqData.keyPassword = keyPasswordRaw.(string)
 	}
 
+	if privateKeyRaw, ok := data.GetOk("private_key"); ok {
+		reqData.privateKey = privateKeyRaw.(string)
+	}
+
+	if friendlyNameRaw, ok := data.GetOk("friendly_name"); ok {
+		reqData.friendlyName = strings.TrimSpace(friendlyNameRaw.(string))
+	}
+
+	if instanceRaw, ok := data.GetOk("instance"); ok {
+		reqData.instance = strings.TrimSpace(instanceRaw.(string))
+	}
+	if tlsAddressRaw, ok := data.GetOk("tls_address"); ok {
+		reqData.tlsAddress = strings.TrimSpace(tlsAddressRaw.(string))
+	}
+	if replaceInstanceRaw, ok := data.GetOk("replace_instance"); ok {
+		reqData.replaceInstance = replaceInstanceRaw.(bool)
+	}
+
 	csrStringRaw, ok := data.GetOk("csr")
 	if ok {
 		reqData.csrString = csrStringRaw.(string)
 	}
 
+	reqData.customFields = role.CustomFields
 	customFields, ok := data.GetOk("custom_fields")
 	if ok {
-		reqData.customFields = customFields.([]string)
+		reqData.customFields = mergeCustomFields(role.CustomFields, customFields.([]string))
+	}
+
+	reqData.organization = role.Organization
+	if organizationRaw, ok := data.GetOk("organization"); ok {
+		reqData.organization = organizationRaw.([]string)
+	}
+	reqData.ou = role.OU
+	if ouRaw, ok := data.GetOk("ou"); ok {
+		reqData.ou = ouRaw.([]string)
+	}
+	reqData.locality = role.Locality
+	if localityRaw, ok := data.GetOk("locality"); ok {
+		reqData.locality = localityRaw.(string)
+	}
+	reqData.province = role.Province
+	if provinceRaw, ok := data.GetOk("province"); ok {
+		reqData.province = provinceRaw.(string)
+	}
+	reqData.country = role.Country
+	if countryRaw, ok := data.GetOk("country"); ok {
+		reqData.country = countryRaw.(string)
 	}
 
 	if ttl, ok := data.GetOk("ttl"); ok {
@@ -208,142 +452,429 @@ func (b *backend) pathVenafiCertObtain(ctx context.Context, req *logical.Request
 
 	}
 
-	certReq, err = formRequest(reqData, role, signCSR, b.Logger())
-	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+	if role.TagOrigin {
+		reqData.mountOrigin = mountOrigin(req)
+	}
+	if role.TagRequester {
+		reqData.requester = requesterTag(req)
 	}
 
-	b.Logger().Debug("Making certificate request")
-	err = cl.GenerateRequest(nil, certReq)
-	if (err != nil) && (cl.GetType() == endpoint.ConnectorTypeTPP) {
-		msg := err.Error()
+	format := data.Get("format").(string)
+	if format != formatPEM && format != formatDER && format != formatPEMBundle && format != formatKubernetes {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextInvalidFormat, format)), nil
+	}
+	if chainOptionRaw, ok := data.GetOk("chain_option"); ok {
+		reqData.chainOption = chainOptionRaw.(string)
+	}
+	includeRoot := data.Get("include_root").(bool)
+
+	bundleOrder := role.BundleOrder
+	if bundleOrderRaw, ok := data.GetOk("bundle_order"); ok {
+		bundleOrder = bundleOrderRaw.(string)
+	}
+	if bundleOrder != "" && !isValidBundleOrder(bundleOrder) {
+		return logical.ErrorResponse(fmt.Sprintf(errTextBundleOrderWrongOption, bundleOrderKeyCertChain, bundleOrderCertChainKey, bundleOrderCertKeyChain, bundleOrder)), nil
+	}
+
+	privateKeyFormat := role.PrivateKeyFormat
+	if privateKeyFormatRaw, ok := data.GetOk("private_key_format"); ok {
+		privateKeyFormat = privateKeyFormatRaw.(string)
+	}
+	if !isValidPrivateKeyFormat(privateKeyFormat) {
+		return logical.ErrorResponse(fmt.Sprintf(errTextPrivateKeyFormatWrongOption, privateKeyFormatPKCS1, privateKeyFormatPKCS8, privateKeyFormat)), nil
+	}
+	if format == formatKubernetes && reqData.keyPassword != "" {
+		return logical.ErrorResponse(errorTextKubernetesKeyPassword), nil
+	}
 
-		//catch the scenario when token is expired and deleted.
-		var regex = regexp.MustCompile("(expired|invalid)_token")
+	//requests without names are refused before connecting to Venafi
+	if !signCSR {
+		if err := validateDomainsSpecified(reqData); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	if !signCSR && role.RequireCN && reqData.commonName == "" {
+		return logical.ErrorResponse(errorTextRequireCN), nil
+	}
 
-		//validate if the error is related to a expired access token, at this moment the only way can validate this is using the error message
-		//and verify if that message describes errors related to expired access token.
-		code := getStatusCode(msg)
-		if code == HTTP_UNAUTHORIZED && regex.MatchString(msg){
-			cfg, err := b.getConfig(ctx, req, roleName, true)
+	var originalCommonName string
+	if role.CNTransform != "" && !signCSR {
+		originalCommonName = reqData.commonName
+		if originalCommonName == "" && len(reqData.altNames) > 0 && !role.RequireCN {
+			originalCommonName = reqData.altNames[0]
+		}
 
+		vars := map[string]string{}
+		if req.EntityID != "" {
+			entity, err := b.System().EntityInfo(req.EntityID)
 			if err != nil {
-				return logical.ErrorResponse(err.Error()), nil
+				return nil, err
 			}
-
-			if cfg.Credentials.RefreshToken != "" {
-				err = updateAccessToken(cfg, b, ctx, req, roleName)
-
-				if err != nil {
-					return logical.ErrorResponse(err.Error()), nil
+			if entity != nil {
+				for k, v := range entity.Metadata {
+					vars[k] = v
 				}
+			}
+		}
+		if varsRaw, ok := data.GetOk("cn_transform_vars"); ok {
+			for k, v := range varsRaw.(map[string]string) {
+				vars[k] = v
+			}
+		}
 
-				//everything went fine so get the new client with the new refreshed access token
-				cl, timeout, err = b.ClientVenafi(ctx, req.Storage, data, req, roleName)
-				if err != nil {
-					return logical.ErrorResponse(err.Error()), nil
-				}
+		reqData.commonName, err = transformCommonName(role.CNTransform, originalCommonName, vars)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		b.Logger().Debug(fmt.Sprintf("Common name %s transformed to %s", originalCommonName, reqData.commonName))
+	}
 
-				b.Logger().Debug("Making certificate request again")
+	if cl == nil {
+		b.Logger().Debug("Creating Venafi client:")
+		cl, timeout, err = b.ClientVenafi(ctx, req.Storage, data, req, roleName)
+		if err != nil {
+			return venafiErrorResponse(err, err.Error())
+		}
+	}
 
-				err = cl.GenerateRequest(nil, certReq)
-				if err != nil {
-					return logical.ErrorResponse(err.Error()), nil
-				}
-			} else {
-				return logical.ErrorResponse("Tried to get new access token, but refresh token is empty"), nil
+	//vcert drops the custom fields Venafi doesn't know, so a tag that would be lost is refused instead
+	if role.TagOrigin {
+		if err := b.checkCustomField(ctx, req, roleName, clientZone(cl), cl.GetType(), "origin_custom_field", role.OriginCustomField); err != nil {
+			return venafiErrorResponse(err, err.Error())
+		}
+	}
+	if role.TagRequester {
+		if err := b.checkCustomField(ctx, req, roleName, clientZone(cl), cl.GetType(), "requester_custom_field", role.RequesterCustomField); err != nil {
+			return venafiErrorResponse(err, err.Error())
+		}
+	}
+
+	var zoneConfig *endpoint.ZoneConfiguration
+	if !signCSR && (role.CNOnlyBehavior == cnOnlyBehaviorPromote || role.CNOnlyBehavior == cnOnlyBehaviorFail) &&
+		reqData.commonName != "" && !hasDNSAltName(reqData.altNames) {
+		err = b.withZoneFailover(roleName, &cl, func() (err error) {
+			zoneConfig, err = cl.ReadZoneConfiguration()
+			return err
+		})
+		if err != nil {
+			return venafiErrorResponse(err, fmt.Sprintf("failed to read zone configuration: %s", err))
+		}
+		if zoneAllowsDNSSANs(zoneConfig) {
+			if role.CNOnlyBehavior == cnOnlyBehaviorFail && !zoneAllowsDNSSAN(zoneConfig, reqData.commonName) {
+				return logical.ErrorResponse(fmt.Sprintf(errorTextZoneRejectsCNAsDNSSAN, reqData.commonName)), nil
 			}
+			b.Logger().Debug(fmt.Sprintf("Zone allows DNS SANs, promoting CN %s to SAN", reqData.commonName))
 		} else {
+			b.Logger().Debug(fmt.Sprintf("Zone doesn't take DNS SANs, not adding CN %s to SAN", reqData.commonName))
+			reqData.omitCNFromSANs = true
+		}
+	}
+
+	certReq, err = formRequest(reqData, role, signCSR, b.Logger())
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if cnAddedToSANs(reqData, signCSR) {
+		warnings = append(warnings, fmt.Sprintf("The common name %s was added to the DNS SANs.", reqData.commonName))
+	}
+	if !signCSR && certReq.Subject.CommonName != strings.ToLower(certReq.Subject.CommonName) &&
+		sliceContains(certReq.DNSNames, strings.ToLower(certReq.Subject.CommonName)) {
+		warnings = append(warnings, fmt.Sprintf("The common name %s differs in case from its DNS SAN %s.",
+			certReq.Subject.CommonName, strings.ToLower(certReq.Subject.CommonName)))
+	}
+
+	if role.UniqueCN && !data.Get("force").(bool) {
+		existing, err := findValidCertByCN(ctx, req.Storage, requestCommonName(certReq))
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			existingSerial, err := certSerialNumber(existing)
+			if err != nil {
+				return nil, err
+			}
+			return logical.ErrorResponse(fmt.Sprintf(errorTextUniqueCN, existing.Subject.CommonName, existingSerial, existing.NotAfter.Format(time.RFC3339))), nil
+		}
+	}
+
+	csrOnly := false
+	if csrOnlyRaw, ok := data.GetOk("csr_only"); ok {
+		csrOnly = csrOnlyRaw.(bool)
+	}
+	if (csrOnly || validateOnly) && certReq.CsrOrigin == certificate.ServiceGeneratedCSR {
+		b.Logger().Debug("Generating the CSR locally for a request not sent to Venafi")
+		certReq.CsrOrigin = certificate.LocalGeneratedCSR
+	}
+
+	//the role asks for keys that never exist outside Venafi, so they aren't generated locally instead
+	if certReq.CsrOrigin == certificate.ServiceGeneratedCSR && cl.GetType() == endpoint.ConnectorTypeCloud {
+		return logical.ErrorResponse(errorTextServiceGeneratedCloud), nil
+	}
+
+	if zoneConfig == nil {
+		b.Logger().Debug("Reading zone configuration")
+		err = b.withZoneFailover(roleName, &cl, func() error {
+			return b.withReauthentication(ctx, req, data, roleName, &cl, func(cl endpoint.Connector) (err error) {
+				zoneConfig, err = cl.ReadZoneConfiguration()
+				return err
+			})
+		})
+		if err != nil {
+			return venafiErrorResponse(err, fmt.Sprintf("failed to read zone configuration: %s", err))
+		}
+	}
+
+	//the zone policy defaults and key constraints are applied before the key is generated, so the CSR complies with them
+	zoneConfig.UpdateCertificateRequest(certReq)
+
+	err = b.generatePrivateKey(ctx, roleName, role, certReq)
+	if err != nil {
+		return venafiErrorResponse(err, err.Error())
+	}
+
+	b.Logger().Debug("Making certificate request")
+	err = cl.GenerateRequest(zoneConfig, certReq)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if certReq.CsrOrigin == certificate.LocalGeneratedCSR && role.SignatureAlgorithm != "" {
+		if err := signCSRWithAlgorithm(certReq, role.SignatureAlgorithm); err != nil {
 			return logical.ErrorResponse(err.Error()), nil
 		}
 	}
 
+	if validateOnly {
+		if err := zoneConfig.ValidateCertificateRequest(certReq); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		return validationResponse(certReq, warnings), nil
+	}
+
+	if csrOnly {
+		return b.csrOnlyResponse(ctx, req.Storage, roleName, role, certReq, reqData.keyPassword, privateKeyFormat)
+	}
+
 	b.Logger().Debug("Running enroll request")
 
-	requestID, err := cl.RequestCertificate(certReq)
+	requestedAt := time.Now()
+	var requestID string
+	err = b.withZoneFailover(roleName, &cl, func() error {
+		return b.withReauthentication(ctx, req, data, roleName, &cl, func(cl endpoint.Connector) error {
+			return b.retryOnTransientError(ctx, role, "Certificate request", func() (err error) {
+				return b.withRequestSlot(ctx, func() (err error) {
+					requestID, err = cl.RequestCertificate(certReq)
+					return err
+				})
+			})
+		})
+	})
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		//the object name may already be taken in the policy folder, so the error names it
+		if certReq.FriendlyName != "" {
+			return venafiErrorResponse(err, fmt.Sprintf(errorTextFriendlyNameRequest, certReq.FriendlyName, err))
+		}
+		return venafiErrorResponse(err, err.Error())
 	}
 
 	pickupReq := &certificate.Request{
-		PickupID: requestID,
-		Timeout:  timeout,
+		PickupID:    requestID,
+		ChainOption: certReq.ChainOption,
+		Timeout:     timeout,
+	}
+	//the private key generated by Venafi can only be retrieved protected by a password, a random one is used and the key
+	//is decrypted afterwards so it's handled the same way as a locally generated key
+	var serviceKeyPassword string
+	if certReq.CsrOrigin == certificate.ServiceGeneratedCSR {
+		serviceKeyPassword, err = generateKeyPassword()
+		if err != nil {
+			return nil, err
+		}
+		pickupReq.CsrOrigin = certificate.ServiceGeneratedCSR
+		pickupReq.FetchPrivateKey = true
+		pickupReq.KeyPassword = serviceKeyPassword
 	}
-	pcc, err := cl.RetrieveCertificate(pickupReq)
+	var pcc *certificate.PEMCollection
+	retrievalStart := time.Now()
+	err = b.withReauthentication(ctx, req, data, roleName, &cl, func(cl endpoint.Connector) error {
+		return b.retryOnTransientError(ctx, role, "Certificate retrieval", func() (err error) {
+			pcc, err = b.retrieveCertificate(ctx, cl, roleName, role, pickupReq, timeout)
+			return err
+		})
+	})
+	b.recordRetrieval(roleName, retrievalStart)
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		if isPickupPending(err) {
+			b.recordPending(roleName)
+		}
+		//a request given up on is left pending on Venafi Platform unless the role asks to reset it, in which case it
+		//can't be picked up later
+		reset := false
+		if isPickupPending(err) || ctx.Err() != nil {
+			reset = b.resetAbandonedRequest(req, roleName, role, cl.GetType(), requestID)
+		}
+		if reset {
+			err = fmt.Errorf(errorTextRequestReset, requestID, err)
+		}
+		//keep the pickup ID so the progress of the request can be followed on pickup/<role>/<id>/status, along with the
+		//key so the certificate can be retrieved later on pickup/<role>/<id>
+		if isPickupPending(err) && !reset && !role.NoStore {
+			pickup := &pickupEntry{
+				PickupID:          requestID,
+				Role:              roleName,
+				CommonName:        requestCommonName(certReq),
+				RequestedAt:       requestedAt,
+				RequestedBy:       requestedBy(req),
+				RequestedByEntity: req.EntityID,
+				PrivateKeyFormat:  privateKeyFormat,
+			}
+			//the key of the request is only kept by roles that store private keys
+			var storeErr error
+			if role.StorePrivateKey {
+				pickup.ServiceKeyPassword = serviceKeyPassword
+				if certReq.CsrOrigin == certificate.LocalGeneratedCSR && certReq.PrivateKey != nil {
+					pickup.PrivateKey, storeErr = encodePKCS8PrivateKey(certReq.PrivateKey, "")
+				}
+			}
+			if storeErr == nil {
+				storeErr = storePickup(ctx, req.Storage, pickup)
+			}
+			if storeErr != nil {
+				b.Logger().Error("Error putting pickup entry to storage: " + storeErr.Error())
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return venafiErrorResponse(err, err.Error())
 	}
 
-	pemBlock, _ := pem.Decode([]byte(pcc.Certificate))
-	parsedCertificate, err := x509.ParseCertificate(pemBlock.Bytes)
+	//Venafi Cloud may return only the leaf certificate on the first retrieval, so the chain is requested again
+	if len(pcc.Chain) == 0 && cl.GetType() == endpoint.ConnectorTypeCloud && role.refetchMissingChain() {
+		b.Logger().Debug("Certificate chain is missing, retrieving certificate again")
+		var chainPcc *certificate.PEMCollection
+		err = b.retryOnTransientError(ctx, role, "Certificate chain retrieval", func() (err error) {
+			return b.withRequestSlot(ctx, func() (err error) {
+				chainPcc, err = cl.RetrieveCertificate(pickupReq)
+				return err
+			})
+		})
+		if err != nil {
+			b.Logger().Error("Error retrieving certificate chain: " + err.Error())
+		} else if len(chainPcc.Chain) > 0 {
+			pcc.Chain = chainPcc.Chain
+			warnings = append(warnings, "The certificate chain was not returned by Venafi Cloud with the certificate and had to be retrieved in a second call.")
+		}
+	}
+
+	parsedCertificate, err := parseIssuedCertificate(pcc.Certificate)
 	if err != nil {
-		return nil, err
+		b.Logger().Error(err.Error())
+		return logical.ErrorResponse(err.Error()), nil
 	}
-	serialNumber, err := getHexFormatted(parsedCertificate.SerialNumber.Bytes(), ":")
+	serialNumber, err := certSerialNumber(parsedCertificate)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := validateIssuedCertificate(role.PostIssuanceValidators, parsedCertificate, pcc.Chain); err != nil {
+		b.Logger().Error(fmt.Sprintf("Certificate %s was issued but not returned: %s", serialNumber, err))
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if role.VerifyChain == verifyChainWarn || role.VerifyChain == verifyChainError {
+		problems := verifyIssuedChain(parsedCertificate, pcc.Chain, requestCommonName(certReq), requestDNSNames(certReq))
+		if len(problems) > 0 && role.VerifyChain == verifyChainError {
+			b.Logger().Error(fmt.Sprintf("Certificate %s was issued but not returned: %s", serialNumber, problems[0]))
+			return logical.ErrorResponse(fmt.Sprintf(errorTextChainVerification, problems[0])), nil
+		}
+		for _, problem := range problems {
+			warnings = append(warnings, fmt.Sprintf(errorTextChainVerification, problem))
+		}
+	}
+	if !includeRoot {
+		pcc.Chain = chainWithoutRoot(pcc.Chain)
+	}
+	warnings = append(warnings, sanChangeWarnings(certReq, parsedCertificate)...)
+
+	certDN := certificateDN(cl.GetType(), requestID)
+
 	var entry *logical.StorageEntry
 	chain := strings.Join(append([]string{pcc.Certificate}, pcc.Chain...), "\n")
-	b.Logger().Debug("cert Chain: " + strings.Join(pcc.Chain, ", "))
+	//only identifiers are logged, the certificate and key material never are
+	b.Logger().Debug(fmt.Sprintf("Certificate %s issued with %d chain certificates", serialNumber, len(pcc.Chain)))
 
+	var keyType string
 	if !signCSR {
-		err = pcc.AddPrivateKey(certReq.PrivateKey, []byte(data.Get("key_password").(string)))
+		privateKey := certReq.PrivateKey
+		if pcc.PrivateKey != "" {
+			b.Logger().Debug("Using private key generated by Venafi")
+			privateKey, err = parsePrivateKeyPEM(pcc.PrivateKey, serviceKeyPassword)
+			if err != nil {
+				return nil, err
+			}
+			pcc.PrivateKey = ""
+		}
+		if privateKey == nil {
+			return logical.ErrorResponse("private key was not returned by Venafi"), nil
+		}
+		keyType = privateKeyType(privateKey)
+		pcc.PrivateKey, err = encodePrivateKey(privateKey, privateKeyFormat, reqData.keyPassword)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	expirationTime := parsedCertificate.NotAfter
+	expirationSec := expirationTime.Unix()
+
+	var storedPrivateKey string
 	if role.StorePrivateKey && !signCSR {
-		entry, err = logical.StorageEntryJSON("", VenafiCert{
-			Certificate:      pcc.Certificate,
-			CertificateChain: chain,
-			PrivateKey:       pcc.PrivateKey,
-			SerialNumber:     serialNumber,
-		})
-	} else {
-		entry, err = logical.StorageEntryJSON("", VenafiCert{
-			Certificate:      pcc.Certificate,
-			CertificateChain: chain,
-			SerialNumber:     serialNumber,
-		})
+		storedPrivateKey = pcc.PrivateKey
+	} else if role.StorePrivateKey {
+		//the key of a CSR generated with csr_only is kept until the CSR is signed
+		storedPrivateKey, err = takePendingKey(ctx, req.Storage, roleName, certReq.GetCSR())
+		if err != nil {
+			return nil, err
+		}
 	}
+	thumbprint, err := certificateThumbprint(pcc.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	entry, err = logical.StorageEntryJSON("", VenafiCert{
+		Certificate:       pcc.Certificate,
+		CertificateChain:  chain,
+		PrivateKey:        storedPrivateKey,
+		SerialNumber:      serialNumber,
+		CertificateDN:     certDN,
+		Thumbprint:        thumbprint,
+		PickupID:          requestID,
+		Expiration:        expirationSec,
+		Role:              roleName,
+		IssuedAt:          time.Now().Unix(),
+		RequestedBy:       requestedBy(req),
+		RequestedByEntity: req.EntityID,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	//if no_store is not specified
 	if !role.NoStore {
-		if role.StoreBy == storeByCNString {
-			//Writing certificate to the storage with CN
-			b.Logger().Debug("Writing certificate to the certs/" + reqData.commonName)
-			entry.Key = "certs/" + reqData.commonName
-
-			if err := req.Storage.Put(ctx, entry); err != nil {
-				b.Logger().Error("Error putting entry to storage: " + err.Error())
-				return nil, err
-			}
-		} else {
-			//Writing certificate to the storage with Serial Number
-			b.Logger().Debug("Putting certificate to the certs: " + normalizeSerial(serialNumber))
-			entry.Key = "certs/" + normalizeSerial(serialNumber)
+		//Writing certificate to the storage with CN or Serial Number
+		entry.Key = certStoragePath(role.StoreBy, reqData.commonName, serialNumber)
+		b.Logger().Debug("Writing certificate to " + entry.Key)
 
-			if err := req.Storage.Put(ctx, entry); err != nil {
-				b.Logger().Error("Error putting entry to storage: " + err.Error())
-				return nil, err
-			}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			b.Logger().Error("Error putting entry to storage: " + err.Error())
+			return nil, err
+		}
+		if err := indexCertByCN(ctx, req.Storage, parsedCertificate, entry.Key); err != nil {
+			return nil, err
 		}
-
-	}
-
-	issuingCA := ""
-	if len(pcc.Chain) > 0 {
-		issuingCA = pcc.Chain[0]
 	}
 
-	expirationTime := parsedCertificate.NotAfter
-	expirationSec := expirationTime.Unix()
+	issuingCA := findIssuingCA(pcc.Certificate, pcc.Chain)
 
 	respData := map[string]interface{}{
 		"common_name":       reqData.commonName,
@@ -354,8 +885,48 @@ func (b *backend) pathVenafiCertObtain(ctx context.Context, req *logical.Request
 		"issuing_ca":        issuingCA,
 		"expiration":        expirationSec,
 	}
-	if !signCSR {
+	addRenewAfter(respData, parsedCertificate, role)
+	returnPrivateKey := !signCSR && role.returnPrivateKey()
+	if returnPrivateKey {
 		respData["private_key"] = pcc.PrivateKey
+		respData["private_key_type"] = keyType
+	}
+	if certDN != "" {
+		respData["certificate_dn"] = certDN
+	}
+	respData["pickup_id"] = requestID
+	if by := requestedBy(req); by != "" {
+		respData["requested_by"] = by
+	}
+	if req.EntityID != "" {
+		respData["requested_by_entity"] = req.EntityID
+	}
+	if format == formatPEMBundle {
+		var bundlePrivateKey string
+		if returnPrivateKey {
+			bundlePrivateKey = pcc.PrivateKey
+		}
+		respData["bundle"], err = pemBundle(bundleOrder, pcc.Certificate, pcc.Chain, bundlePrivateKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if format == formatKubernetes {
+		var secretPrivateKey string
+		if returnPrivateKey {
+			secretPrivateKey = pcc.PrivateKey
+		}
+		for k, v := range kubernetesTLSData(pcc.Certificate, pcc.Chain, secretPrivateKey) {
+			respData[k] = v
+		}
+	}
+	if format == formatDER {
+		if err := derResponseData(respData); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	if originalCommonName != "" {
+		respData["original_common_name"] = originalCommonName
 	}
 
 	var logResp *logical.Response
@@ -369,71 +940,241 @@ func (b *backend) pathVenafiCertObtain(ctx context.Context, req *logical.Request
 	default:
 		logResp = b.Secret(SecretCertsType).Response(
 			respData,
-			map[string]interface{}{
-				"serial_number": serialNumber,
-			})
-		TTL := time.Until(parsedCertificate.NotAfter)
+			secretCertsInternalData(roleName, serialNumber, certDN, thumbprint, requestID, entry.Key, parsedCertificate.NotAfter))
+		TTL, warning := b.certLeaseTTL(role, parsedCertificate.NotAfter, serialNumber)
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
 		b.Logger().Debug("Setting up secret lease duration to: " + TTL.String())
 		logResp.Secret.TTL = TTL
 	}
 
-	if !signCSR {
-		logResp.AddWarning("Read access to this endpoint should be controlled via ACLs as it will return the connection private key as it is.")
+	for _, warning := range warnings {
+		logResp.AddWarning(warning)
+	}
+
+	if returnPrivateKey {
+		logResp.AddWarning(warningTextPrivateKeyACL)
 	}
 	return logResp, nil
 }
 
+// applyRoleKeyParams sets the type and size of the key generated for the request from the role
+func applyRoleKeyParams(certReq *certificate.Request, role *roleEntry) error {
+	if role.KeyType == "rsa" {
+		certReq.KeyType = certificate.KeyTypeRSA
+		certReq.KeyLength = role.KeyBits
+		if certReq.KeyLength == 0 {
+			certReq.KeyLength = defaultKeySize
+		}
+	} else if role.KeyType == "ec" {
+		certReq.KeyType = certificate.KeyTypeECDSA
+		switch {
+		case role.KeyCurve == "P256":
+			certReq.KeyCurve = certificate.EllipticCurveP256
+		case role.KeyCurve == "P384":
+			certReq.KeyCurve = certificate.EllipticCurveP384
+		case role.KeyCurve == "P521":
+			certReq.KeyCurve = certificate.EllipticCurveP521
+		default:
+			return fmt.Errorf("can't use key curve %s", role.KeyCurve)
+		}
+
+	} else {
+		return fmt.Errorf("can't determine key algorithm for %s", role.KeyType)
+	}
+	return nil
+}
+
+// subjectName builds the subject of a locally generated request, leaving out the attributes that aren't set
+func subjectName(reqData requestData) pkix.Name {
+	subject := pkix.Name{
+		CommonName:         reqData.commonName,
+		Organization:       reqData.organization,
+		OrganizationalUnit: reqData.ou,
+	}
+	if reqData.locality != "" {
+		subject.Locality = []string{reqData.locality}
+	}
+	if reqData.province != "" {
+		subject.Province = []string{reqData.province}
+	}
+	if reqData.country != "" {
+		subject.Country = []string{reqData.country}
+	}
+	return subject
+}
+
 type requestData struct {
 	commonName   string
 	altNames     []string
 	ipSANs       []string
+	emailSANs    []string
+	uriSANs      []string
+	keyUsages    []string
+	extKeyUsages []string
 	keyPassword  string
 	csrString    string
+	privateKey   string
 	customFields []string
+	chainOption  string
 	ttl          time.Duration
+	organization []string
+	ou           []string
+	locality     string
+	province     string
+	country      string
+	//set when requested with exclude_cn_from_sans or when the zone doesn't take DNS SANs, so the CN isn't added to them
+	omitCNFromSANs bool
+	mountOrigin    string
+	requester      string
+	friendlyName   string
+	//the device and application the certificate is associated with in Trust Protection Platform
+	instance        string
+	tlsAddress      string
+	replaceInstance bool
+}
+
+// validateDomainsSpecified checks that an issue request has a common name or alt names to request the certificate for
+func validateDomainsSpecified(reqData requestData) error {
+	if reqData.commonName == "" && len(reqData.altNames) == 0 {
+		return fmt.Errorf(errorTextNoDomains)
+	}
+	return nil
+}
+
+// validateCSR checks a user provided CSR against the restrictions of the role, the same way as the names and key of a
+// request the backend builds itself
+func validateCSR(role *roleEntry, csr *x509.CertificateRequest) error {
+	if keyType := publicKeyType(csr.PublicKey); !role.isAllowedKeyType(keyType) {
+		return fmt.Errorf(errorTextCSRKeyTypeNotAllowed, keyType, strings.Join(role.AllowedKeyTypes, `", "`))
+	}
+	if pub, ok := csr.PublicKey.(*rsa.PublicKey); ok {
+		if err := validateRSAKeyBits(role, pub.N.BitLen()); err != nil {
+			return err
+		}
+	}
+	if role.RequireAltNames && len(csr.DNSNames) == 0 {
+		return fmt.Errorf(errorTextRequireAltNames)
+	}
+	if role.RequireCN && csr.Subject.CommonName == "" {
+		return fmt.Errorf(errorTextRequireCN)
+	}
+	names := append([]string{csr.Subject.CommonName}, csr.DNSNames...)
+	if err := validateWildcards(role, names); err != nil {
+		return err
+	}
+	if err := validateAllowedNames(role, append(names, csr.EmailAddresses...)); err != nil {
+		return err
+	}
+	return validateAllowedURISANs(role, csr.URIs)
 }
 
 func formRequest(reqData requestData, role *roleEntry, signCSR bool, logger hclog.Logger) (certReq *certificate.Request, err error) {
 	if !signCSR {
-		if len(reqData.commonName) == 0 && len(reqData.altNames) == 0 {
-			return certReq, fmt.Errorf("no domains specified on certificate")
+		if err := validateDomainsSpecified(reqData); err != nil {
+			return certReq, err
+		}
+		if role.RequireAltNames && !hasDNSAltName(reqData.altNames) {
+			return certReq, fmt.Errorf(errorTextRequireAltNames)
 		}
+		//the first alt name is used as common name only when the role doesn't require one
 		if len(reqData.commonName) == 0 && len(reqData.altNames) > 0 {
+			if role.RequireCN {
+				return certReq, fmt.Errorf(errorTextRequireCN)
+			}
 			reqData.commonName = reqData.altNames[0]
 		}
-		if !sliceContains(reqData.altNames, reqData.commonName) {
+		if !reqData.omitCNFromSANs && !sliceContainsFold(reqData.altNames, reqData.commonName) {
 			logger.Debug(fmt.Sprintf("Adding CN %s to SAN %s because it wasn't included.", reqData.commonName, reqData.altNames))
 			reqData.altNames = append(reqData.altNames, reqData.commonName)
 		}
 		certReq = &certificate.Request{
-			Subject: pkix.Name{
-				CommonName: reqData.commonName,
-			},
+			Subject:     subjectName(reqData),
 			CsrOrigin:   certificate.LocalGeneratedCSR,
 			KeyPassword: reqData.keyPassword,
 		}
-		ipSet := make(map[string]struct{})
-		nameSet := make(map[string]struct{})
+		if role.ServiceGenerated || role.CSROrigin == csrOriginService {
+			certReq.CsrOrigin = certificate.ServiceGeneratedCSR
+		}
+		if reqData.privateKey != "" {
+			if certReq.CsrOrigin != certificate.LocalGeneratedCSR {
+				return certReq, fmt.Errorf(errorTextPrivateKeyRequiresLocalCSR)
+			}
+			//the key is used as is, its parameters are checked against the requested ones once they are applied
+			certReq.PrivateKey, err = parsePrivateKeyPEM(reqData.privateKey, "")
+			if err != nil {
+				return certReq, fmt.Errorf(`invalid "private_key": %s`, err)
+			}
+		}
+		if len(reqData.keyUsages) > 0 || len(reqData.extKeyUsages) > 0 {
+			if certReq.CsrOrigin != certificate.LocalGeneratedCSR {
+				return certReq, fmt.Errorf(errorTextUsagesRequireLocalCSR)
+			}
+			certReq.Attributes, err = usageAttributes(reqData.keyUsages, reqData.extKeyUsages)
+			if err != nil {
+				return certReq, err
+			}
+		}
+		//SANs are deduplicated keeping the order of the request. DNS names and email addresses are compared ignoring the
+		//case, DNS names are kept in their lowercase form, and IP addresses in their canonical form. IP addresses given
+		//in alt_names are IP SANs, not DNS names.
+		var ips []string
 		for _, v := range reqData.altNames {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
 			if strings.Contains(v, "@") {
-				certReq.EmailAddresses = append(certReq.EmailAddresses, v)
-			} else if net.ParseIP(v) != nil {
-				ipSet[v] = struct{}{}
-				nameSet[v] = struct{}{}
+				certReq.EmailAddresses = appendUniqueFold(certReq.EmailAddresses, v)
+			} else if ip := net.ParseIP(v); ip != nil {
+				ips = appendUniqueFold(ips, ip.String())
 			} else {
-				nameSet[v] = struct{}{}
+				certReq.DNSNames = appendUniqueFold(certReq.DNSNames, strings.ToLower(v))
 			}
 		}
 		for _, v := range reqData.ipSANs {
-			if net.ParseIP(v) != nil {
-				ipSet[v] = struct{}{}
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return certReq, fmt.Errorf(errorTextInvalidIPSAN, v)
+			}
+			ips = appendUniqueFold(ips, ip.String())
+		}
+		for _, v := range reqData.emailSANs {
+			addr, err := mail.ParseAddress(v)
+			if err != nil || addr.Address != v {
+				return certReq, fmt.Errorf(errorTextInvalidEmailSAN, v)
 			}
+			certReq.EmailAddresses = appendUniqueFold(certReq.EmailAddresses, v)
 		}
-		for ip := range ipSet {
+		for _, v := range reqData.uriSANs {
+			uri, err := url.Parse(v)
+			if err != nil || uri.Scheme == "" {
+				return certReq, fmt.Errorf(errorTextInvalidURISAN, v)
+			}
+			certReq.URIs = append(certReq.URIs, uri)
+		}
+		for _, ip := range ips {
 			certReq.IPAddresses = append(certReq.IPAddresses, net.ParseIP(ip))
 		}
-		for k := range nameSet {
-			certReq.DNSNames = append(certReq.DNSNames, k)
+		names := append([]string{reqData.commonName}, certReq.DNSNames...)
+		if err := validateWildcards(role, names); err != nil {
+			return certReq, err
+		}
+		if role.AddWildcardApex {
+			for _, apex := range wildcardApexes(names) {
+				if !sliceContainsFold(certReq.DNSNames, apex) {
+					logger.Debug(fmt.Sprintf("Adding apex domain %s of the wildcard to SAN %s.", apex, certReq.DNSNames))
+					certReq.DNSNames = append(certReq.DNSNames, apex)
+					names = append(names, apex)
+				}
+			}
+		}
+		if err := validateAllowedNames(role, append(names, certReq.EmailAddresses...)); err != nil {
+			return certReq, err
+		}
+		if err := validateAllowedURISANs(role, certReq.URIs); err != nil {
+			return certReq, err
 		}
 
 	} else {
@@ -451,7 +1192,14 @@ func formRequest(reqData requestData, role *roleEntry, signCSR bool, logger hclo
 		if err != nil {
 			return certReq, fmt.Errorf("can't parse provided CSR %v", err)
 		}
+		//proves the requester holds the private key of the CSR, which never reaches the backend
+		if err := csr.CheckSignature(); err != nil {
+			return certReq, fmt.Errorf("provided CSR has an invalid signature: %v", err)
+		}
 		reqData.commonName = csr.Subject.CommonName
+		if err := validateCSR(role, csr); err != nil {
+			return certReq, err
+		}
 		certReq = &certificate.Request{
 			CsrOrigin: certificate.UserProvidedCSR,
 		}
@@ -462,55 +1210,60 @@ func formRequest(reqData requestData, role *roleEntry, signCSR bool, logger hclo
 	}
 
 	if !signCSR {
-		if role.KeyType == "rsa" {
-			certReq.KeyLength = role.KeyBits
-		} else if role.KeyType == "ec" {
-			certReq.KeyType = certificate.KeyTypeECDSA
-			switch {
-			case role.KeyCurve == "P256":
-				certReq.KeyCurve = certificate.EllipticCurveP256
-			case role.KeyCurve == "P384":
-				certReq.KeyCurve = certificate.EllipticCurveP384
-			case role.KeyCurve == "P521":
-				certReq.KeyCurve = certificate.EllipticCurveP521
-			default:
-				return certReq, fmt.Errorf("can't use key curve %s", role.KeyCurve)
+		if err := applyRoleKeyParams(certReq, role); err != nil {
+			return certReq, err
+		}
+		if certReq.PrivateKey != nil {
+			if err := validatePrivateKeyParams(role, certReq.PrivateKey); err != nil {
+				return certReq, err
+			}
+			if key, ok := certReq.PrivateKey.(*rsa.PrivateKey); ok {
+				certReq.KeyLength = key.N.BitLen()
 			}
-
-		} else {
-			return certReq, fmt.Errorf("can't determine key algorithm for %s", role.KeyType)
 		}
 	}
 
-	if role.ChainOption == "first" {
-		certReq.ChainOption = certificate.ChainOptionRootFirst
-	} else if role.ChainOption == "last" {
-		certReq.ChainOption = certificate.ChainOptionRootLast
-	} else {
-		return certReq, fmt.Errorf("invalid chain option %s", role.ChainOption)
+	//the object name is a leaf of the policy folder DN, so it can't contain the DN separator
+	if strings.Contains(reqData.friendlyName, `\`) {
+		return certReq, fmt.Errorf(errorTextInvalidFriendlyName, reqData.friendlyName)
+	}
+	certReq.FriendlyName = reqData.friendlyName
+
+	certReq.Location, err = requestLocation(reqData)
+	if err != nil {
+		return certReq, err
+	}
+
+	chainOption := role.ChainOption
+	if reqData.chainOption != "" {
+		chainOption = reqData.chainOption
+	}
+	certReq.ChainOption, err = parseChainOption(chainOption)
+	if err != nil {
+		return certReq, err
 	}
 
 	if reqData.ttl > 0 {
 
 		certReq.IssuerHint = getIssuerHint(role.IssuerHint)
 
-		ttl := int(reqData.ttl.Hours())
+		ttl := int(roundValidity(reqData.ttl, role.RoundValidityTo, role.MaxTTL).Hours())
 		certReq.ValidityHours = ttl
 
 	} else if role.TTL > 0 {
 
 		certReq.IssuerHint = getIssuerHint(role.IssuerHint)
 
-		ttl := int(role.TTL.Hours())
+		ttl := int(roundValidity(role.TTL, role.RoundValidityTo, role.MaxTTL).Hours())
 		certReq.ValidityHours = ttl
 	}
 
-	//Adding origin custom field with utility name to certificate metadata
-	certReq.CustomFields = []certificate.CustomField{{Type: certificate.CustomFieldOrigin, Value: utilityName}}
+	//Adding origin custom field with utility name, or the role origin, to certificate metadata
+	certReq.CustomFields = []certificate.CustomField{{Type: certificate.CustomFieldOrigin, Value: role.requestOrigin()}}
 
 	//Adding custom fields to certificate
 	if !isValidCustomFields(reqData.customFields) {
-		return certReq, fmt.Errorf("invalid custom fields; must be 'key=value' using commas to separate multiple key-value pairs")
+		return certReq, fmt.Errorf(errorTextInvalidCustomFields)
 	}
 	for _, f := range reqData.customFields {
 		tuple := strings.Split(f, "=")
@@ -521,9 +1274,279 @@ func formRequest(reqData requestData, role *roleEntry, signCSR bool, logger hclo
 		}
 	}
 
+	//Tagging the certificate with the Vault mount it was issued from
+	if role.TagOrigin && reqData.mountOrigin != "" {
+		certReq.CustomFields = append(certReq.CustomFields, certificate.CustomField{Name: role.OriginCustomField, Value: reqData.mountOrigin})
+	}
+	//Tagging the certificate with the Vault identity that requested it
+	if role.TagRequester && reqData.requester != "" {
+		certReq.CustomFields = append(certReq.CustomFields, certificate.CustomField{Name: role.RequesterCustomField, Value: reqData.requester})
+	}
+
 	return certReq, nil
 }
 
+// requestLocation returns the device and application, in format 'device:application', the certificate is associated
+// with in Trust Protection Platform, or nil when the request has no instance
+func requestLocation(reqData requestData) (*certificate.Location, error) {
+	if reqData.instance == "" {
+		if reqData.tlsAddress != "" || reqData.replaceInstance {
+			return nil, fmt.Errorf(errorTextInstanceRequired)
+		}
+		return nil, nil
+	}
+	device, application := reqData.instance, ""
+	if i := strings.Index(reqData.instance, ":"); i >= 0 {
+		device, application = reqData.instance[:i], reqData.instance[i+1:]
+	}
+	if device == "" || strings.Contains(reqData.instance, `\`) {
+		return nil, fmt.Errorf(errorTextInvalidInstance, reqData.instance)
+	}
+	if reqData.tlsAddress != "" {
+		if _, _, err := net.SplitHostPort(reqData.tlsAddress); err != nil {
+			return nil, fmt.Errorf(errorTextInvalidTLSAddress, reqData.tlsAddress)
+		}
+	}
+	return &certificate.Location{
+		Instance:   device,
+		Workload:   application,
+		TLSAddress: reqData.tlsAddress,
+		Replace:    reqData.replaceInstance,
+	}, nil
+}
+
+// mountOrigin returns the Vault namespace and mount path a request was made to. Plugins aren't told the namespace, so it's
+// taken from the X-Vault-Namespace header, which reaches the plugin only if the mount passes it through with
+// "passthrough_request_headers"
+func mountOrigin(req *logical.Request) string {
+	namespace := ""
+	if values := req.Headers[consts.NamespaceHeaderName]; len(values) > 0 {
+		namespace = strings.Trim(values[0], "/")
+	}
+	if namespace == "" {
+		return req.MountPoint
+	}
+	return namespace + "/" + req.MountPoint
+}
+
+var cnTransformVarRegex = regexp.MustCompile(`{{\s*([A-Za-z0-9_\-]+)\s*}}`)
+
+// transformCommonName applies the role cn_transform template to the common name. The {{cn}} variable is the requested
+// common name, any other variable is taken from vars.
+func transformCommonName(template string, commonName string, vars map[string]string) (string, error) {
+	if commonName == "" {
+		return "", fmt.Errorf(errorTextNoDomains)
+	}
+
+	var missing []string
+	transformed := cnTransformVarRegex.ReplaceAllStringFunc(template, func(match string) string {
+		name := cnTransformVarRegex.FindStringSubmatch(match)[1]
+		if name == "cn" {
+			return commonName
+		}
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing values for cn_transform variables: %s", strings.Join(missing, ", "))
+	}
+	return transformed, nil
+}
+
+// parseChainOption returns the vcert chain option of the role "chain_option", where the root CA is placed in the chain
+func parseChainOption(option string) (certificate.ChainOption, error) {
+	switch option {
+	case "first":
+		return certificate.ChainOptionRootFirst, nil
+	case "last":
+		return certificate.ChainOptionRootLast, nil
+	}
+	return certificate.ChainOptionRootLast, fmt.Errorf("invalid chain option %s", option)
+}
+
+// parseIssuedCertificate parses the certificate returned by Venafi, which could be empty or malformed after an error
+// on the Venafi side
+func parseIssuedCertificate(certPEM string) (*x509.Certificate, error) {
+	pemBlock, _ := pem.Decode([]byte(certPEM))
+	if pemBlock == nil {
+		return nil, fmt.Errorf("failed to decode the certificate returned by Venafi: no PEM data found")
+	}
+	cert, err := x509.ParseCertificate(pemBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the certificate returned by Venafi: %s", err)
+	}
+	return cert, nil
+}
+
+// leaseTTL returns the lease duration of a certificate secret. The lease ends when the certificate expires, but never
+// outlives the role max TTL, e.g. when the zone issues certificates for longer than the role allows.
+func leaseTTL(notAfter time.Time, maxTTL time.Duration) time.Duration {
+	ttl := time.Until(notAfter)
+	if maxTTL > 0 && ttl > maxTTL {
+		return maxTTL
+	}
+	return ttl
+}
+
+// certLeaseTTL returns the lease duration of a certificate issued with the role, and a warning when it was limited by
+// the role or the mount and must be renewed to last until the certificate expires. The role "lease_default_ttl" is used
+// when it's shorter than the certificate lifetime, or when the certificate expiration can't be determined.
+func (b *backend) certLeaseTTL(role *roleEntry, notAfter time.Time, serialNumber string) (time.Duration, string) {
+	ttl := leaseTTL(notAfter, role.MaxTTL)
+	if role.LeaseDefaultTTL > 0 && (ttl <= 0 || role.LeaseDefaultTTL < ttl) {
+		ttl = role.LeaseDefaultTTL
+	}
+	ttl = roundLeaseTTL(ttl, role.leaseRoundTo())
+	if clampedTTL, clamped := clampLeaseTTL(ttl, role.LeaseMaxTTL, b.System().MaxLeaseTTL()); clamped {
+		return clampedTTL, fmt.Sprintf("The lease of certificate %s was limited to %s, it must be renewed to last until the certificate expires", serialNumber, clampedTTL)
+	}
+	return ttl, ""
+}
+
+// roundLeaseTTL rounds the lease duration down to a multiple of roundTo, e.g. 719h instead of 719h59m58s. Leases shorter
+// than roundTo are kept as they are.
+func roundLeaseTTL(ttl, roundTo time.Duration) time.Duration {
+	if roundTo <= 0 || ttl < roundTo {
+		return ttl
+	}
+	return ttl.Truncate(roundTo)
+}
+
+// clampLeaseTTL limits the lease duration to the role "lease_max_ttl" and to the max lease TTL of the mount, so long
+// lived certificates don't keep leases around for years. It returns if the lease was shortened.
+func clampLeaseTTL(ttl, leaseMaxTTL, mountMaxTTL time.Duration) (time.Duration, bool) {
+	clamped := ttl
+	if leaseMaxTTL > 0 && clamped > leaseMaxTTL {
+		clamped = leaseMaxTTL
+	}
+	if mountMaxTTL > 0 && clamped > mountMaxTTL {
+		clamped = mountMaxTTL
+	}
+	return clamped, clamped != ttl
+}
+
+// roundValidity rounds the validity to the nearest multiple of roundTo, rounding down when rounding up would exceed
+// maxTTL. The validity is never rounded down to zero.
+func roundValidity(validity, roundTo, maxTTL time.Duration) time.Duration {
+	if roundTo <= 0 {
+		return validity
+	}
+	rounded := validity.Round(roundTo)
+	if maxTTL > 0 && rounded > maxTTL {
+		rounded = validity.Truncate(roundTo)
+	}
+	if rounded == 0 {
+		rounded = roundTo
+	}
+	return rounded
+}
+
+// zoneAllowsDNSSANs validates if the zone policy allows DNS names in the SAN. vcert doesn't tell if they are mandatory,
+// only which ones are allowed.
+func zoneAllowsDNSSANs(zoneConfig *endpoint.ZoneConfiguration) bool {
+	return len(zoneConfig.DnsSanRegExs) > 0
+}
+
+// zoneAllowsDNSSAN validates if the zone policy allows the name as a DNS SAN
+func zoneAllowsDNSSAN(zoneConfig *endpoint.ZoneConfiguration, name string) bool {
+	for _, pattern := range zoneConfig.DnsSanRegExs {
+		if matched, err := regexp.MatchString(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// cnAddedToSANs tells if formRequest adds the common name to the DNS SANs because the request doesn't have it
+func cnAddedToSANs(reqData requestData, signCSR bool) bool {
+	if signCSR || reqData.omitCNFromSANs || reqData.commonName == "" {
+		return false
+	}
+	return !sliceContainsFold(reqData.altNames, reqData.commonName)
+}
+
+// requestDNSNames returns the DNS names of the request, read from the CSR when it was provided
+func requestDNSNames(certReq *certificate.Request) []string {
+	if certReq.CsrOrigin != certificate.UserProvidedCSR {
+		return certReq.DNSNames
+	}
+	pemBlock, _ := pem.Decode(certReq.GetCSR())
+	if pemBlock == nil {
+		return nil
+	}
+	csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+	if err != nil {
+		return nil
+	}
+	return csr.DNSNames
+}
+
+// sanChangeWarnings describes how the SANs of the issued certificate differ from the requested ones, as the zone
+// policy may remove names from the request or Venafi may add some
+func sanChangeWarnings(certReq *certificate.Request, cert *x509.Certificate) []string {
+	requested := certReq.DNSNames
+	requestedIPs := certReq.IPAddresses
+	requestedEmails := certReq.EmailAddresses
+	if certReq.CsrOrigin == certificate.UserProvidedCSR {
+		pemBlock, _ := pem.Decode(certReq.GetCSR())
+		if pemBlock == nil {
+			return nil
+		}
+		csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+		if err != nil {
+			return nil
+		}
+		requested, requestedIPs, requestedEmails = csr.DNSNames, csr.IPAddresses, csr.EmailAddresses
+	}
+
+	var issuedIPs, requestedIPStrings []string
+	for _, ip := range cert.IPAddresses {
+		issuedIPs = append(issuedIPs, ip.String())
+	}
+	for _, ip := range requestedIPs {
+		requestedIPStrings = append(requestedIPStrings, ip.String())
+	}
+
+	var warnings []string
+	compare := func(requested, issued []string) {
+		for _, name := range requested {
+			if !sliceContainsFold(issued, name) {
+				warnings = append(warnings, fmt.Sprintf("The SAN %s was removed by the zone policy.", name))
+			}
+		}
+		for _, name := range issued {
+			if !sliceContainsFold(requested, name) {
+				warnings = append(warnings, fmt.Sprintf("The SAN %s was added by Venafi.", name))
+			}
+		}
+	}
+	compare(requested, cert.DNSNames)
+	compare(requestedIPStrings, issuedIPs)
+	compare(requestedEmails, cert.EmailAddresses)
+	return warnings
+}
+
+// appendUniqueFold appends the value unless the slice already has it, ignoring the case
+func appendUniqueFold(slice []string, value string) []string {
+	if sliceContainsFold(slice, value) {
+		return slice
+	}
+	return append(slice, value)
+}
+
+// hasDNSAltName checks if at least one of the alt names is a DNS name, emails and IP addresses are not taken into account
+func hasDNSAltName(altNames []string) bool {
+	for _, v := range altNames {
+		if v != "" && !strings.Contains(v, "@") && net.ParseIP(v) == nil {
+			return true
+		}
+	}
+	return false
+}
+
 func getIssuerHint(is string) string {
 
 	issuerHint := ""
@@ -566,13 +1589,108 @@ func isValidCustomFields(customFields []string) bool {
 	return true
 }
 
+// mergeCustomFields adds the requested custom fields to the role defaults. A field can have several values, so all the
+// role values of a field given in the request are replaced by the requested ones.
+func mergeCustomFields(roleFields, requested []string) []string {
+	requestedNames := make(map[string]bool)
+	for _, f := range requested {
+		requestedNames[customFieldName(f)] = true
+	}
+	var merged []string
+	for _, f := range roleFields {
+		if !requestedNames[customFieldName(f)] {
+			merged = append(merged, f)
+		}
+	}
+	return append(merged, requested...)
+}
+
+func customFieldName(field string) string {
+	return strings.TrimSpace(strings.SplitN(field, "=", 2)[0])
+}
+
 type VenafiCert struct {
 	Certificate      string `json:"certificate"`
 	CertificateChain string `json:"certificate_chain"`
 	PrivateKey       string `json:"private_key"`
 	SerialNumber     string `json:"serial_number"`
+	CertificateDN    string `json:"certificate_dn,omitempty"`
+	Thumbprint       string `json:"thumbprint,omitempty"`
+	PickupID         string `json:"pickup_id,omitempty"`
+	Expiration       int64  `json:"expiration,omitempty"`
+	RevocationTime   int64  `json:"revocation_time,omitempty"`
+	RevocationReason string `json:"revocation_reason,omitempty"`
+	//who requested the certificate and with which role, unset for certificates stored by earlier versions
+	Role              string `json:"role,omitempty"`
+	IssuedAt          int64  `json:"issued_at,omitempty"`
+	RequestedBy       string `json:"requested_by,omitempty"`
+	RequestedByEntity string `json:"requested_by_entity,omitempty"`
+}
+
+// requestedBy names the client that sent the request, by its token display name or else its entity
+func requestedBy(req *logical.Request) string {
+	if req.DisplayName != "" {
+		return req.DisplayName
+	}
+	return req.EntityID
+}
+
+// requesterTag names the client that sent the request in the Venafi custom field of roles with "tag_requester", by its
+// token display name followed by its entity when it has both
+func requesterTag(req *logical.Request) string {
+	if req.DisplayName != "" && req.EntityID != "" {
+		return fmt.Sprintf("%s (%s)", req.DisplayName, req.EntityID)
+	}
+	return requestedBy(req)
 }
 
+// certificateDN returns the DN of the certificate object in TPP, which is the ID of the request made for it. vcert
+// exposes neither the object GUID nor an equivalent identifier for Venafi Cloud, so it's empty for other connectors.
+func certificateDN(connectorType endpoint.ConnectorType, requestID string) string {
+	if connectorType == endpoint.ConnectorTypeTPP {
+		return requestID
+	}
+	return ""
+}
+
+const (
+	csrOriginLocal   = "local"
+	csrOriginService = "service"
+)
+
+const (
+	cnOnlyBehaviorAppend  = "append"
+	cnOnlyBehaviorPromote = "promote"
+	cnOnlyBehaviorFail    = "fail"
+)
+
+// warningTextPrivateKeyACL is added to the responses returning a private key
+const warningTextPrivateKeyACL = "Read access to this endpoint should be controlled via ACLs as it will return the connection private key as it is."
+
+const (
+	errorTextUsagesRequireLocalCSR      = `"key_usage" and "ext_key_usage" can only be requested with a locally generated CSR`
+	errorTextPrivateKeyRequiresLocalCSR = `"private_key" can only be given with a locally generated CSR`
+	errorTextCSRAndCSROnly              = `"csr" and "csr_only" can't both be set, "csr_only" generates a new CSR`
+	warningTextKeyFieldsIgnored         = `A CSR was given, no key is generated and "%s" are ignored.`
+	errorTextServiceGeneratedCloud      = `Venafi Cloud doesn't generate keys, the role must use "csr_origin" "local"`
+	errorTextZoneRejectsCNAsDNSSAN      = `zone doesn't allow common name %s as a DNS SAN, add DNS names the zone allows to "alt_names"`
+	errorTextRequireAltNames            = `role requires at least one DNS name in "alt_names"`
+	errorTextInvalidIPSAN               = `invalid IP address %q in "ip_sans"`
+	errorTextInvalidEmailSAN            = `invalid email address %q in "email_sans"`
+	errorTextInvalidURISAN              = `invalid URI %q in "uri_sans", it must be absolute`
+	errorTextNoDomains                  = "no domains specified on certificate"
+	errorTextInvalidFormat              = `invalid format %s, can be "pem", "der", "pem_bundle" or "kubernetes"`
+	errorTextKubernetesKeyPassword      = `"key_password" can't be used with format "kubernetes", Kubernetes TLS secrets hold unencrypted keys`
+	errorTextInvalidCustomFields        = "invalid custom fields; must be 'key=value' using commas to separate multiple key-value pairs"
+	errorTextInvalidFriendlyName        = `invalid "friendly_name" %q, it can't contain a backslash`
+	errorTextInvalidInstance            = `invalid "instance" %q, use format 'device:application' without backslashes`
+	errorTextInvalidTLSAddress          = `invalid "tls_address" %q, use format 'host:port'`
+	errorTextInstanceRequired           = `"tls_address" and "replace_instance" require an "instance"`
+	errorTextRequestReset               = `certificate request %s was reset on Venafi Platform after the role gave up retrieving it: %w`
+	errorTextFriendlyNameRequest        = `failed to request certificate with "friendly_name" %q, check that no other certificate of the zone has this name: %s`
+	errorTextUniqueCN                   = `a valid certificate for common name %s already exists with serial number %s and expires at %s, renew it or set "force" to issue a new one`
+)
+
 const (
 	pathConfigRootHelpSyn = `
 Configure the Venafi TPP credentials that are used to manage certificates,
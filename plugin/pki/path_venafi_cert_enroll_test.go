@@ -1,7 +1,21 @@
 package pki
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestOriginInRequest(t *testing.T) {
@@ -22,4 +36,842 @@ func TestOriginInRequest(t *testing.T) {
 	if certReq.CustomFields[0].Value != utilityName {
 		t.Fatalf("Expected %s in request custom fields origin", utilityName)
 	}
+
+	role.Origin = "vault-pki-backend-venafi"
+	certReq, err = formRequest(data, &role, signCSR, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certReq.CustomFields[0].Type != certificate.CustomFieldOrigin || certReq.CustomFields[0].Value != role.Origin {
+		t.Fatalf("Expected %s in request custom fields origin, got %#v", role.Origin, certReq.CustomFields[0])
+	}
+}
+
+func TestIssueWithUnknownRole(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"issue/missing-role", "sign/missing-role"} {
+		resp, err := integrationTestEnv.Backend.HandleRequest(integrationTestEnv.Context, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   integrationTestEnv.Storage,
+			Data: map[string]interface{}{
+				"common_name": "tpp.example.com",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() || resp.Error().Error() != `unknown role "missing-role"` {
+			t.Fatalf("Expecting an unknown role error response on %s but got %#v", path, resp)
+		}
+	}
+}
+
+func TestIssueWithoutDomains(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the role points to a Venafi secret that doesn't exist, so the request must be refused before connecting
+	entry, err := logical.StorageEntryJSON("role/no-secret", roleEntry{VenafiSecret: "missing-secret", KeyType: "rsa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := integrationTestEnv.Storage.Put(integrationTestEnv.Context, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []map[string]interface{}{{}, {"common_name": "", "alt_names": ""}} {
+		resp, err := integrationTestEnv.Backend.HandleRequest(integrationTestEnv.Context, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/no-secret",
+			Storage:   integrationTestEnv.Storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() || resp.Error().Error() != errorTextNoDomains {
+			t.Fatalf("Expecting error %s for %v but got %#v", errorTextNoDomains, data, resp)
+		}
+	}
+
+	if err := validateDomainsSpecified(requestData{altNames: []string{"tpp.example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIssueKubernetesWithEncryptedKey(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the role points to a Venafi secret that doesn't exist, so the request must be refused before connecting
+	entry, err := logical.StorageEntryJSON("role/no-secret", roleEntry{VenafiSecret: "missing-secret", KeyType: "rsa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := integrationTestEnv.Storage.Put(integrationTestEnv.Context, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string]interface{}{"common_name": "k8s.example.com", "format": formatKubernetes, "key_password": "password"}
+	resp, err := integrationTestEnv.Backend.HandleRequest(integrationTestEnv.Context, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue/no-secret",
+		Storage:   integrationTestEnv.Storage,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() || resp.Error().Error() != errorTextKubernetesKeyPassword {
+		t.Fatalf("Expecting error %s for %v but got %#v", errorTextKubernetesKeyPassword, data, resp)
+	}
+}
+
+func TestCSROriginInRequest(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := requestData{commonName: "tpp.example.com"}
+	for origin, expected := range map[string]certificate.CSrOriginOption{
+		"":               certificate.LocalGeneratedCSR,
+		csrOriginLocal:   certificate.LocalGeneratedCSR,
+		csrOriginService: certificate.ServiceGeneratedCSR,
+	} {
+		role := roleEntry{KeyType: "rsa", ChainOption: "first", CSROrigin: origin}
+		certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if certReq.CsrOrigin != expected {
+			t.Fatalf("Expecting CSR origin %v for csr_origin %q but got %v", expected, origin, certReq.CsrOrigin)
+		}
+	}
+}
+
+func TestRequireAltNames(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+	role.RequireAltNames = true
+
+	var data requestData
+	data.commonName = "tpp.example.com"
+	data.altNames = []string{"192.168.1.1", "venafi@example.com"}
+
+	_, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err == nil || err.Error() != errorTextRequireAltNames {
+		t.Fatalf("Expecting error %s but got %v", errorTextRequireAltNames, err)
+	}
+
+	data.altNames = append(data.altNames, "alt.tpp.example.com")
+	_, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequireCN(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+
+	var data requestData
+	data.altNames = []string{"alt.tpp.example.com"}
+
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certReq.Subject.CommonName != "alt.tpp.example.com" {
+		t.Fatalf("first alt name should be used as common name, got %s", certReq.Subject.CommonName)
+	}
+
+	role.RequireCN = true
+	_, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err == nil || err.Error() != errorTextRequireCN {
+		t.Fatalf("Expecting error %s but got %v", errorTextRequireCN, err)
+	}
+
+	data.commonName = "tpp.example.com"
+	_, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrivateKeyInRequest(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 3072)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+
+	var data requestData
+	data.commonName = "tpp.example.com"
+	data.privateKey = keyPEM
+
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requestKey, ok := certReq.PrivateKey.(*rsa.PrivateKey); !ok || requestKey.N.Cmp(key.N) != 0 {
+		t.Fatal("Expecting the given private key in the request")
+	}
+	if certReq.KeyLength != 3072 {
+		t.Fatalf("Expecting the key length of the given key but got %d", certReq.KeyLength)
+	}
+
+	role.KeyBits = 2048
+	if _, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger()); err == nil {
+		t.Fatal("Expecting an error for a private key of another size than requested")
+	}
+
+	role.KeyBits = 0
+	role.CSROrigin = csrOriginService
+	if _, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger()); err == nil || err.Error() != errorTextPrivateKeyRequiresLocalCSR {
+		t.Fatalf("Expecting error %s but got %v", errorTextPrivateKeyRequiresLocalCSR, err)
+	}
+
+	role.CSROrigin = ""
+	data.privateKey = "not a key"
+	if _, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger()); err == nil {
+		t.Fatal("Expecting an error for an invalid private key")
+	}
+}
+
+func TestTransformCommonName(t *testing.T) {
+	cn, err := transformCommonName("{{env}}-{{cn}}", "tpp.example.com", map[string]string{"env": "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn != "prod-tpp.example.com" {
+		t.Fatalf("Expecting transformed common name prod-tpp.example.com but got %s", cn)
+	}
+
+	_, err = transformCommonName("{{ env }}-{{cn}}.{{region}}", "tpp.example.com", map[string]string{"env": "prod"})
+	if err == nil || !strings.Contains(err.Error(), "region") {
+		t.Fatalf("Expecting error about missing region variable but got %v", err)
+	}
+}
+
+func TestRoundValidity(t *testing.T) {
+	day := 24 * time.Hour
+	cases := []struct {
+		validity, roundTo, maxTTL, expected time.Duration
+	}{
+		{100 * time.Hour, 0, 0, 100 * time.Hour},
+		{100 * time.Hour, day, 0, 96 * time.Hour},
+		{110 * time.Hour, day, 0, 120 * time.Hour},
+		{110 * time.Hour, day, 115 * time.Hour, 96 * time.Hour},
+		{5 * time.Hour, day, 0, day},
+	}
+	for _, c := range cases {
+		rounded := roundValidity(c.validity, c.roundTo, c.maxTTL)
+		if rounded != c.expected {
+			t.Fatalf("Expecting validity %s rounded to %s with max TTL %s to be %s but got %s", c.validity, c.roundTo, c.maxTTL, c.expected, rounded)
+		}
+	}
+}
+
+func TestParseIssuedCertificate(t *testing.T) {
+	certPEM, _, _ := issueTestCertificate(t, 1, "tpp.example.com", false, nil, nil)
+	if cert, err := parseIssuedCertificate(certPEM); err != nil || cert.Subject.CommonName != "tpp.example.com" {
+		t.Fatalf("Expecting certificate to be parsed but got %v", err)
+	}
+
+	malformed := "-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydGlmaWNhdGU=\n-----END CERTIFICATE-----\n"
+	for _, certPEM := range []string{"", "not a certificate", malformed} {
+		if _, err := parseIssuedCertificate(certPEM); err == nil {
+			t.Fatalf("Expecting an error parsing %q", certPEM)
+		}
+	}
+}
+
+func TestLeaseTTL(t *testing.T) {
+	notAfter := time.Now().Add(90 * 24 * time.Hour)
+	if ttl := leaseTTL(notAfter, 30*24*time.Hour); ttl != 30*24*time.Hour {
+		t.Fatalf("Expecting the lease to be limited to the role max TTL but got %s", ttl)
+	}
+	if ttl := leaseTTL(notAfter, 0); ttl <= 89*24*time.Hour {
+		t.Fatalf("Expecting the lease to end when the certificate expires but got %s", ttl)
+	}
+}
+
+func TestRoundLeaseTTL(t *testing.T) {
+	if ttl := roundLeaseTTL(719*time.Hour+59*time.Minute+58*time.Second, time.Hour); ttl != 719*time.Hour {
+		t.Fatalf("Expecting the lease to be rounded down to whole hours but got %s", ttl)
+	}
+	if ttl := roundLeaseTTL(50*time.Hour, 24*time.Hour); ttl != 48*time.Hour {
+		t.Fatalf("Expecting the lease to be rounded down to whole days but got %s", ttl)
+	}
+	if ttl := roundLeaseTTL(30*time.Minute, time.Hour); ttl != 30*time.Minute {
+		t.Fatalf("Expecting a lease shorter than the rounding to be kept but got %s", ttl)
+	}
+}
+
+func TestCertLeaseTTL(t *testing.T) {
+	//the mount of the test backend has a max lease TTL of 48h
+	b, _ := createBackendWithStorage(t)
+	notAfter := time.Now().Add(90 * 24 * time.Hour)
+
+	ttl, warning := b.certLeaseTTL(&roleEntry{LeaseDefaultTTL: 12 * time.Hour}, notAfter, "aa:bb")
+	if ttl != 12*time.Hour || warning != "" {
+		t.Fatalf("Expecting the lease of a valid certificate to last lease_default_ttl but got %s, %q", ttl, warning)
+	}
+	ttl, warning = b.certLeaseTTL(&roleEntry{LeaseDefaultTTL: 12 * time.Hour}, time.Now().Add(6*time.Hour+time.Minute), "aa:bb")
+	if ttl != 6*time.Hour || warning != "" {
+		t.Fatalf("Expecting the lease of a certificate expiring before lease_default_ttl to end with it but got %s, %q", ttl, warning)
+	}
+	ttl, warning = b.certLeaseTTL(&roleEntry{LeaseDefaultTTL: 12 * time.Hour}, time.Now().Add(-time.Hour), "aa:bb")
+	if ttl != 12*time.Hour || warning != "" {
+		t.Fatalf("Expecting lease_default_ttl when the certificate expiration can't be determined but got %s, %q", ttl, warning)
+	}
+	ttl, warning = b.certLeaseTTL(&roleEntry{}, notAfter, "aa:bb")
+	if ttl != 48*time.Hour || warning == "" {
+		t.Fatalf("Expecting the lease to be limited to the mount max lease TTL with a warning but got %s, %q", ttl, warning)
+	}
+}
+
+func TestClampLeaseTTL(t *testing.T) {
+	cases := []struct {
+		ttl, leaseMaxTTL, mountMaxTTL, expected time.Duration
+		clamped                                 bool
+	}{
+		{ttl: 90 * 24 * time.Hour, expected: 90 * 24 * time.Hour},
+		{ttl: 90 * 24 * time.Hour, leaseMaxTTL: 24 * time.Hour, expected: 24 * time.Hour, clamped: true},
+		{ttl: 90 * 24 * time.Hour, mountMaxTTL: 48 * time.Hour, expected: 48 * time.Hour, clamped: true},
+		{ttl: 90 * 24 * time.Hour, leaseMaxTTL: 72 * time.Hour, mountMaxTTL: 48 * time.Hour, expected: 48 * time.Hour, clamped: true},
+		{ttl: 12 * time.Hour, leaseMaxTTL: 24 * time.Hour, mountMaxTTL: 48 * time.Hour, expected: 12 * time.Hour},
+	}
+	for _, c := range cases {
+		ttl, clamped := clampLeaseTTL(c.ttl, c.leaseMaxTTL, c.mountMaxTTL)
+		if ttl != c.expected || clamped != c.clamped {
+			t.Fatalf("Expecting lease of %s with lease_max_ttl %s and mount max TTL %s to be %s (clamped %t) but got %s (clamped %t)",
+				c.ttl, c.leaseMaxTTL, c.mountMaxTTL, c.expected, c.clamped, ttl, clamped)
+		}
+	}
+}
+
+func TestRequestLocation(t *testing.T) {
+	location, err := requestLocation(requestData{instance: "web01:nginx", tlsAddress: "web01.example.com:443", replaceInstance: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := certificate.Location{Instance: "web01", Workload: "nginx", TLSAddress: "web01.example.com:443", Replace: true}
+	if *location != expected {
+		t.Fatalf("Expecting location %#v but got %#v", expected, *location)
+	}
+
+	if location, err = requestLocation(requestData{instance: "web01"}); err != nil || location.Instance != "web01" || location.Workload != "" {
+		t.Fatalf("Expecting device web01 with the default application but got %#v, %v", location, err)
+	}
+	if location, err = requestLocation(requestData{}); err != nil || location != nil {
+		t.Fatalf("Expecting no location without an instance but got %#v, %v", location, err)
+	}
+
+	for _, reqData := range []requestData{
+		{instance: ":nginx"},
+		{instance: `web\01:nginx`},
+		{instance: "web01", tlsAddress: "web01.example.com"},
+		{tlsAddress: "web01.example.com:443"},
+		{replaceInstance: true},
+	} {
+		if _, err := requestLocation(reqData); err == nil {
+			t.Fatalf("Expecting an error for %#v", reqData)
+		}
+	}
+}
+
+func TestOmitCNFromSANs(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+
+	zoneConfig := endpoint.NewZoneConfiguration()
+	if zoneAllowsDNSSANs(zoneConfig) {
+		t.Fatalf("Zone without DNS SAN regexes should not allow DNS SANs")
+	}
+
+	var data requestData
+	data.commonName = "tpp.example.com"
+	data.omitCNFromSANs = true
+
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certReq.DNSNames) != 0 {
+		t.Fatalf("Expecting no DNS SANs but got %v", certReq.DNSNames)
+	}
+
+	data.altNames = []string{"alt.tpp.example.com"}
+	certReq, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certReq.DNSNames) != 1 || certReq.DNSNames[0] != "alt.tpp.example.com" {
+		t.Fatalf("Expecting only the alt name in the DNS SANs but got %v", certReq.DNSNames)
+	}
+	if certReq.Subject.CommonName != "tpp.example.com" {
+		t.Fatalf("Expecting the common name in the subject but got %s", certReq.Subject.CommonName)
+	}
+	if cnAddedToSANs(data, false) {
+		t.Fatal("Common name excluded from the SANs should not be reported as added")
+	}
+
+	//a zone allowing DNS SANs doesn't require them, so the common name is only refused when it isn't allowed
+	zoneConfig.DnsSanRegExs = []string{`^.*\.example\.com$`}
+	if !zoneAllowsDNSSANs(zoneConfig) {
+		t.Fatalf("Zone with DNS SAN regexes should allow DNS SANs")
+	}
+	if !zoneAllowsDNSSAN(zoneConfig, "tpp.example.com") {
+		t.Fatalf("Zone should allow tpp.example.com as DNS SAN")
+	}
+	if zoneAllowsDNSSAN(zoneConfig, "tpp.example.org") {
+		t.Fatalf("Zone shouldn't allow tpp.example.org as DNS SAN")
+	}
+}
+
+func TestMountOriginInRequest(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &logical.Request{MountPoint: "venafi-pki/"}
+	if origin := mountOrigin(req); origin != "venafi-pki/" {
+		t.Fatalf("Expecting origin venafi-pki/ but got %s", origin)
+	}
+	req.Headers = map[string][]string{consts.NamespaceHeaderName: {"team-a/"}}
+	if origin := mountOrigin(req); origin != "team-a/venafi-pki/" {
+		t.Fatalf("Expecting origin team-a/venafi-pki/ but got %s", origin)
+	}
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+	role.TagOrigin = true
+	role.OriginCustomField = "Vault Mount"
+
+	var data requestData
+	data.commonName = "tpp.example.com"
+	data.mountOrigin = mountOrigin(req)
+
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range certReq.CustomFields {
+		if field.Name == role.OriginCustomField && field.Value == data.mountOrigin {
+			return
+		}
+	}
+	t.Fatalf("Expecting custom field %s with value %s but got %v", role.OriginCustomField, data.mountOrigin, certReq.CustomFields)
+}
+
+func TestRequesterInRequest(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+	role.TagRequester = true
+	role.RequesterCustomField = "Vault Requester"
+
+	var data requestData
+	data.commonName = "tpp.example.com"
+	data.requester = requesterTag(&logical.Request{DisplayName: "token-ci", EntityID: "entity-id"})
+
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range certReq.CustomFields {
+		if field.Name == role.RequesterCustomField && field.Value == "token-ci (entity-id)" {
+			return
+		}
+	}
+	t.Fatalf("Expecting custom field %s with the requester but got %v", role.RequesterCustomField, certReq.CustomFields)
+}
+
+func TestCollapseAltNamesDifferingInCase(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+
+	var data requestData
+	data.commonName = "Foo.example.com"
+	data.altNames = []string{"foo.example.com", "BAR.example.com", "bar.example.com"}
+
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certReq.DNSNames) != 2 || !sliceContains(certReq.DNSNames, "foo.example.com") || !sliceContains(certReq.DNSNames, "bar.example.com") {
+		t.Fatalf("Expecting DNS SANs [foo.example.com bar.example.com] but got %v", certReq.DNSNames)
+	}
+	if certReq.Subject.CommonName != "Foo.example.com" {
+		t.Fatalf("Expecting common name Foo.example.com but got %s", certReq.Subject.CommonName)
+	}
+}
+
+func TestDeduplicateSANs(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+
+	var data requestData
+	data.commonName = "example.com"
+	data.altNames = []string{"Example.com", "www.example.com", "WWW.Example.com ", "Admin@example.com", "10.0.0.1", "2001:db8::1"}
+	data.ipSANs = []string{"10.0.0.1", "2001:0db8:0:0::1"}
+	data.emailSANs = []string{"admin@example.com", "ops@example.com"}
+
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedNames := []string{"example.com", "www.example.com"}
+	if strings.Join(certReq.DNSNames, ",") != strings.Join(expectedNames, ",") {
+		t.Fatalf("Expecting DNS SANs %v but got %v", expectedNames, certReq.DNSNames)
+	}
+	expectedEmails := []string{"Admin@example.com", "ops@example.com"}
+	if strings.Join(certReq.EmailAddresses, ",") != strings.Join(expectedEmails, ",") {
+		t.Fatalf("Expecting email SANs %v but got %v", expectedEmails, certReq.EmailAddresses)
+	}
+	if len(certReq.IPAddresses) != 2 || certReq.IPAddresses[0].String() != "10.0.0.1" || certReq.IPAddresses[1].String() != "2001:db8::1" {
+		t.Fatalf("Expecting IP SANs [10.0.0.1 2001:db8::1] but got %v", certReq.IPAddresses)
+	}
+}
+
+func TestMergeCustomFields(t *testing.T) {
+	roleFields := []string{"Cost Center=1234", "cfListMulti=tier1", "cfListMulti=tier2"}
+	merged := mergeCustomFields(roleFields, []string{"cfListMulti=tier4", "custom=vaultTest"})
+	expected := []string{"Cost Center=1234", "cfListMulti=tier4", "custom=vaultTest"}
+	if strings.Join(merged, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expecting custom fields %v but got %v", expected, merged)
+	}
+	if merged := mergeCustomFields(roleFields, nil); len(merged) != len(roleFields) {
+		t.Fatalf("Expecting role custom fields %v but got %v", roleFields, merged)
+	}
+}
+
+func TestCertificateDN(t *testing.T) {
+	dn := `\VED\Policy\devops\vcert\tpp.example.com`
+	if certificateDN(endpoint.ConnectorTypeTPP, dn) != dn {
+		t.Fatalf("Expecting certificate DN %s for TPP", dn)
+	}
+	if certDN := certificateDN(endpoint.ConnectorTypeCloud, "f0a5a1d0-2a5e-11eb-9c7b-1b1a2b3c4d5e"); certDN != "" {
+		t.Fatalf("Expecting no certificate DN for Venafi Cloud but got %s", certDN)
+	}
+	if certDN := certificateDN(endpoint.ConnectorTypeFake, "fake"); certDN != "" {
+		t.Fatalf("Expecting no certificate DN for the fake connector but got %s", certDN)
+	}
+}
+
+func TestSubjectInRequest(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+
+	var data requestData
+	data.commonName = "tpp.example.com"
+	data.organization = []string{"Venafi, Inc.", "Venafi"}
+	data.ou = []string{"DevOps", "Integrations"}
+	data.locality = "Salt Lake City"
+	data.province = "Utah"
+	data.country = "US"
+
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := certReq.Subject
+	if subject.CommonName != "tpp.example.com" || len(subject.Organization) != 2 || len(subject.OrganizationalUnit) != 2 ||
+		subject.Locality[0] != "Salt Lake City" || subject.Province[0] != "Utah" || subject.Country[0] != "US" {
+		t.Fatalf("Subject doesn't match the request: %#v", subject)
+	}
+
+	data = requestData{commonName: "tpp.example.com"}
+	certReq, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certReq.Subject.Locality) != 0 || len(certReq.Subject.Country) != 0 {
+		t.Fatalf("Subject should only have the common name: %#v", certReq.Subject)
+	}
+}
+
+func TestIPSANsInRequest(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+
+	var data requestData
+	data.commonName = "tpp.example.com"
+	data.ipSANs = []string{"192.168.1.1", "2001:db8::1"}
+
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certReq.IPAddresses) != 2 {
+		t.Fatalf("Expecting 2 IP addresses in the request but got %v", certReq.IPAddresses)
+	}
+
+	data.ipSANs = []string{"192.168.1.1", "192.168.1.300"}
+	_, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err == nil || !strings.Contains(err.Error(), "192.168.1.300") {
+		t.Fatalf("Expecting an error naming the invalid IP address but got %v", err)
+	}
+}
+
+func TestEmailAndURISANsInRequest(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+
+	var data requestData
+	data.commonName = "tpp.example.com"
+	data.altNames = []string{"venafi@example.com"}
+	data.emailSANs = []string{"venafi@example.com", "devops@example.com"}
+	data.uriSANs = []string{"spiffe://example.com/ns/default/sa/web"}
+
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certReq.EmailAddresses) != 2 {
+		t.Fatalf("Expecting 2 email addresses in the request but got %v", certReq.EmailAddresses)
+	}
+	if len(certReq.URIs) != 1 || certReq.URIs[0].String() != "spiffe://example.com/ns/default/sa/web" {
+		t.Fatalf("Expecting the SPIFFE ID in the request URIs but got %v", certReq.URIs)
+	}
+
+	data.emailSANs = []string{"Venafi <venafi@example.com>"}
+	_, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err == nil || !strings.Contains(err.Error(), "email_sans") {
+		t.Fatalf("Expecting an error for the invalid email address but got %v", err)
+	}
+
+	data.emailSANs = nil
+	data.uriSANs = []string{"/relative/path"}
+	_, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err == nil || !strings.Contains(err.Error(), "/relative/path") {
+		t.Fatalf("Expecting an error naming the invalid URI but got %v", err)
+	}
+}
+
+func TestSignedCSRSignature(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role roleEntry
+	role.ChainOption = "first"
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "tpp.example.com"},
+		DNSNames: []string{"tpp.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data requestData
+	data.csrString = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	if _, err := formRequest(data, &role, true, integrationTestEnv.Backend.Logger()); err != nil {
+		t.Fatal(err)
+	}
+
+	//the signature is at the end of the request
+	der[len(der)-1] ^= 0xff
+	data.csrString = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	_, err = formRequest(data, &role, true, integrationTestEnv.Backend.Logger())
+	if err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Fatalf("Expecting an invalid signature error but got %v", err)
+	}
+}
+
+func TestValidateCSRKeyType(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "tpp.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validateCSR(&roleEntry{AllowedKeyTypes: []string{"ec"}}, csr); err != nil {
+		t.Fatal(err)
+	}
+	err = validateCSR(&roleEntry{AllowedKeyTypes: []string{"rsa"}}, csr)
+	if err == nil || err.Error() != fmt.Sprintf(errorTextCSRKeyTypeNotAllowed, "ec", "rsa") {
+		t.Fatalf("Expecting error %s for an EC CSR but got %v", errorTextCSRKeyTypeNotAllowed, err)
+	}
+}
+
+func TestSANChangeWarnings(t *testing.T) {
+	if !cnAddedToSANs(requestData{commonName: "a.example.com", altNames: []string{"b.example.com"}}, false) {
+		t.Fatalf("Expecting the common name to be added to SANs that don't have it")
+	}
+	if cnAddedToSANs(requestData{commonName: "a.example.com", altNames: []string{"A.example.com"}}, false) ||
+		cnAddedToSANs(requestData{commonName: "a.example.com", omitCNFromSANs: true}, false) ||
+		cnAddedToSANs(requestData{commonName: "a.example.com"}, true) {
+		t.Fatalf("Expecting the common name not to be added")
+	}
+
+	certReq := &certificate.Request{
+		DNSNames:       []string{"a.example.com", "b.example.com"},
+		EmailAddresses: []string{"admin@example.com"},
+	}
+	cert := &x509.Certificate{
+		DNSNames:       []string{"A.example.com", "c.example.com"},
+		EmailAddresses: []string{"admin@example.com"},
+	}
+	warnings := sanChangeWarnings(certReq, cert)
+	expected := []string{
+		"The SAN b.example.com was removed by the zone policy.",
+		"The SAN c.example.com was added by Venafi.",
+	}
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expecting warnings %q but got %q", expected, warnings)
+	}
+}
+
+func TestFriendlyNameInRequest(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role roleEntry
+	role.KeyType = "rsa"
+	role.ChainOption = "first"
+
+	var data requestData
+	data.commonName = "tpp.example.com"
+	data.friendlyName = "tpp.example.com (web)"
+
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certReq.FriendlyName != data.friendlyName {
+		t.Fatalf("Expecting friendly name %s but got %s", data.friendlyName, certReq.FriendlyName)
+	}
+
+	data.friendlyName = `folder\tpp.example.com`
+	if _, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger()); err == nil {
+		t.Fatalf("Expecting friendly name %s to be rejected", data.friendlyName)
+	}
+}
+
+func TestAddWildcardApex(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	role := roleEntry{KeyType: "rsa", ChainOption: "first", AddWildcardApex: true}
+	data := requestData{commonName: "*.example.com", altNames: []string{"*.api.example.com", "www.example.com"}}
+	certReq, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"*.api.example.com", "www.example.com", "*.example.com", "example.com", "api.example.com"}
+	if strings.Join(certReq.DNSNames, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expecting DNS names %v but got %v", expected, certReq.DNSNames)
+	}
+
+	//the apex must be allowed like any other requested name
+	role.AllowedDomains = []string{"example.com"}
+	role.AllowSubdomains = true
+	if _, err := formRequest(data, &role, false, integrationTestEnv.Backend.Logger()); err == nil {
+		t.Fatal("Expecting the apex domain to be rejected when the role doesn't allow bare domains")
+	}
+
+	role = roleEntry{KeyType: "rsa", ChainOption: "first"}
+	certReq, err = formRequest(data, &role, false, integrationTestEnv.Backend.Logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sliceContainsFold(certReq.DNSNames, "example.com") {
+		t.Fatalf("Expecting no apex domain without add_wildcard_apex but got %v", certReq.DNSNames)
+	}
 }
@@ -0,0 +1,209 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathVenafiCertImport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "import/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: `The role the imported certificate is stored with`,
+			},
+			"certificate": {
+				Type:        framework.TypeString,
+				Description: `The PEM certificate issued by Venafi outside Vault`,
+			},
+			"certificate_chain": {
+				Type:        framework.TypeString,
+				Description: `The PEM chain of the certificate, if any`,
+			},
+			"private_key": {
+				Type: framework.TypeString,
+				Description: `The unencrypted PEM private key of the certificate, kept when the role stores private keys so
+the certificate can be renewed without a CSR`,
+			},
+			"thumbprint": {
+				Type:        framework.TypeString,
+				Description: `The SHA-1 thumbprint of the certificate in Venafi, checked against the certificate`,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathVenafiCertImport,
+		},
+
+		HelpSynopsis:    pathVenafiCertImportHelpSyn,
+		HelpDescription: pathVenafiCertImportHelpDesc,
+	}
+}
+
+func (b *backend) pathVenafiCertImport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, roleName)), nil
+	}
+	if role.NoStore {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextImportNoStore, roleName)), nil
+	}
+
+	certPEM := strings.TrimSpace(data.Get("certificate").(string))
+	if certPEM == "" {
+		return logical.ErrorResponse(`"certificate" is required`), nil
+	}
+	cert := parsePEMCertificate(certPEM)
+	if cert == nil {
+		return logical.ErrorResponse(errorTextImportInvalidCertificate), nil
+	}
+	serialNumber, err := certSerialNumber(cert)
+	if err != nil {
+		return nil, err
+	}
+	thumbprint, err := certificateThumbprint(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	if given := normalizeFingerprint(data.Get("thumbprint").(string)); given != "" && !strings.EqualFold(given, thumbprint) {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextImportThumbprintMismatch, given, thumbprint)), nil
+	}
+	//the role can't be used to store certificates for names it couldn't issue
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	if err := validateWildcards(role, names); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := validateAllowedNames(role, append(names, cert.EmailAddresses...)); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := validateAllowedURISANs(role, cert.URIs); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	var chain []string
+	if chainPEM := strings.TrimSpace(data.Get("certificate_chain").(string)); chainPEM != "" {
+		chain, err = splitPEMCertificates(chainPEM)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	var warnings []string
+	var storedPrivateKey string
+	if keyPEM := strings.TrimSpace(data.Get("private_key").(string)); keyPEM != "" {
+		key, err := parsePrivateKeyPEM(keyPEM, "")
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(`invalid "private_key": %s`, err)), nil
+		}
+		certKeyID, err := publicKeyID(cert.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		keyID, err := publicKeyID(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		if certKeyID != keyID {
+			return logical.ErrorResponse(errorTextImportKeyMismatch), nil
+		}
+		if role.StorePrivateKey {
+			storedPrivateKey = keyPEM
+		} else {
+			warnings = append(warnings, `The private key was not stored, the role doesn't have "store_pkey" set.`)
+		}
+	}
+
+	path := certStoragePath(role.StoreBy, cert.Subject.CommonName, serialNumber)
+	existing, err := req.Storage.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextImportExists, path)), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(path, VenafiCert{
+		Certificate:       certPEM,
+		CertificateChain:  strings.Join(append([]string{certPEM}, chain...), "\n"),
+		PrivateKey:        storedPrivateKey,
+		SerialNumber:      serialNumber,
+		Thumbprint:        thumbprint,
+		Expiration:        cert.NotAfter.Unix(),
+		Role:              roleName,
+		IssuedAt:          time.Now().Unix(),
+		RequestedBy:       requestedBy(req),
+		RequestedByEntity: req.EntityID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.Logger().Debug(fmt.Sprintf("Importing certificate %s to %s", serialNumber, path))
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	if err := indexCertByCN(ctx, req.Storage, cert, path); err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"common_name":     cert.Subject.CommonName,
+			"serial_number":   serialNumber,
+			"certificate_uid": strings.TrimPrefix(path, "certs/"),
+			"expiration":      cert.NotAfter.Unix(),
+		},
+	}
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
+	return resp, nil
+}
+
+// splitPEMCertificates returns each certificate of a PEM chain as its own PEM, failing on anything else
+func splitPEMCertificates(chainPEM string) ([]string, error) {
+	var certs []string
+	rest := []byte(chainPEM)
+	for {
+		block, remaining := pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf(errorTextImportInvalidChain)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return nil, fmt.Errorf(errorTextImportInvalidChain)
+		}
+		certs = append(certs, strings.TrimSpace(string(pem.EncodeToMemory(block))))
+		rest = remaining
+	}
+	if len(certs) == 0 || strings.TrimSpace(string(rest)) != "" {
+		return nil, fmt.Errorf(errorTextImportInvalidChain)
+	}
+	return certs, nil
+}
+
+const (
+	errorTextImportNoStore            = `role %s has "no_store" set, certificates can't be imported with it`
+	errorTextImportInvalidCertificate = `"certificate" is not a valid PEM certificate`
+	errorTextImportInvalidChain       = `"certificate_chain" must only contain PEM certificates`
+	errorTextImportThumbprintMismatch = `"thumbprint" %s doesn't match the certificate thumbprint %s`
+	errorTextImportKeyMismatch        = `"private_key" doesn't match the public key of the certificate`
+	errorTextImportExists             = `a certificate is already stored at %s`
+
+	pathVenafiCertImportHelpSyn  = `Import a certificate issued by Venafi outside Vault.`
+	pathVenafiCertImportHelpDesc = `This path stores a certificate issued by Venafi outside Vault like the certificates issued with the
+role, so it can be listed, read, renewed and revoked. Its names must be allowed by the role. Its private key, which must
+match the certificate, is kept when the role stores private keys, so the certificate can be renewed without a new CSR.`
+)
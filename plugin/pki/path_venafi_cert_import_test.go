@@ -0,0 +1,111 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestImportCertificate(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, s := integrationTestEnv.Context, integrationTestEnv.Storage
+
+	for name, role := range map[string]roleEntry{
+		"import":     {StoreBy: storeBySerialString, StorePrivateKey: true},
+		"no-store":   {NoStore: true},
+		"restricted": {AllowedDomains: []string{"example.org"}, AllowSubdomains: true},
+	} {
+		entry, err := logical.StorageEntryJSON("role/"+name, role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rootPEM, root, rootKey := issueTestCertificate(t, 1, "Test Root", true, nil, nil)
+	certPEM, cert, key := issueTestCertificate(t, 0x1234, "import.example.com", false, root, rootKey)
+	_, _, otherKey := issueTestCertificate(t, 3, "other.example.com", false, nil, nil)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	otherKeyDER, err := x509.MarshalECPrivateKey(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKeyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: otherKeyDER}))
+	thumbprint, err := certificateThumbprint(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importCert := func(role string, data map[string]interface{}) *logical.Response {
+		resp, err := integrationTestEnv.Backend.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "import/" + role,
+			Storage:   s,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	rejected := map[string]map[string]interface{}{
+		"not a certificate": {"certificate": "garbage"},
+		"wrong key":         {"certificate": certPEM, "private_key": otherKeyPEM},
+		"wrong thumbprint":  {"certificate": certPEM, "thumbprint": strings.Repeat("AB", 20)},
+		"invalid chain":     {"certificate": certPEM, "certificate_chain": keyPEM},
+	}
+	for reason, data := range rejected {
+		if resp := importCert("import", data); resp == nil || !resp.IsError() {
+			t.Fatalf("Expecting the import to be rejected for %s but got %#v", reason, resp)
+		}
+	}
+	if resp := importCert("no-store", map[string]interface{}{"certificate": certPEM}); resp == nil || !resp.IsError() {
+		t.Fatalf("Expecting the import to be rejected by a no_store role but got %#v", resp)
+	}
+	if resp := importCert("restricted", map[string]interface{}{"certificate": certPEM}); resp == nil || !resp.IsError() {
+		t.Fatalf("Expecting the import of a certificate for a domain the role doesn't allow to be rejected but got %#v", resp)
+	}
+
+	resp := importCert("import", map[string]interface{}{
+		"certificate":       certPEM,
+		"certificate_chain": rootPEM,
+		"private_key":       keyPEM,
+		"thumbprint":        strings.ToLower(thumbprint),
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to import certificate: %#v", resp)
+	}
+	serialNumber, err := certSerialNumber(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["serial_number"] != serialNumber {
+		t.Fatalf("Expecting serial number %s but got %#v", serialNumber, resp.Data)
+	}
+
+	stored, _, err := getStoredCert(ctx, s, serialNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.Role != "import" || stored.PrivateKey == "" ||
+		!strings.Contains(stored.CertificateChain, strings.TrimSpace(rootPEM)) {
+		t.Fatalf("Expecting the certificate to be stored with its key and chain but got %#v", stored)
+	}
+
+	if resp := importCert("import", map[string]interface{}{"certificate": certPEM}); resp == nil || !resp.IsError() {
+		t.Fatalf("Expecting a second import of the certificate to be rejected but got %#v", resp)
+	}
+}
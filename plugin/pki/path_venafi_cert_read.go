@@ -5,16 +5,27 @@ import (
 	"fmt"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	"net/http"
 )
 
 func pathVenafiCertRead(b *backend) *framework.Path {
 	return &framework.Path{
-		Pattern: "cert/" + framework.GenericNameRegex("certificate_uid"),
+		Pattern: "cert/" + framework.MatchAllRegex("certificate_uid"),
 		Fields: map[string]*framework.FieldSchema{
 			"certificate_uid": {
 				Type:        framework.TypeString,
 				Description: "Common name or serial number of desired certificate",
 			},
+			"include_private_key": {
+				Type:        framework.TypeBool,
+				Description: "Return the stored private key along with the certificate",
+			},
+			"format": {
+				Type: framework.TypeString,
+				Description: `Format for returned data. Can be "pem", "der" or "pem_bundle". With "der" the certificates and private
+key are base64 encoded DER. With "pem_bundle" the "bundle" field holds the certificate chain and private key in a single PEM`,
+				Default: formatPEM,
+			},
 		},
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation: b.pathVenafiCertRead,
@@ -33,33 +44,68 @@ func (b *backend) pathVenafiCertRead(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse("no common name specified on certificate"), nil
 	}
 
-	path := "certs/" + certUID
-
-	entry, err := req.Storage.Get(ctx, path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read Venafi certificate: %s", err)
-	}
-
-	if entry == nil {
-		return nil, fmt.Errorf("no entry found in path %s", path)
-	}
-
-	var cert VenafiCert
 	b.Logger().Debug("Getting venafi certificate")
-
-	if err := entry.DecodeJSON(&cert); err != nil {
-		b.Logger().Error("error reading venafi configuration: %s", err)
+	cert, path, err := getStoredCert(ctx, req.Storage, certUID)
+	if err != nil {
+		b.Logger().Error("error reading venafi certificate", "error", err)
 		return nil, err
 	}
-	b.Logger().Debug("certificate is:" + cert.Certificate)
-	b.Logger().Debug("chain is:" + cert.CertificateChain)
+	if cert == nil {
+		return nil, logical.CodedError(http.StatusNotFound, fmt.Sprintf("no entry found in path %s", path))
+	}
+	b.Logger().Debug("Read certificate with serial number " + cert.SerialNumber)
 
 	respData := map[string]interface{}{
 		"certificate_uid":   certUID,
 		"serial_number":     cert.SerialNumber,
 		"certificate_chain": cert.CertificateChain,
 		"certificate":       cert.Certificate,
-		"private_key":       cert.PrivateKey,
+		"expiration":        cert.Expiration,
+	}
+	if data.Get("include_private_key").(bool) {
+		respData["private_key"] = cert.PrivateKey
+	}
+	switch data.Get("format").(string) {
+	case formatPEM:
+	case formatDER:
+		if err := derResponseData(respData); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	case formatPEMBundle:
+		//the stored chain starts with the certificate
+		privateKey, _ := respData["private_key"].(string)
+		respData["bundle"], err = pemBundle(defaultBundleOrder, "", []string{cert.CertificateChain}, privateKey)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return logical.ErrorResponse(fmt.Sprintf(errorTextInvalidReadFormat, data.Get("format").(string))), nil
+	}
+	if cert.CertificateDN != "" {
+		respData["certificate_dn"] = cert.CertificateDN
+	}
+	if cert.Thumbprint != "" {
+		respData["thumbprint"] = cert.Thumbprint
+	}
+	if cert.PickupID != "" {
+		respData["pickup_id"] = cert.PickupID
+	}
+	if cert.Role != "" {
+		respData["role"] = cert.Role
+	}
+	if cert.IssuedAt != 0 {
+		respData["issued_at"] = cert.IssuedAt
+	}
+	if cert.RequestedBy != "" {
+		respData["requested_by"] = cert.RequestedBy
+	}
+	if cert.RequestedByEntity != "" {
+		respData["requested_by_entity"] = cert.RequestedByEntity
+	}
+	respData["revoked"] = cert.RevocationTime != 0
+	if cert.RevocationTime != 0 {
+		respData["revocation_time"] = cert.RevocationTime
+		respData["revocation_reason"] = cert.RevocationReason
 	}
 
 	return &logical.Response{
@@ -67,3 +113,39 @@ func (b *backend) pathVenafiCertRead(ctx context.Context, req *logical.Request,
 		Data: respData,
 	}, nil
 }
+
+// getStoredCert reads a certificate stored by common name or serial number. Serial numbers are stored lowercase with
+// dashes but are usually given as returned on issue, so they're normalized when not found as given. The storage path
+// is returned along with it, also when there's no certificate.
+func getStoredCert(ctx context.Context, s logical.Storage, certUID string) (*VenafiCert, string, error) {
+	path := "certs/" + certUID
+	entry, err := s.Get(ctx, path)
+	if err != nil {
+		return nil, path, fmt.Errorf("failed to read Venafi certificate: %s", err)
+	}
+
+	if serialPath := certStoragePath(storeBySerialString, "", certUID); entry == nil && serialPath != path {
+		path = serialPath
+		entry, err = s.Get(ctx, path)
+		if err != nil {
+			return nil, path, fmt.Errorf("failed to read Venafi certificate: %s", err)
+		}
+	}
+	if entry == nil {
+		return nil, path, nil
+	}
+
+	var cert VenafiCert
+	if err := entry.DecodeJSON(&cert); err != nil {
+		return nil, path, err
+	}
+	//certificates stored by earlier versions have no expiration
+	if cert.Expiration == 0 {
+		if parsed := parsePEMCertificate(cert.Certificate); parsed != nil {
+			cert.Expiration = parsed.NotAfter.Unix()
+		}
+	}
+	return &cert, path, nil
+}
+
+const errorTextInvalidReadFormat = `invalid format %s, can be "pem", "der" or "pem_bundle"`
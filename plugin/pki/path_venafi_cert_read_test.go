@@ -0,0 +1,162 @@
+package pki
+
+import (
+	"context"
+	"github.com/hashicorp/vault/sdk/logical"
+	"strings"
+	"testing"
+)
+
+func TestStoredCertSerialRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s := &logical.InmemStorage{}
+	certPEM, cert, _ := issueTestCertificate(t, 0x1a2b3c4d5e, "serial.example.com", false, nil, nil)
+
+	serialNumber, err := certSerialNumber(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serialNumber != "1a:2b:3c:4d:5e" {
+		t.Fatalf("Expecting colon separated serial number but got %s", serialNumber)
+	}
+
+	entry, err := logical.StorageEntryJSON(certStoragePath(storeBySerialString, cert.Subject.CommonName, serialNumber),
+		VenafiCert{Certificate: certPEM, SerialNumber: serialNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, certUID := range []string{serialNumber, strings.ToUpper(serialNumber), normalizeSerial(serialNumber)} {
+		stored, path, err := getStoredCert(ctx, s, certUID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored == nil || stored.SerialNumber != serialNumber {
+			t.Fatalf("Expecting certificate stored at %s to be read by serial number %s", path, certUID)
+		}
+	}
+
+	if path := certStoragePath(storeByCNString, cert.Subject.CommonName, serialNumber); path != "certs/serial.example.com" {
+		t.Fatalf("Expecting certificate stored by common name but got %s", path)
+	}
+}
+
+func TestStoredCertMetadata(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, s := integrationTestEnv.Context, integrationTestEnv.Storage
+	certPEM, _, _ := issueTestCertificate(t, 1, "metadata.example.com", false, nil, nil)
+
+	entry, err := logical.StorageEntryJSON("certs/metadata.example.com", VenafiCert{
+		Certificate:       certPEM,
+		Role:              "web",
+		IssuedAt:          1600000000,
+		RequestedBy:       "token-ci",
+		RequestedByEntity: "entity-id",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := integrationTestEnv.Backend.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "cert/metadata.example.com",
+		Storage:   s,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["role"] != "web" || resp.Data["issued_at"] != int64(1600000000) || resp.Data["requested_by"] != "token-ci" ||
+		resp.Data["requested_by_entity"] != "entity-id" {
+		t.Fatalf("Expecting the certificate metadata to be read but got %#v", resp.Data)
+	}
+
+	resp, err = integrationTestEnv.Backend.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "certs/",
+		Storage:   s,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resp.Data["key_info"]; ok {
+		t.Fatalf("Expecting the certificates to be listed without reading them unless key_info is set but got %#v", resp.Data)
+	}
+
+	resp, err = integrationTestEnv.Backend.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "certs/",
+		Storage:   s,
+		Data:      map[string]interface{}{"key_info": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := resp.Data["key_info"].(map[string]interface{})["metadata.example.com"].(map[string]interface{})
+	if info["role"] != "web" || info["requested_by"] != "token-ci" || info["requested_by_entity"] != "entity-id" {
+		t.Fatalf("Expecting the certificate metadata to be listed but got %#v", info)
+	}
+}
+
+func TestRequestedBy(t *testing.T) {
+	if by := requestedBy(&logical.Request{DisplayName: "token-ci", EntityID: "entity-id"}); by != "token-ci" {
+		t.Fatalf("Expecting the display name but got %s", by)
+	}
+	if by := requestedBy(&logical.Request{EntityID: "entity-id"}); by != "entity-id" {
+		t.Fatalf("Expecting the entity ID but got %s", by)
+	}
+
+	if tag := requesterTag(&logical.Request{DisplayName: "token-ci", EntityID: "entity-id"}); tag != "token-ci (entity-id)" {
+		t.Fatalf("Expecting the display name and entity ID but got %s", tag)
+	}
+	if tag := requesterTag(&logical.Request{DisplayName: "token-ci"}); tag != "token-ci" {
+		t.Fatalf("Expecting the display name but got %s", tag)
+	}
+}
+
+func TestReadCertFormat(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, s := integrationTestEnv.Context, integrationTestEnv.Storage
+	certPEM, _, _ := issueTestCertificate(t, 1, "format.example.com", false, nil, nil)
+
+	entry, err := logical.StorageEntryJSON("certs/format.example.com", VenafiCert{Certificate: certPEM, CertificateChain: certPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(format string) *logical.Response {
+		resp, err := integrationTestEnv.Backend.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "cert/format.example.com",
+			Storage:   s,
+			Data:      map[string]interface{}{"format": format},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if certDER, ok := read(formatDER).Data["certificate"].(string); !ok || strings.Contains(certDER, "BEGIN CERTIFICATE") {
+		t.Fatalf("Expecting the certificate to be read in DER but got %#v", certDER)
+	}
+	if bundle, ok := read(formatPEMBundle).Data["bundle"].(string); !ok || !strings.Contains(bundle, "BEGIN CERTIFICATE") {
+		t.Fatalf("Expecting the certificate to be read in a bundle but got %#v", bundle)
+	}
+	if resp := read("p12"); !resp.IsError() {
+		t.Fatalf("Expecting an invalid format to be refused but got %#v", resp.Data)
+	}
+}
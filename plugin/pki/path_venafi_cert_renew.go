@@ -0,0 +1,288 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+	"strings"
+	"time"
+)
+
+func pathVenafiCertRenew(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "renew/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: `The desired role with configuration for this request`,
+			},
+			"certificate_uid": {
+				Type:        framework.TypeString,
+				Description: "Common name or serial number of the stored certificate to renew",
+			},
+			"csr": {
+				Type: framework.TypeString,
+				Description: `PEM-format CSR for the renewed certificate. Required when the certificate was stored without
+its private key, otherwise a new key is generated`,
+			},
+			"key_password": {
+				Type:        framework.TypeString,
+				Description: "Password for encrypting the new private key",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathVenafiCertRenew,
+		},
+
+		HelpSynopsis:    pathVenafiCertRenewHelpSyn,
+		HelpDescription: pathVenafiCertRenewHelpDesc,
+	}
+}
+
+func (b *backend) pathVenafiCertRenew(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, roleName)), nil
+	}
+	//like issue requests, renewals that store the certificate are forwarded to the primary by performance standbys so
+	//the certificate isn't renewed twice
+	if !role.NoStore && b.System().ReplicationState().
+		HasState(consts.ReplicationPerformanceStandby|consts.ReplicationPerformanceSecondary) {
+		return nil, logical.ErrReadOnly
+	}
+
+	certUID := data.Get("certificate_uid").(string)
+	if certUID == "" {
+		return logical.ErrorResponse("no certificate_uid specified"), nil
+	}
+	stored, _, err := getStoredCert(ctx, req.Storage, certUID)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return logical.ErrorResponse(fmt.Sprintf("no certificate found for %s", certUID)), nil
+	}
+	//a role can't be used to renew, under its own restrictions, certificates issued by other roles
+	if stored.Role != roleName {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextRenewRoleMismatch, certUID, roleName)), nil
+	}
+
+	storedCert := parsePEMCertificate(stored.Certificate)
+	if storedCert == nil {
+		return nil, fmt.Errorf("failed to parse stored certificate %s", certUID)
+	}
+	thumbprint, err := stored.thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	certReq, err := renewalRequest(role, storedCert, stored, data.Get("csr").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	certReq.ChainOption, err = parseChainOption(role.ChainOption)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	localKey := certReq.CsrOrigin == certificate.LocalGeneratedCSR
+	keyPassword := data.Get("key_password").(string)
+	if localKey {
+		if err := b.generatePrivateKey(ctx, roleName, role, certReq); err != nil {
+			return venafiErrorResponse(err, err.Error())
+		}
+		if err := certReq.GenerateCSR(); err != nil {
+			return nil, err
+		}
+		if role.SignatureAlgorithm != "" {
+			if err := signCSRWithAlgorithm(certReq, role.SignatureAlgorithm); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+	}
+
+	cl, timeout, err := b.ClientVenafi(ctx, req.Storage, data, req, roleName)
+	if err != nil {
+		return venafiErrorResponse(err, err.Error())
+	}
+
+	b.Logger().Debug(fmt.Sprintf("Renewing certificate %s", certUID))
+	var requestID string
+	err = b.withReauthentication(ctx, req, data, roleName, &cl, func(cl endpoint.Connector) error {
+		return b.retryOnTransientError(ctx, role, "Certificate renewal", func() (err error) {
+			return b.withRequestSlot(ctx, func() (err error) {
+				requestID, err = cl.RenewCertificate(&certificate.RenewalRequest{
+					CertificateDN:      stored.CertificateDN,
+					Thumbprint:         thumbprint,
+					CertificateRequest: certReq,
+				})
+				return err
+			})
+		})
+	})
+	if err != nil {
+		return venafiErrorResponse(err, fmt.Sprintf("failed to renew certificate %s: %s", certUID, err))
+	}
+
+	var pcc *certificate.PEMCollection
+	err = b.retryOnTransientError(ctx, role, "Certificate retrieval", func() (err error) {
+		pcc, err = b.retrieveCertificate(ctx, cl, roleName, role, &certificate.Request{PickupID: requestID, ChainOption: certReq.ChainOption, Timeout: timeout}, timeout)
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return venafiErrorResponse(err, err.Error())
+	}
+
+	if localKey {
+		pcc.PrivateKey, err = encodePrivateKey(certReq.PrivateKey, role.PrivateKeyFormat, keyPassword)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	parsedCertificate, err := parseIssuedCertificate(pcc.Certificate)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	serialNumber, err := certSerialNumber(parsedCertificate)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateIssuedCertificate(role.PostIssuanceValidators, parsedCertificate, pcc.Chain); err != nil {
+		b.Logger().Error(fmt.Sprintf("Certificate %s was renewed but not returned: %s", serialNumber, err))
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	chain := strings.Join(append([]string{pcc.Certificate}, pcc.Chain...), "\n")
+	certDN := certificateDN(cl.GetType(), requestID)
+
+	if !role.NoStore {
+		renewedThumbprint, err := certificateThumbprint(pcc.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		renewed := VenafiCert{
+			Certificate:       pcc.Certificate,
+			CertificateChain:  chain,
+			SerialNumber:      serialNumber,
+			CertificateDN:     certDN,
+			Thumbprint:        renewedThumbprint,
+			PickupID:          requestID,
+			Expiration:        parsedCertificate.NotAfter.Unix(),
+			Role:              roleName,
+			IssuedAt:          time.Now().Unix(),
+			RequestedBy:       requestedBy(req),
+			RequestedByEntity: req.EntityID,
+		}
+		if role.StorePrivateKey && localKey {
+			renewed.PrivateKey = pcc.PrivateKey
+		}
+		//the renewed certificate replaces the stored one when stored by common name
+		path := certStoragePath(role.StoreBy, parsedCertificate.Subject.CommonName, serialNumber)
+		entry, err := logical.StorageEntryJSON(path, renewed)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			b.Logger().Error("Error putting entry to storage: " + err.Error())
+			return nil, err
+		}
+		if err := indexCertByCN(ctx, req.Storage, parsedCertificate, path); err != nil {
+			return nil, err
+		}
+	}
+
+	respData := map[string]interface{}{
+		"common_name":       parsedCertificate.Subject.CommonName,
+		"serial_number":     serialNumber,
+		"certificate_chain": chain,
+		"certificate":       pcc.Certificate,
+		"ca_chain":          pcc.Chain,
+		"issuing_ca":        findIssuingCA(pcc.Certificate, pcc.Chain),
+		"expiration":        parsedCertificate.NotAfter.Unix(),
+		"renewed_serial":    stored.SerialNumber,
+	}
+	addRenewAfter(respData, parsedCertificate, role)
+	returnPrivateKey := localKey && role.returnPrivateKey()
+	if returnPrivateKey {
+		respData["private_key"] = pcc.PrivateKey
+		respData["private_key_type"] = privateKeyType(certReq.PrivateKey)
+	}
+	if certDN != "" {
+		respData["certificate_dn"] = certDN
+	}
+	respData["pickup_id"] = requestID
+
+	resp := &logical.Response{
+		Data: respData,
+	}
+	if returnPrivateKey {
+		resp.AddWarning(warningTextPrivateKeyACL)
+	}
+	b.Logger().Debug(fmt.Sprintf("Certificate %s renewed as %s, expiring at %s", stored.SerialNumber, serialNumber,
+		parsedCertificate.NotAfter.Format(time.RFC3339)))
+	return resp, nil
+}
+
+// renewalRequest builds the request for the renewed certificate. A submitted CSR is used as is. Otherwise a new key of
+// the role type is generated for the subject and SANs of the stored certificate, but only when the backend stored its
+// private key; a certificate stored without it has its key kept outside Vault, so its owner has to submit a CSR.
+func renewalRequest(role *roleEntry, storedCert *x509.Certificate, stored *VenafiCert, csrString string) (*certificate.Request, error) {
+	if csrString != "" {
+		pemBlock, _ := pem.Decode([]byte(csrString))
+		if pemBlock == nil {
+			return nil, fmt.Errorf("csr contains no data")
+		}
+		csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse provided CSR %v", err)
+		}
+		if err := csr.CheckSignature(); err != nil {
+			return nil, fmt.Errorf("provided CSR has an invalid signature: %v", err)
+		}
+		if err := validateCSR(role, csr); err != nil {
+			return nil, err
+		}
+		certReq := &certificate.Request{CsrOrigin: certificate.UserProvidedCSR}
+		if err := certReq.SetCSR([]byte(csrString)); err != nil {
+			return nil, err
+		}
+		return certReq, nil
+	}
+
+	if stored.PrivateKey == "" {
+		return nil, fmt.Errorf(errorTextRenewRequiresCSR)
+	}
+
+	certReq := certificate.NewRequest(storedCert)
+	certReq.CsrOrigin = certificate.LocalGeneratedCSR
+	//the signature algorithm follows the new key, which may be of a different type
+	certReq.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+	if err := applyRoleKeyParams(certReq, role); err != nil {
+		return nil, err
+	}
+	return certReq, nil
+}
+
+const (
+	errorTextRenewRequiresCSR  = `the certificate was stored without its private key, provide a new "csr" to renew it`
+	errorTextRenewRoleMismatch = "certificate %s wasn't issued by role %s"
+)
+
+const (
+	pathVenafiCertRenewHelpSyn  = `Renew a certificate stored by the backend.`
+	pathVenafiCertRenewHelpDesc = `This path renews in Venafi a certificate stored by common name or serial number. When its private key
+was stored a new key is generated for the renewed certificate, otherwise a new CSR must be submitted. The renewed
+certificate is stored according to the role "store_by" option.`
+)
@@ -0,0 +1,96 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/hashicorp/vault/sdk/logical"
+	"testing"
+)
+
+func TestRenewalRequest(t *testing.T) {
+	_, root, rootKey := issueTestCertificate(t, 1, "Test Root", true, nil, nil)
+	certPEM, cert, _ := issueTestCertificate(t, 2, "renew.example.com", false, root, rootKey)
+	role := &roleEntry{KeyType: "rsa", KeyBits: 3072}
+
+	_, err := renewalRequest(role, cert, &VenafiCert{Certificate: certPEM}, "")
+	if err == nil || err.Error() != errorTextRenewRequiresCSR {
+		t.Fatalf("Expecting error %s for a certificate stored without key but got %v", errorTextRenewRequiresCSR, err)
+	}
+
+	certReq, err := renewalRequest(role, cert, &VenafiCert{Certificate: certPEM, PrivateKey: "stored key"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certReq.CsrOrigin != certificate.LocalGeneratedCSR || certReq.Subject.CommonName != "renew.example.com" {
+		t.Fatalf("Expecting a local request for the stored certificate subject but got %#v", certReq)
+	}
+	if certReq.KeyType != certificate.KeyTypeRSA || certReq.KeyLength != 3072 {
+		t.Fatalf("Expecting a key of the role type but got %v with %d bits", certReq.KeyType, certReq.KeyLength)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "renew.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	certReq, err = renewalRequest(role, cert, &VenafiCert{Certificate: certPEM}, csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certReq.CsrOrigin != certificate.UserProvidedCSR || len(certReq.GetCSR()) == 0 {
+		t.Fatalf("Expecting the submitted CSR to be used but got %#v", certReq)
+	}
+
+	//the submitted CSR goes through the same restrictions as a CSR signed by the role
+	restricted := &roleEntry{KeyType: "rsa", KeyBits: 3072, AllowedDomains: []string{"example.org"}, AllowSubdomains: true}
+	_, err = renewalRequest(restricted, cert, &VenafiCert{Certificate: certPEM}, csrPEM)
+	if err == nil {
+		t.Fatal("Expecting a CSR for a domain the role doesn't allow to be refused")
+	}
+}
+
+func TestRenewRoleMismatch(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	certPEM, _, _ := issueTestCertificate(t, 3, "renew.example.com", false, nil, nil)
+	for path, value := range map[string]interface{}{
+		"role/issuer": roleEntry{},
+		"role/other":  roleEntry{},
+		"certs/03":    VenafiCert{Certificate: certPEM, SerialNumber: "03", Role: "issuer"},
+	} {
+		entry, err := logical.StorageEntryJSON(path, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "renew/other",
+		Storage:   storage,
+		Data:      map[string]interface{}{"certificate_uid": "03"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() || resp.Error().Error() != fmt.Sprintf(errorTextRenewRoleMismatch, "03", "other") {
+		t.Fatalf("Expecting error %s for a certificate of another role but got %#v", errorTextRenewRoleMismatch, resp)
+	}
+}
@@ -2,10 +2,27 @@ package pki
 
 import (
 	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	"strings"
+	"time"
 )
 
+// revocationReasons maps the revocation reasons accepted by the revoke path to the reasons of vcert
+var revocationReasons = map[string]string{
+	"unspecified":            "none",
+	"key-compromise":         "key-compromise",
+	"ca-compromise":          "ca-compromise",
+	"affiliation-changed":    "affiliation-changed",
+	"superseded":             "superseded",
+	"cessation-of-operation": "cessation-of-operation",
+}
+
 func pathVenafiCertRevoke(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "revoke/" + framework.GenericNameRegex("role"),
@@ -16,18 +33,187 @@ func pathVenafiCertRevoke(b *backend) *framework.Path {
 			},
 			"certificate_uid": {
 				Type:        framework.TypeString,
-				Description: "Common name for created certificate",
+				Description: "Common name or serial number of the stored certificate to revoke, or its TPP certificate DN",
+			},
+			"reason": {
+				Type: framework.TypeString,
+				Description: `The reason of the revocation: unspecified, key-compromise, ca-compromise, affiliation-changed,
+superseded or cessation-of-operation. Defaults to unspecified`,
+				Default: "unspecified",
+			},
+			"disable": {
+				Type:        framework.TypeBool,
+				Description: `Disable the certificate in TPP after revoking it so it can't be renewed or reissued`,
 			},
 		},
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.venafiCertRevoke,
 		},
 
-		HelpSynopsis:    pathConfigRootHelpSyn,
-		HelpDescription: pathConfigRootHelpDesc,
+		HelpSynopsis:    pathVenafiCertRevokeHelpSyn,
+		HelpDescription: pathVenafiCertRevokeHelpDesc,
 	}
 }
 
 func (b *backend) venafiCertRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	return nil, nil
+	roleName := d.Get("role").(string)
+	certUID := d.Get("certificate_uid").(string)
+	if certUID == "" {
+		return logical.ErrorResponse("no certificate_uid specified"), nil
+	}
+
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, roleName)), nil
+	}
+
+	reason := d.Get("reason").(string)
+	vcertReason, ok := revocationReasons[reason]
+	if !ok {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextInvalidRevocationReason, reason)), nil
+	}
+
+	stored, _, err := getStoredCert(ctx, req.Storage, certUID)
+	if err != nil {
+		return nil, err
+	}
+	//a role can't be used to revoke, with its own Venafi credentials, certificates issued by other roles, nor those
+	//whose role isn't known, e.g. stored by earlier versions
+	if stored != nil && stored.Role != roleName {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextRevokeRoleMismatch, certUID, roleName)), nil
+	}
+	if stored == nil && strings.HasPrefix(certUID, `\VED\`) && !role.RevokeByDN {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextRevokeByDNNotAllowed, roleName)), nil
+	}
+
+	revReq, err := revocationRequest(ctx, req.Storage, certUID)
+	if err != nil {
+		return nil, err
+	}
+	if revReq == nil {
+		return logical.ErrorResponse(fmt.Sprintf("no certificate found for %s", certUID)), nil
+	}
+	revReq.Reason = vcertReason
+	revReq.Disable = d.Get("disable").(bool)
+
+	cl, _, err := b.ClientVenafi(ctx, req.Storage, d, req, roleName)
+	if err != nil {
+		return venafiErrorResponse(err, err.Error())
+	}
+
+	b.Logger().Debug(fmt.Sprintf("Revoking certificate %s", certUID))
+	err = cl.RevokeCertificate(revReq)
+	if err != nil {
+		if isAlreadyRevoked(err) {
+			resp := &logical.Response{}
+			resp.AddWarning(fmt.Sprintf("certificate %s is already revoked: %s", certUID, err))
+			if err := markRevoked(ctx, req.Storage, certUID, reason, time.Now()); err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+		return venafiErrorResponse(err, fmt.Sprintf("failed to revoke certificate %s: %s", certUID, err))
+	}
+
+	revokedAt := time.Now()
+	if err := markRevoked(ctx, req.Storage, certUID, reason, revokedAt); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"certificate_uid": certUID,
+			"revoked":         true,
+			"revocation_time": revokedAt.Unix(),
+		},
+	}, nil
 }
+
+// markRevoked records the revocation on the stored certificate, if any. A certificate already marked keeps the time
+// it was first marked.
+func markRevoked(ctx context.Context, s logical.Storage, certUID string, reason string, revokedAt time.Time) error {
+	cert, path, err := getStoredCert(ctx, s, certUID)
+	if err != nil {
+		return err
+	}
+	if cert == nil || cert.RevocationTime != 0 {
+		return nil
+	}
+
+	cert.RevocationTime = revokedAt.Unix()
+	cert.RevocationReason = reason
+	entry, err := logical.StorageEntryJSON(path, cert)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// revocationRequest identifies the certificate to revoke by the TPP DN and thumbprint kept with the certificate stored
+// by common name or serial number, which don't depend on how the CA numbers its certificates. A TPP certificate DN can
+// be given as well for certificates that weren't stored.
+func revocationRequest(ctx context.Context, s logical.Storage, certUID string) (*certificate.RevocationRequest, error) {
+	cert, _, err := getStoredCert(ctx, s, certUID)
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		if strings.HasPrefix(certUID, `\VED\`) {
+			return &certificate.RevocationRequest{CertificateDN: certUID}, nil
+		}
+		return nil, nil
+	}
+
+	thumbprint, err := cert.thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	return &certificate.RevocationRequest{
+		CertificateDN: cert.CertificateDN,
+		Thumbprint:    thumbprint,
+	}, nil
+}
+
+// thumbprint returns the thumbprint stored with the certificate, or computes it for certificates stored by earlier
+// versions
+func (c *VenafiCert) thumbprint() (string, error) {
+	if c.Thumbprint != "" {
+		return c.Thumbprint, nil
+	}
+	return certificateThumbprint(c.Certificate)
+}
+
+// certificateThumbprint returns the SHA-1 fingerprint of a PEM certificate in the form used by Venafi
+func certificateThumbprint(certPEM string) (string, error) {
+	pemBlock, _ := pem.Decode([]byte(certPEM))
+	if pemBlock == nil {
+		return "", fmt.Errorf("failed to decode stored certificate")
+	}
+	if _, err := x509.ParseCertificate(pemBlock.Bytes); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(fmt.Sprintf("%x", sha1.Sum(pemBlock.Bytes))), nil
+}
+
+// isAlreadyRevoked validates if Venafi refused the revocation because the certificate was revoked before
+func isAlreadyRevoked(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already revoked") || strings.Contains(msg, "already been revoked")
+}
+
+const (
+	errorTextInvalidRevocationReason = `"reason" %q is not valid, use unspecified, key-compromise, ca-compromise, affiliation-changed, superseded or cessation-of-operation`
+	errorTextRevokeRoleMismatch      = "certificate %s wasn't issued by role %s"
+	errorTextRevokeByDNNotAllowed    = `role %s doesn't revoke certificates that weren't stored by their TPP certificate DN, set "revoke_by_dn" to allow it`
+
+	pathVenafiCertRevokeHelpSyn  = `Revoke a certificate in Venafi.`
+	pathVenafiCertRevokeHelpDesc = `This path revokes a certificate issued through the role. The certificate is looked up in the backend
+storage by common name or serial number to find its thumbprint and TPP certificate DN. A stored certificate issued by
+another role, or by an unknown role, is refused. The TPP certificate DN of a certificate that wasn't stored is only
+accepted by roles with "revoke_by_dn". Revoking a certificate that is already revoked returns a warning instead of an
+error. The stored certificate is marked as revoked with the time and reason of the revocation, which are returned when
+it's read.`
+)
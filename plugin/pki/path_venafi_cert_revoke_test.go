@@ -0,0 +1,291 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/hashicorp/vault/sdk/logical"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRevocationRequest(t *testing.T) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+
+	entry, err := logical.StorageEntryJSON("certs/aa-bb-cc", VenafiCert{
+		Certificate:   fake.CaCertPEM,
+		SerialNumber:  "aa:bb:cc",
+		CertificateDN: `\VED\Policy\devops\vcert\example.com`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	revReq, err := revocationRequest(ctx, storage, "AA:BB:CC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revReq == nil {
+		t.Fatal("stored certificate should be found by its serial number")
+	}
+	if revReq.CertificateDN != `\VED\Policy\devops\vcert\example.com` {
+		t.Fatalf("unexpected certificate DN %q", revReq.CertificateDN)
+	}
+	if len(revReq.Thumbprint) != 40 {
+		t.Fatalf("expected a SHA-1 thumbprint, got %q", revReq.Thumbprint)
+	}
+
+	//the thumbprint stored with the certificate is preferred
+	entry, err = logical.StorageEntryJSON("certs/dd-ee-ff", VenafiCert{
+		Certificate:   fake.CaCertPEM,
+		SerialNumber:  "dd:ee:ff",
+		CertificateDN: `\VED\Policy\devops\vcert\stored.example.com`,
+		Thumbprint:    "0123456789ABCDEF0123456789ABCDEF01234567",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	revReq, err = revocationRequest(ctx, storage, "dd:ee:ff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revReq == nil || revReq.Thumbprint != "0123456789ABCDEF0123456789ABCDEF01234567" ||
+		revReq.CertificateDN != `\VED\Policy\devops\vcert\stored.example.com` {
+		t.Fatalf("expected the stored thumbprint and DN to be used, got %#v", revReq)
+	}
+
+	revReq, err = revocationRequest(ctx, storage, `\VED\Policy\devops\vcert\other.example.com`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revReq == nil || revReq.CertificateDN != `\VED\Policy\devops\vcert\other.example.com` {
+		t.Fatalf("certificate DN should be used as is, got %#v", revReq)
+	}
+
+	revReq, err = revocationRequest(ctx, storage, "unknown.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revReq != nil {
+		t.Fatalf("unknown certificate shouldn't be found, got %#v", revReq)
+	}
+}
+
+func TestRevokeRoleMismatch(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	for path, value := range map[string]interface{}{
+		"role/issuer": roleEntry{},
+		"role/other":  roleEntry{},
+		"certs/aa-bb": VenafiCert{Certificate: fake.CaCertPEM, SerialNumber: "aa:bb", Role: "issuer"},
+		"certs/cc-dd": VenafiCert{Certificate: fake.CaCertPEM, SerialNumber: "cc:dd"},
+	} {
+		entry, err := logical.StorageEntryJSON(path, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revoke/other",
+		Storage:   storage,
+		Data:      map[string]interface{}{"certificate_uid": "aa:bb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() || resp.Error().Error() != fmt.Sprintf(errorTextRevokeRoleMismatch, "aa:bb", "other") {
+		t.Fatalf("Expecting error %s for a certificate of another role but got %#v", errorTextRevokeRoleMismatch, resp)
+	}
+	cert, _, err := getStoredCert(ctx, storage, "aa:bb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.RevocationTime != 0 {
+		t.Fatal("Expecting the certificate of another role not to be marked revoked")
+	}
+
+	//certificates stored by earlier versions don't know their role
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revoke/other",
+		Storage:   storage,
+		Data:      map[string]interface{}{"certificate_uid": "cc:dd"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() || resp.Error().Error() != fmt.Sprintf(errorTextRevokeRoleMismatch, "cc:dd", "other") {
+		t.Fatalf("Expecting error %s for a certificate without role but got %#v", errorTextRevokeRoleMismatch, resp)
+	}
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revoke/other",
+		Storage:   storage,
+		Data:      map[string]interface{}{"certificate_uid": `\VED\Policy\unstored.example.com`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() || resp.Error().Error() != fmt.Sprintf(errorTextRevokeByDNNotAllowed, "other") {
+		t.Fatalf("Expecting error %s for the DN of a certificate that wasn't stored but got %#v", errorTextRevokeByDNNotAllowed, resp)
+	}
+}
+
+func TestIsAlreadyRevoked(t *testing.T) {
+	if !isAlreadyRevoked(fmt.Errorf("Revocation error: Certificate is already revoked")) {
+		t.Fatal("already revoked certificate should be detected")
+	}
+	if isAlreadyRevoked(fmt.Errorf("Revocation error: Access denied")) {
+		t.Fatal("other revocation errors shouldn't be treated as already revoked")
+	}
+}
+
+func TestMarkRevoked(t *testing.T) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+
+	entry, err := logical.StorageEntryJSON("certs/aa-bb-cc", VenafiCert{
+		Certificate:  fake.CaCertPEM,
+		SerialNumber: "aa:bb:cc",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	revokedAt := time.Unix(1600000000, 0)
+	if err := markRevoked(ctx, storage, "AA:BB:CC", "key-compromise", revokedAt); err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := getStoredCert(ctx, storage, "aa-bb-cc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.RevocationTime != revokedAt.Unix() || cert.RevocationReason != "key-compromise" {
+		t.Fatalf("certificate should be marked revoked, got time %d and reason %q", cert.RevocationTime, cert.RevocationReason)
+	}
+	if cert.Certificate != fake.CaCertPEM {
+		t.Fatal("marking the certificate revoked shouldn't change the certificate")
+	}
+
+	if err := markRevoked(ctx, storage, "aa-bb-cc", "superseded", revokedAt.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err = getStoredCert(ctx, storage, "aa-bb-cc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.RevocationTime != revokedAt.Unix() || cert.RevocationReason != "key-compromise" {
+		t.Fatal("certificate already marked revoked should keep its revocation time and reason")
+	}
+
+	if err := markRevoked(ctx, storage, "unknown.example.com", "", revokedAt); err != nil {
+		t.Fatalf("unknown certificate shouldn't fail, got %s", err)
+	}
+}
+
+func TestRevokeOnLeaseEnd(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	//the role points to a Venafi secret that doesn't exist, so revoking in Venafi fails
+	revokeLease := func(revokeOnLeaseEnd bool) error {
+		entry, err := logical.StorageEntryJSON("role/lease", roleEntry{VenafiSecret: "missing-secret", RevokeOnLeaseEnd: revokeOnLeaseEnd})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+		_, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret: &logical.Secret{
+				InternalData: map[string]interface{}{
+					"secret_type":    SecretCertsType,
+					"role":           "lease",
+					"serial_number":  "aa:bb:cc",
+					"certificate_dn": `\VED\Policy\lease.example.com`,
+				},
+			},
+		})
+		return err
+	}
+	if err := revokeLease(false); err != nil {
+		t.Fatalf("Expecting the lease of a role without revoke_on_lease_end not to revoke the certificate, got %s", err)
+	}
+	if err := revokeLease(true); err == nil {
+		t.Fatal("Expecting the lease of a role with revoke_on_lease_end to revoke the certificate in Venafi")
+	}
+}
+
+func TestRevokeOnLeaseEndStoredByCN(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	var revoked bool
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/vedsdk/certificates/revoke" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		revoked = true
+		w.Write([]byte(`{"Success":true}`))
+	}))
+	defer server.Close()
+
+	for path, value := range map[string]interface{}{
+		"venafi/tpp": venafiSecretEntry{URL: server.URL + "/vedsdk", AccessToken: "secret-access-token", SkipTLSVerify: true},
+		"role/cn":    roleEntry{VenafiSecret: "tpp", StoreBy: storeByCNString, RevokeOnLeaseEnd: true},
+		"certs/lease.example.com": VenafiCert{Certificate: fake.CaCertPEM, SerialNumber: "aa:bb:cc", Role: "cn",
+			CertificateDN: `\VED\Policy\lease.example.com`},
+	} {
+		entry, err := logical.StorageEntryJSON(path, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	internalData := secretCertsInternalData("cn", "aa:bb:cc", `\VED\Policy\lease.example.com`, "",
+		`\VED\Policy\lease.example.com`, "certs/lease.example.com", time.Now().Add(time.Hour))
+	internalData["secret_type"] = SecretCertsType
+	_, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret:    &logical.Secret{InternalData: internalData},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Fatal("Expecting the certificate to be revoked in Venafi when its lease ends")
+	}
+	cert, _, err := getStoredCert(ctx, storage, "lease.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.RevocationTime == 0 {
+		t.Fatal("Expecting the certificate stored by common name to be marked revoked when its lease ends")
+	}
+}
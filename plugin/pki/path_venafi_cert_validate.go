@@ -0,0 +1,92 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathVenafiCertValidate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "validate/" + framework.GenericNameRegex("role"),
+		Fields:  pathVenafiCertEnroll(b).Fields,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathVenafiValidate,
+		},
+
+		HelpSynopsis:    pathVenafiCertValidateHelpSyn,
+		HelpDescription: pathVenafiCertValidateHelpDesc,
+	}
+}
+
+// pathVenafiValidate runs the checks of an issue request and builds its CSR without requesting the certificate. A
+// request rejected by the role or the zone policy isn't an error, it's returned as not valid with the reason.
+func (b *backend) pathVenafiValidate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, roleName)), nil
+	}
+	if role.KeyType == "any" && requestCSR(data) == "" {
+		return logical.ErrorResponse("role key type \"any\" not allowed for issuing certificates, only signing"), nil
+	}
+
+	resp, err := b.pathVenafiCertObtain(ctx, req, data, role, false, true, nil, 0)
+	if err != nil || resp == nil || !resp.IsError() {
+		return resp, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"valid":  false,
+			"reason": resp.Error().Error(),
+		},
+	}, nil
+}
+
+// validationResponse returns the subject, SANs and key of a request that would be accepted
+func validationResponse(certReq *certificate.Request, warnings []string) *logical.Response {
+	ipAddresses := make([]string, 0, len(certReq.IPAddresses))
+	for _, ip := range certReq.IPAddresses {
+		ipAddresses = append(ipAddresses, ip.String())
+	}
+	uriSANs := make([]string, 0, len(certReq.URIs))
+	for _, uri := range certReq.URIs {
+		uriSANs = append(uriSANs, uri.String())
+	}
+
+	respData := map[string]interface{}{
+		"valid":           true,
+		"subject":         certReq.Subject.String(),
+		"common_name":     certReq.Subject.CommonName,
+		"dns_names":       certReq.DNSNames,
+		"ip_addresses":    ipAddresses,
+		"email_addresses": certReq.EmailAddresses,
+		"uri_sans":        uriSANs,
+		"key_type":        certReq.KeyType.String(),
+	}
+	if certReq.KeyType == certificate.KeyTypeRSA {
+		respData["key_bits"] = certReq.KeyLength
+	} else {
+		respData["key_curve"] = certReq.KeyCurve.String()
+	}
+
+	resp := &logical.Response{Data: respData}
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
+	return resp
+}
+
+const (
+	pathVenafiCertValidateHelpSyn  = `Validate a certificate request without issuing it.`
+	pathVenafiCertValidateHelpDesc = `This path takes the parameters of an issue request and runs the checks of the role and the zone policy on it,
+building its CSR, but doesn't request the certificate from Venafi. It returns whether the request would be accepted with
+the reason when it wouldn't, and the subject, SANs and key of the certificate that would be requested. No private key is
+returned or stored.`
+)
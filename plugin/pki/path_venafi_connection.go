@@ -0,0 +1,73 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathVenafiConnectionTest(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "test/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: `The role whose Venafi secret and zone are tested`,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathVenafiConnectionTestRead,
+		},
+
+		HelpSynopsis:    pathVenafiConnectionTestHelpSyn,
+		HelpDescription: pathVenafiConnectionTestHelpDesc,
+	}
+}
+
+func (b *backend) pathVenafiConnectionTestRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, roleName)), nil
+	}
+
+	cfg, err := b.getConfig(ctx, req, roleName, false)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	cl, _, err := b.ClientVenafi(ctx, req.Storage, data, req, roleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	//roles with additional zones test the zone picked for the client
+	zone := cfg.Zone
+	if z := clientZone(cl); z != "" {
+		zone = z
+	}
+
+	//reading the zone configuration needs valid credentials and an existing zone, without requesting anything
+	b.Logger().Debug(fmt.Sprintf("Testing connection of role %s to zone %s", roleName, zone))
+	if _, err := cl.ReadZoneConfiguration(); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("failed to read zone configuration: %s", err)), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"role":           roleName,
+			"zone":           zone,
+			"connector_type": cl.GetType().String(),
+		},
+	}, nil
+}
+
+const (
+	pathVenafiConnectionTestHelpSyn  = `Test the connection to Venafi of a role.`
+	pathVenafiConnectionTestHelpDesc = `This path authenticates to Venafi with the Venafi secret of the role and reads the configuration of its
+zone, without requesting a certificate. It returns the zone and the type of Venafi connector used, or the error
+Venafi returned.`
+)
@@ -10,6 +10,13 @@ import (
 func pathVenafiFetchListCerts(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "certs/?$",
+		Fields: map[string]*framework.FieldSchema{
+			"key_info": {
+				Type: framework.TypeBool,
+				Description: `Return the role, issue time, requester and revocation of each certificate in "key_info". Every
+stored certificate is read, so it's slow on large stores`,
+			},
+		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ListOperation: b.pathVenafiFetchCertList,
@@ -25,14 +32,54 @@ func (b *backend) pathVenafiFetchCertList(ctx context.Context, req *logical.Requ
 	if err != nil {
 		return nil, err
 	}
+	//listing only reads the keys unless the details of every certificate are asked for
+	if !data.Get("key_info").(bool) {
+		return logical.ListResponse(entries), nil
+	}
+
+	keyInfo := map[string]interface{}{}
+	for _, key := range entries {
+		cert, _, err := getStoredCert(ctx, req.Storage, key)
+		if err != nil {
+			return nil, err
+		}
+		if cert == nil {
+			continue
+		}
+		info := map[string]interface{}{}
+		if cert.Role != "" {
+			info["role"] = cert.Role
+		}
+		if cert.IssuedAt != 0 {
+			info["issued_at"] = cert.IssuedAt
+		}
+		if cert.RequestedBy != "" {
+			info["requested_by"] = cert.RequestedBy
+		}
+		if cert.RequestedByEntity != "" {
+			info["requested_by_entity"] = cert.RequestedByEntity
+		}
+		if cert.RevocationTime != 0 {
+			info["revoked"] = true
+			info["revocation_time"] = cert.RevocationTime
+			info["revocation_reason"] = cert.RevocationReason
+		}
+		if len(info) > 0 {
+			keyInfo[key] = info
+		}
+	}
 
-	return logical.ListResponse(entries), nil
+	return logical.ListResponseWithInfo(entries, keyInfo), nil
 }
 
 const pathVenafiFetchHelpSyn = `
-This allows certificates to be fetched.
+List the certificates stored by this backend.
 `
 
 const pathVenafiFetchHelpDesc = `
-This allows certificates to be fetched.
+This path lists the keys of the certificates stored under "certs/", which are their common names or
+serial numbers depending on the "store_by" option of the role that issued them. Each key can be read
+on "cert/<key>". Certificates issued by roles with "no_store" set are not listed. With "key_info" set,
+the role, issue time and requester of each certificate, along with the revocation time and reason of
+revoked certificates, are returned in "key_info"; every certificate is read for it.
 `
@@ -0,0 +1,133 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// health checks are answered from the last check for this long, so frequent probes don't reach Venafi each time
+	healthCacheTTL = 30 * time.Second
+
+	healthStatusOK       = "ok"
+	healthStatusDegraded = "degraded"
+)
+
+// roleHealth is the result of the last connectivity check of a role, along with the last error it ever had
+type roleHealth struct {
+	status      string
+	checkedAt   time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func pathVenafiHealth(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "health/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: `The role whose connection to Venafi is checked`,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathVenafiHealthRead,
+		},
+
+		HelpSynopsis:    pathVenafiHealthHelpSyn,
+		HelpDescription: pathVenafiHealthHelpDesc,
+	}
+}
+
+func (b *backend) pathVenafiHealthRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, roleName)), nil
+	}
+
+	health, cached := b.getCachedHealth(roleName)
+	if !cached {
+		b.Logger().Debug(fmt.Sprintf("Checking connection of role %s to Venafi", roleName))
+		health = b.setHealth(roleName, b.checkConnection(ctx, req, data, roleName))
+	}
+
+	respData := map[string]interface{}{
+		"role":       roleName,
+		"status":     health.status,
+		"checked_at": health.checkedAt.Unix(),
+		"cached":     cached,
+	}
+	if health.lastError != "" {
+		respData["last_error"] = health.lastError
+		respData["last_error_at"] = health.lastErrorAt.Unix()
+	}
+	resp := &logical.Response{
+		Data: respData,
+	}
+	//load balancers and orchestrators usually only look at the status code
+	if health.status != healthStatusOK {
+		return logical.RespondWithStatusCode(resp, req, http.StatusServiceUnavailable)
+	}
+	return resp, nil
+}
+
+// checkConnection authenticates to Venafi with the Venafi secret of the role and reads the configuration of its zone,
+// as the test path does
+func (b *backend) checkConnection(ctx context.Context, req *logical.Request, data *framework.FieldData, roleName string) error {
+	cl, _, err := b.ClientVenafi(ctx, req.Storage, data, req, roleName)
+	if err != nil {
+		return err
+	}
+	if _, err := cl.ReadZoneConfiguration(); err != nil {
+		return fmt.Errorf("failed to read zone configuration: %s", err)
+	}
+	return nil
+}
+
+func (b *backend) getCachedHealth(roleName string) (roleHealth, bool) {
+	b.healthLock.Lock()
+	defer b.healthLock.Unlock()
+
+	health, ok := b.health[roleName]
+	if !ok || time.Since(health.checkedAt) > healthCacheTTL {
+		return health, false
+	}
+	return health, true
+}
+
+// setHealth records the result of a connectivity check of the role and returns its health
+func (b *backend) setHealth(roleName string, checkErr error) roleHealth {
+	b.healthLock.Lock()
+	defer b.healthLock.Unlock()
+
+	if b.health == nil {
+		b.health = make(map[string]roleHealth)
+	}
+	health := b.health[roleName]
+	health.checkedAt = time.Now()
+	health.status = healthStatusOK
+	if checkErr != nil {
+		health.status = healthStatusDegraded
+		health.lastError = checkErr.Error()
+		health.lastErrorAt = health.checkedAt
+	}
+	b.health[roleName] = health
+	return health
+}
+
+const (
+	pathVenafiHealthHelpSyn  = `Check if a role can currently reach and authenticate to Venafi.`
+	pathVenafiHealthHelpDesc = `This path reports the status of the connection of a role to Venafi, "ok" or "degraded", along with the
+last error met, for external health checks and load balancers. A degraded connection is answered with the HTTP status
+503. The result of a check is reused for 30 seconds so frequent probes don't overload Venafi.`
+)
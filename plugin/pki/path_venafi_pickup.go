@@ -0,0 +1,433 @@
+package pki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	pickupStatePending  = "pending"
+	pickupStateIssued   = "issued"
+	pickupStateRejected = "rejected"
+	pickupStateExpired  = "expired"
+	pickupStateFailed   = "failed"
+
+	// pickupEntryTTL is how long a pending request is kept by the backend, after which it can no longer be picked up
+	pickupEntryTTL = 30 * 24 * time.Hour
+)
+
+// pickupEntry is stored for every certificate request that was still waiting in Venafi (e.g. for an approval) when the
+// issue or sign request timed out, so its progress can be followed later
+type pickupEntry struct {
+	PickupID          string    `json:"pickup_id"`
+	Role              string    `json:"role"`
+	CommonName        string    `json:"common_name"`
+	RequestedAt       time.Time `json:"requested_at"`
+	RequestedBy       string    `json:"requested_by,omitempty"`
+	RequestedByEntity string    `json:"requested_by_entity,omitempty"`
+	//the locally generated private key of the request, or the password protecting the key generated by Venafi
+	PrivateKey         string `json:"private_key,omitempty"`
+	ServiceKeyPassword string `json:"service_key_password,omitempty"`
+	PrivateKeyFormat   string `json:"private_key_format,omitempty"`
+}
+
+// expired validates if the pending request is older than the backend keeps it
+func (p *pickupEntry) expired() bool {
+	return time.Since(p.RequestedAt) > pickupEntryTTL
+}
+
+func pathVenafiPickupStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "pickup/" + framework.GenericNameRegex("role") + "/" + framework.MatchAllRegex("pickup_id") + "/status",
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: "Name of the role the certificate was requested with",
+			},
+			"pickup_id": {
+				Type:        framework.TypeString,
+				Description: "Pickup ID returned by Venafi when the certificate request timed out",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathVenafiPickupStatusRead,
+		},
+
+		HelpSynopsis:    pathVenafiPickupStatusHelpSyn,
+		HelpDescription: pathVenafiPickupStatusHelpDesc,
+	}
+}
+
+func pathVenafiPickup(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "pickup/" + framework.GenericNameRegex("role") + "/" + framework.MatchAllRegex("pickup_id"),
+		Fields: map[string]*framework.FieldSchema{
+			"pickup_id": {
+				Type:        framework.TypeString,
+				Description: "Pickup ID returned by Venafi when the certificate request timed out",
+			},
+			"role": {
+				Type:        framework.TypeString,
+				Description: "Name of the role the certificate was requested with",
+			},
+			"key_password": {
+				Type:        framework.TypeString,
+				Description: "Password for encrypting private key",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathVenafiPickupWrite,
+		},
+
+		HelpSynopsis:    pathVenafiPickupHelpSyn,
+		HelpDescription: pathVenafiPickupHelpDesc,
+	}
+}
+
+// pathVenafiPickupWrite resumes the retrieval of a certificate that was still pending when it was issued or signed.
+// The certificate is stored like an issued one and the pickup entry is removed.
+func (b *backend) pathVenafiPickupWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	//the pickup entry is removed once the certificate is retrieved, so the request is forwarded to the primary like an
+	//issue request
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby | consts.ReplicationPerformanceSecondary) {
+		return nil, logical.ErrReadOnly
+	}
+
+	pickupID := data.Get("pickup_id").(string)
+	if pickupID == "" {
+		return logical.ErrorResponse("no pickup ID specified"), nil
+	}
+
+	pickup, err := getPickup(ctx, req.Storage, pickupID)
+	if err != nil {
+		return nil, err
+	}
+	if pickup == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown pickup ID: %s", pickupID)), nil
+	}
+	//the certificate and key are only released to callers of the role that requested them, which the role in the path
+	//lets ACL policies limit
+	if roleName := data.Get("role").(string); roleName != pickup.Role {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextPickupRoleMismatch, pickupID, roleName)), nil
+	}
+	if pickup.expired() {
+		if err := req.Storage.Delete(ctx, "pickups/"+pickupID); err != nil {
+			return nil, err
+		}
+		return logical.ErrorResponse(fmt.Sprintf(errorTextPickupExpired, pickupID)), nil
+	}
+	role, err := b.getRole(ctx, req.Storage, pickup.Role)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, pickup.Role)), nil
+	}
+
+	cl, timeout, err := b.ClientVenafi(ctx, req.Storage, data, req, pickup.Role)
+	if err != nil {
+		return venafiErrorResponse(err, err.Error())
+	}
+
+	pickupReq := &certificate.Request{
+		PickupID: pickupID,
+		Timeout:  timeout,
+	}
+	pickupReq.ChainOption, err = parseChainOption(role.ChainOption)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if pickup.ServiceKeyPassword != "" {
+		pickupReq.CsrOrigin = certificate.ServiceGeneratedCSR
+		pickupReq.FetchPrivateKey = true
+		pickupReq.KeyPassword = pickup.ServiceKeyPassword
+	}
+
+	b.Logger().Debug(fmt.Sprintf("Resuming retrieval of certificate %s", pickupID))
+	var pcc *certificate.PEMCollection
+	err = b.withReauthentication(ctx, req, data, pickup.Role, &cl, func(cl endpoint.Connector) error {
+		return b.retryOnTransientError(ctx, role, "Certificate retrieval", func() (err error) {
+			pcc, err = b.retrieveCertificate(ctx, cl, pickup.Role, role, pickupReq, timeout)
+			return err
+		})
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		//a request that can never be issued isn't worth keeping
+		if state, _ := pickupStateFromError(err); state == pickupStateRejected || state == pickupStateExpired {
+			if err := req.Storage.Delete(ctx, "pickups/"+pickupID); err != nil {
+				return nil, err
+			}
+		}
+		return venafiErrorResponse(err, err.Error())
+	}
+
+	parsedCertificate, err := parseIssuedCertificate(pcc.Certificate)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("pickup ID %s: %s", pickupID, err)), nil
+	}
+	serialNumber, err := certSerialNumber(parsedCertificate)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateIssuedCertificate(role.PostIssuanceValidators, parsedCertificate, pcc.Chain); err != nil {
+		b.Logger().Error(fmt.Sprintf("Certificate %s was issued but not returned: %s", serialNumber, err))
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	keyPEM := pickup.PrivateKey
+	keyPassword := ""
+	if pcc.PrivateKey != "" {
+		keyPEM, keyPassword = pcc.PrivateKey, pickup.ServiceKeyPassword
+	}
+	pcc.PrivateKey = ""
+	var keyType string
+	if keyPEM != "" {
+		privateKey, err := parsePrivateKeyPEM(keyPEM, keyPassword)
+		if err != nil {
+			return nil, err
+		}
+		keyType = privateKeyType(privateKey)
+		pcc.PrivateKey, err = encodePrivateKey(privateKey, pickup.PrivateKeyFormat, data.Get("key_password").(string))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chain := strings.Join(append([]string{pcc.Certificate}, pcc.Chain...), "\n")
+	certDN := certificateDN(cl.GetType(), pickupID)
+	thumbprint, err := certificateThumbprint(pcc.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	var storagePath string
+	if !role.NoStore {
+		stored := VenafiCert{
+			Certificate:       pcc.Certificate,
+			CertificateChain:  chain,
+			SerialNumber:      serialNumber,
+			CertificateDN:     certDN,
+			Thumbprint:        thumbprint,
+			PickupID:          pickupID,
+			Expiration:        parsedCertificate.NotAfter.Unix(),
+			Role:              pickup.Role,
+			IssuedAt:          time.Now().Unix(),
+			RequestedBy:       pickup.RequestedBy,
+			RequestedByEntity: pickup.RequestedByEntity,
+		}
+		//pickups stored by earlier versions don't know who made the request
+		if stored.RequestedBy == "" {
+			stored.RequestedBy = requestedBy(req)
+			stored.RequestedByEntity = req.EntityID
+		}
+		if role.StorePrivateKey {
+			stored.PrivateKey = pcc.PrivateKey
+		}
+		storagePath = certStoragePath(role.StoreBy, parsedCertificate.Subject.CommonName, serialNumber)
+		entry, err := logical.StorageEntryJSON(storagePath, stored)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			b.Logger().Error("Error putting entry to storage: " + err.Error())
+			return nil, err
+		}
+		if err := indexCertByCN(ctx, req.Storage, parsedCertificate, storagePath); err != nil {
+			return nil, err
+		}
+	}
+	if err := req.Storage.Delete(ctx, "pickups/"+pickupID); err != nil {
+		return nil, err
+	}
+
+	respData := map[string]interface{}{
+		"common_name":       parsedCertificate.Subject.CommonName,
+		"serial_number":     serialNumber,
+		"certificate_chain": chain,
+		"certificate":       pcc.Certificate,
+		"ca_chain":          pcc.Chain,
+		"issuing_ca":        findIssuingCA(pcc.Certificate, pcc.Chain),
+		"expiration":        parsedCertificate.NotAfter.Unix(),
+	}
+	addRenewAfter(respData, parsedCertificate, role)
+	returnPrivateKey := pcc.PrivateKey != "" && role.returnPrivateKey()
+	if returnPrivateKey {
+		respData["private_key"] = pcc.PrivateKey
+		respData["private_key_type"] = keyType
+	}
+	if certDN != "" {
+		respData["certificate_dn"] = certDN
+	}
+	respData["pickup_id"] = pickupID
+	resp := &logical.Response{
+		Data: respData,
+	}
+	//the lease the certificate would have had if it had been issued before the request timed out
+	if role.GenerateLease {
+		resp = b.Secret(SecretCertsType).Response(respData,
+			secretCertsInternalData(pickup.Role, serialNumber, certDN, thumbprint, pickupID, storagePath, parsedCertificate.NotAfter))
+		TTL, warning := b.certLeaseTTL(role, parsedCertificate.NotAfter, serialNumber)
+		if warning != "" {
+			resp.AddWarning(warning)
+		}
+		resp.Secret.TTL = TTL
+	}
+	if returnPrivateKey {
+		resp.AddWarning(warningTextPrivateKeyACL)
+	}
+	return resp, nil
+}
+
+func (b *backend) pathVenafiPickupStatusRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	pickupID := data.Get("pickup_id").(string)
+	if pickupID == "" {
+		return logical.ErrorResponse("no pickup ID specified"), nil
+	}
+
+	pickup, err := getPickup(ctx, req.Storage, pickupID)
+	if err != nil {
+		return nil, err
+	}
+	if pickup == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown pickup ID: %s", pickupID)), nil
+	}
+	if roleName := data.Get("role").(string); roleName != pickup.Role {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextPickupRoleMismatch, pickupID, roleName)), nil
+	}
+
+	cl, _, err := b.ClientVenafi(ctx, req.Storage, data, req, pickup.Role)
+	if err != nil {
+		return venafiErrorResponse(err, err.Error())
+	}
+
+	//a zero timeout makes vcert check the status once instead of waiting for the certificate
+	var pcc *certificate.PEMCollection
+	err = b.withRequestSlot(ctx, func() (err error) {
+		pcc, err = cl.RetrieveCertificate(&certificate.Request{
+			PickupID: pickupID,
+			Timeout:  0,
+		})
+		return err
+	})
+
+	respData := map[string]interface{}{
+		"pickup_id":    pickup.PickupID,
+		"role":         pickup.Role,
+		"common_name":  pickup.CommonName,
+		"requested_at": pickup.RequestedAt.Format(time.RFC3339),
+		"elapsed":      int64(time.Since(pickup.RequestedAt).Seconds()),
+	}
+
+	state, detail := pickupStateFromError(err)
+	respData["state"] = state
+	if detail != "" {
+		respData["status_detail"] = detail
+	}
+
+	if state == pickupStateIssued {
+		parsedCertificate, err := parseIssuedCertificate(pcc.Certificate)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("pickup ID %s: %s", pickupID, err)), nil
+		}
+		serialNumber, err := certSerialNumber(parsedCertificate)
+		if err != nil {
+			return nil, err
+		}
+		respData["serial_number"] = serialNumber
+		respData["expiration"] = parsedCertificate.NotAfter.Unix()
+	}
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+// pickupStateFromError maps the result of a single retrieval attempt to the state of the request. The status text
+// given by Venafi, which can include the approver comments, is returned along with it.
+func pickupStateFromError(err error) (state string, detail string) {
+	if err == nil {
+		return pickupStateIssued, ""
+	}
+	if status, rejected := rejectionStatus(err); rejected {
+		return pickupStateRejected, status
+	}
+
+	var pending endpoint.ErrCertificatePending
+	if errors.As(err, &pending) {
+		return pickupStatePending, pending.Status
+	}
+	var timeout endpoint.ErrRetrieveCertificateTimeout
+	if errors.As(err, &timeout) {
+		return pickupStatePending, ""
+	}
+
+	msg := err.Error()
+	lowerMsg := strings.ToLower(msg)
+	switch {
+	case getStatusCode(msg) == http.StatusNotFound || strings.Contains(lowerMsg, "does not exist"):
+		return pickupStateExpired, msg
+	default:
+		return pickupStateFailed, msg
+	}
+}
+
+// isPickupPending validates if the retrieval ended because Venafi has not issued the certificate yet
+func isPickupPending(err error) bool {
+	var pending endpoint.ErrCertificatePending
+	var timeout endpoint.ErrRetrieveCertificateTimeout
+	return errors.As(err, &pending) || errors.As(err, &timeout)
+}
+
+func getPickup(ctx context.Context, s logical.Storage, pickupID string) (*pickupEntry, error) {
+	entry, err := s.Get(ctx, "pickups/"+pickupID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var pickup pickupEntry
+	if err := entry.DecodeJSON(&pickup); err != nil {
+		return nil, err
+	}
+	return &pickup, nil
+}
+
+func storePickup(ctx context.Context, s logical.Storage, pickup *pickupEntry) error {
+	entry, err := logical.StorageEntryJSON("pickups/"+pickup.PickupID, pickup)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+const (
+	errorTextPickupRoleMismatch = "pickup ID %s wasn't requested with role %q"
+	errorTextPickupExpired      = "pickup ID %s expired, the certificate has to be requested again"
+
+	pathVenafiPickupHelpSyn  = `Retrieve a certificate whose request was still pending in Venafi.`
+	pathVenafiPickupHelpDesc = `When issuing or signing times out while Venafi hasn't issued the certificate yet, the pickup ID and the
+private key of the request are kept by the backend when the role stores private keys. This path waits again for Venafi to
+issue the certificate, checks it with the post-issuance validators of the role and returns it with its private key,
+storing it and generating its lease as the role says. The path must name the role the certificate was requested with, so
+ACL policies can limit who picks up the certificates of each role. The pickup ID is forgotten once the certificate is
+retrieved or rejected, or after 30 days.`
+
+	pathVenafiPickupStatusHelpSyn  = `Read the status of a certificate request still pending in Venafi.`
+	pathVenafiPickupStatusHelpDesc = `When issuing or signing times out while Venafi hasn't issued the certificate yet, for example because it
+is waiting for an approval, the pickup ID is kept by the backend. This path queries Venafi for the current status of the
+request and returns its state (pending, issued, rejected, expired or failed), the time elapsed since it was made and any
+status detail given by Venafi. The path must name the role the certificate was requested with.`
+)
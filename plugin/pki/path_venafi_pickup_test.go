@@ -0,0 +1,87 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/hashicorp/vault/sdk/logical"
+	"testing"
+	"time"
+)
+
+func TestPickupWriteChecks(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	for _, pickup := range []*pickupEntry{
+		{PickupID: "recent", Role: "approved", RequestedAt: time.Now()},
+		{PickupID: "old", Role: "approved", RequestedAt: time.Now().Add(-pickupEntryTTL - time.Hour)},
+	} {
+		if err := storePickup(ctx, storage, pickup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pickupWrite := func(pickupID, role string) *logical.Response {
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "pickup/" + role + "/" + pickupID,
+			Storage:   storage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := pickupWrite("recent", "other")
+	if resp == nil || !resp.IsError() || resp.Error().Error() != fmt.Sprintf(errorTextPickupRoleMismatch, "recent", "other") {
+		t.Fatalf("Expecting a pickup of another role to be refused but got %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "pickup/other/recent/status",
+		Storage:   storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() || resp.Error().Error() != fmt.Sprintf(errorTextPickupRoleMismatch, "recent", "other") {
+		t.Fatalf("Expecting the status of a pickup of another role to be refused but got %#v", resp)
+	}
+
+	resp = pickupWrite("old", "approved")
+	if resp == nil || !resp.IsError() || resp.Error().Error() != fmt.Sprintf(errorTextPickupExpired, "old") {
+		t.Fatalf("Expecting an expired pickup to be refused but got %#v", resp)
+	}
+	pickup, err := getPickup(ctx, storage, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pickup != nil {
+		t.Fatal("Expecting an expired pickup to be deleted")
+	}
+}
+
+func TestPickupStateFromError(t *testing.T) {
+	cases := []struct {
+		err    error
+		state  string
+		detail string
+	}{
+		{nil, pickupStateIssued, ""},
+		{endpoint.ErrCertificatePending{CertificateID: "id", Status: "Pending approval: waiting for security team"}, pickupStatePending, "Pending approval: waiting for security team"},
+		{endpoint.ErrCertificatePending{CertificateID: "id", Status: "Rejected by security team"}, pickupStateRejected, "Rejected by security team"},
+		{errCertificateRejected{PickupID: "id", Status: "Rejected by security team"}, pickupStateRejected, "Rejected by security team"},
+		{fmt.Errorf("retrieving: %w", endpoint.ErrRetrieveCertificateTimeout{CertificateID: "id"}), pickupStatePending, ""},
+		{fmt.Errorf("unable to retrieve: Certificate request was rejected by approver: not allowed"), pickupStateRejected, "unable to retrieve: Certificate request was rejected by approver: not allowed"},
+		{fmt.Errorf("unable to retrieve: Certificate \\VED\\Policy\\x does not exist"), pickupStateExpired, "unable to retrieve: Certificate \\VED\\Policy\\x does not exist"},
+		{fmt.Errorf("Failed to retrieve certificate. Status: FAILED"), pickupStateFailed, "Failed to retrieve certificate. Status: FAILED"},
+	}
+	for _, c := range cases {
+		state, detail := pickupStateFromError(c.err)
+		if state != c.state || detail != c.detail {
+			t.Fatalf("for error %v expected state %q with detail %q, got %q with %q", c.err, c.state, c.detail, state, detail)
+		}
+	}
+}
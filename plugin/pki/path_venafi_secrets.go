@@ -81,6 +81,16 @@ Example for Venafi Cloud: e33f3e40-4e7e-11ea-8da3-b3c196ebeb0b`,
 				Description: `Use to specify a PEM formatted file with certificates to be used as trust anchors when communicating with the remote server.
 Example: trust_bundle_file="/path-to/bundle.pem""`,
 			},
+			"trust_bundle_pem": {
+				Type: framework.TypeString,
+				Description: `PEM formatted certificates to be used as trust anchors when communicating with the remote server,
+e.g. the private CA that issued the certificate of Venafi Platform. Can't be used along with trust_bundle_file`,
+			},
+			"skip_tls_verify": {
+				Type:        framework.TypeBool,
+				Description: `Set it to true to skip the verification of the certificate of the remote server. Only for test environments`,
+				Default:     false,
+			},
 			"fakemode": {
 				Type:        framework.TypeBool,
 				Description: `Set it to true to use fake CA instead of Cloud or Platform to issue certificates. Useful for testing.`,
@@ -115,6 +125,9 @@ const (
 	errorTextURLEmpty     = `"url" argument is required`
 	errorTextZoneEmpty    = `"zone" argument is required`
 	errorTextInvalidMode  = "invalid mode: fakemode or apikey or tpp credentials or tpp access token required"
+
+	errorTextTrustBundleConflict = `can't specify both "trust_bundle_file" and "trust_bundle_pem"`
+	errorTextInvalidTrustBundle  = `"trust_bundle_pem" contains no PEM certificates`
 )
 
 var (
@@ -157,9 +170,32 @@ func (b *backend) pathVenafiSecretDelete(ctx context.Context, req *logical.Reque
 	if err != nil {
 		return nil, err
 	}
+	if err := b.invalidateVenafiSecretCaches(ctx, req.Storage, data.Get("name").(string)); err != nil {
+		return nil, err
+	}
 	return nil, nil
 }
 
+// invalidateVenafiSecretCaches drops the cached CA chain and custom fields of the roles using the Venafi secret, so a
+// changed URL, zone or credentials are picked up on the next request
+func (b *backend) invalidateVenafiSecretCaches(ctx context.Context, s logical.Storage, name string) error {
+	roleNames, err := s.List(ctx, "role/")
+	if err != nil {
+		return err
+	}
+	for _, roleName := range roleNames {
+		role, err := b.getRole(ctx, s, roleName)
+		if err != nil {
+			return err
+		}
+		if role != nil && role.VenafiSecret == name {
+			b.invalidateCAChain(roleName)
+			b.invalidateCustomFields(roleName)
+		}
+	}
+	return nil
+}
+
 func (b *backend) pathVenafiSecretCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	var err error
 	name := data.Get("name").(string)
@@ -187,6 +223,8 @@ func (b *backend) pathVenafiSecretCreate(ctx context.Context, req *logical.Reque
 		CloudURL:        cloudUrl,
 		Apikey:          data.Get("apikey").(string),
 		TrustBundleFile: data.Get("trust_bundle_file").(string),
+		TrustBundlePEM:  data.Get("trust_bundle_pem").(string),
+		SkipTLSVerify:   data.Get("skip_tls_verify").(bool),
 		Fakemode:        data.Get("fakemode").(bool),
 	}
 
@@ -221,6 +259,8 @@ func (b *backend) pathVenafiSecretCreate(ctx context.Context, req *logical.Reque
 				entry.RefreshToken = tokenInfo.Refresh_token
 			}
 
+			entry.AccessTokenExpires = int64(tokenInfo.Expires)
+
 		}
 
 	}
@@ -235,6 +275,9 @@ func (b *backend) pathVenafiSecretCreate(ctx context.Context, req *logical.Reque
 	if err != nil {
 		return nil, err
 	}
+	if err := b.invalidateVenafiSecretCaches(ctx, req.Storage, name); err != nil {
+		return nil, err
+	}
 
 	var logResp *logical.Response
 
@@ -298,6 +341,16 @@ func validateVenafiSecretEntry(entry *venafiSecretEntry) error {
 		if entry.AccessToken != "" && entry.Apikey != "" {
 			return fmt.Errorf(errorTextMixedTokenAndCloud)
 		}
+
+		if entry.TrustBundleFile != "" && entry.TrustBundlePEM != "" {
+			return fmt.Errorf(errorTextTrustBundleConflict)
+		}
+
+		if entry.TrustBundlePEM != "" {
+			if _, err := parseTrustBundlePEM(entry.TrustBundlePEM); err != nil {
+				return fmt.Errorf(errorTextInvalidTrustBundle)
+			}
+		}
 	}
 	return nil
 }
@@ -318,6 +371,9 @@ func getWarnings(entry *venafiSecretEntry, name string) []string {
 	if entry.TppPassword != "" {
 		warnings = append(warnings, "tpp_password is deprecated, please use access_token instead")
 	}
+	if entry.SkipTLSVerify && !entry.Fakemode {
+		warnings = append(warnings, "skip_tls_verify is set, the certificate of the remote server won't be verified; use it only in test environments")
+	}
 	//Include success message in warnings
 	if len(warnings) > 0 {
 		warnings = append(warnings, "Venafi secret "+name+" saved successfully")
@@ -336,7 +392,11 @@ type venafiSecretEntry struct {
 	CloudURL        string `json:"cloud_url"`
 	Apikey          string `json:"apikey"`
 	TrustBundleFile string `json:"trust_bundle_file"`
+	TrustBundlePEM  string `json:"trust_bundle_pem"`
+	SkipTLSVerify   bool   `json:"skip_tls_verify"`
 	Fakemode        bool   `json:"fakemode"`
+	//Unix time at which TPP said the access token expires, 0 when unknown
+	AccessTokenExpires int64 `json:"access_token_expires,omitempty"`
 }
 
 func (p *venafiSecretEntry) ToResponseData() map[string]interface{} {
@@ -352,8 +412,13 @@ func (p *venafiSecretEntry) ToResponseData() map[string]interface{} {
 		"refresh_token":     p.getStringMask(),
 		"apikey":            p.getStringMask(),
 		"trust_bundle_file": p.TrustBundleFile,
+		"trust_bundle_pem":  p.TrustBundlePEM,
+		"skip_tls_verify":   p.SkipTLSVerify,
 		"fakemode":          p.Fakemode,
 	}
+	if p.AccessTokenExpires != 0 {
+		responseData["access_token_expires"] = p.AccessTokenExpires
+	}
 	return responseData
 }
 
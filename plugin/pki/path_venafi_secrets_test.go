@@ -1,6 +1,14 @@
 package pki
 
-import "testing"
+import (
+	"context"
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/hashicorp/vault/sdk/logical"
+	"net/http"
+	"testing"
+	"time"
+)
 
 func TestVenafiSecretValidate(t *testing.T) {
 	entry := &venafiSecretEntry{}
@@ -84,4 +92,131 @@ func TestVenafiSecretValidate(t *testing.T) {
 	if err.Error() != errorTextMixedTokenAndCloud {
 		t.Fatalf("Expecting error %s but got %s", errorTextMixedTokenAndCloud, err)
 	}
+
+	entry = &venafiSecretEntry{
+		URL:             "https://qa-tpp.exmple.com/vedsdk",
+		Zone:            "devops\\vcert",
+		AccessToken:     "foo123bar==",
+		TrustBundleFile: "/path-to/bundle.pem",
+		TrustBundlePEM:  fake.CaCertPEM,
+	}
+
+	err = validateVenafiSecretEntry(entry)
+	if err == nil {
+		t.Fatalf("Expecting error")
+	}
+	if err.Error() != errorTextTrustBundleConflict {
+		t.Fatalf("Expecting error %s but got %s", errorTextTrustBundleConflict, err)
+	}
+
+	entry.TrustBundleFile = ""
+	entry.TrustBundlePEM = "not a certificate"
+	err = validateVenafiSecretEntry(entry)
+	if err == nil {
+		t.Fatalf("Expecting error")
+	}
+	if err.Error() != errorTextInvalidTrustBundle {
+		t.Fatalf("Expecting error %s but got %s", errorTextInvalidTrustBundle, err)
+	}
+
+	entry.TrustBundlePEM = fake.CaCertPEM
+	err = validateVenafiSecretEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetConnectionTrust(t *testing.T) {
+	cfg := &vcert.Config{}
+	if err := setConnectionTrust(cfg, &venafiSecretEntry{TrustBundlePEM: fake.CaCertPEM}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ConnectionTrust != fake.CaCertPEM {
+		t.Fatalf("Expecting the trust bundle PEM as connection trust but got %q", cfg.ConnectionTrust)
+	}
+	if cfg.Client != nil {
+		t.Fatal("Expecting vcert to build its own HTTP client when the server certificate is verified")
+	}
+
+	cfg = &vcert.Config{}
+	if err := setConnectionTrust(cfg, &venafiSecretEntry{SkipTLSVerify: true}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Client == nil {
+		t.Fatal("Expecting an HTTP client skipping the verification of the server certificate")
+	}
+	transport := cfg.Client.Transport.(*http.Transport)
+	if !transport.TLSClientConfig.InsecureSkipVerify {
+		t.Fatal("Expecting the server certificate not to be verified")
+	}
+	if client, err := configHTTPClient(cfg); err != nil || client != cfg.Client {
+		t.Fatalf("Expecting the HTTP client of the config to be used for TPP, got %v", err)
+	}
+
+	if err := setConnectionTrust(&vcert.Config{}, &venafiSecretEntry{TrustBundleFile: "/missing/bundle.pem"}); err == nil {
+		t.Fatal("Expecting an error for a missing trust bundle file")
+	}
+}
+
+func TestAccessTokenExpired(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		entry   venafiSecretEntry
+		expired bool
+	}{
+		{venafiSecretEntry{AccessToken: "token"}, false},
+		{venafiSecretEntry{AccessTokenExpires: now.Add(-time.Hour).Unix()}, false},
+		{venafiSecretEntry{AccessToken: "token", AccessTokenExpires: now.Add(time.Hour).Unix()}, false},
+		{venafiSecretEntry{AccessToken: "token", AccessTokenExpires: now.Add(30 * time.Second).Unix()}, true},
+		{venafiSecretEntry{AccessToken: "token", AccessTokenExpires: now.Add(-time.Hour).Unix()}, true},
+	}
+	for _, c := range cases {
+		if expired := accessTokenExpired(&c.entry, now, time.Minute); expired != c.expired {
+			t.Fatalf("Expecting expired %t for a token expiring at %d but got %t", c.expired, c.entry.AccessTokenExpires, expired)
+		}
+	}
+}
+
+func TestVenafiSecretWriteInvalidatesCaches(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	b.customFieldsCache = map[string]cachedCustomFields{}
+	for name, secret := range map[string]string{"uses": "changed", "other": "unchanged"} {
+		entry, err := logical.StorageEntryJSON("role/"+name, roleEntry{VenafiSecret: secret})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+		b.setCachedCAChain(name, []string{fake.CaCertPEM})
+		b.customFieldsCache[roleZoneKey(name, "")] = cachedCustomFields{fields: []string{"Field"}, expiresAt: time.Now().Add(customFieldsCacheTTL)}
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "venafi/changed",
+		Storage:   storage,
+		Data:      map[string]interface{}{"fakemode": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to write the Venafi secret: %s", resp.Error())
+	}
+
+	if _, ok := b.getCachedCAChain("uses"); ok {
+		t.Fatal("Expecting the CA chain of a role using the written secret to be dropped")
+	}
+	if _, ok := b.customFieldsCache[roleZoneKey("uses", "")]; ok {
+		t.Fatal("Expecting the custom fields of a role using the written secret to be dropped")
+	}
+	if _, ok := b.getCachedCAChain("other"); !ok {
+		t.Fatal("Expecting the CA chain of a role using another secret to be kept")
+	}
+	if _, ok := b.customFieldsCache[roleZoneKey("other", "")]; !ok {
+		t.Fatal("Expecting the custom fields of a role using another secret to be kept")
+	}
 }
@@ -0,0 +1,105 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	authMethodNone         = "none"
+	authMethodUserPassword = "tpp_user_password"
+	authMethodAccessToken  = "access_token"
+	authMethodAPIKey       = "apikey"
+	authMethodUnknown      = "unknown"
+)
+
+func pathVenafiWhoami(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "whoami/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: `The role whose connection settings are read`,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathVenafiWhoamiRead,
+		},
+
+		HelpSynopsis:    pathVenafiWhoamiHelpSyn,
+		HelpDescription: pathVenafiWhoamiHelpDesc,
+	}
+}
+
+func (b *backend) pathVenafiWhoamiRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(errorTextUnknownRole, roleName)), nil
+	}
+
+	venafiSecret, err := b.getVenafiSecret(ctx, req.Storage, role.VenafiSecret)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := b.getConfig(ctx, req, roleName, false)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	respData := map[string]interface{}{
+		"role":             roleName,
+		"venafi_secret":    role.VenafiSecret,
+		"connector_type":   cfg.ConnectorType.String(),
+		"zone":             cfg.Zone,
+		"url":              cfg.BaseUrl,
+		"trust_bundle_set": cfg.ConnectionTrust != "",
+		"skip_tls_verify":  venafiSecret.SkipTLSVerify,
+		"auth_method":      authMethod(cfg.ConnectorType, cfg.Credentials),
+	}
+	//the requests of roles with additional zones are spread across them and the zone above
+	if len(role.AdditionalZones) > 0 {
+		respData["additional_zones"] = role.AdditionalZones
+	}
+	if venafiSecret.AccessToken != "" {
+		respData["refresh_token_set"] = venafiSecret.RefreshToken != ""
+	}
+	if venafiSecret.AccessTokenExpires != 0 {
+		respData["access_token_expires"] = venafiSecret.AccessTokenExpires
+	}
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+// authMethod names the way the connector authenticates to Venafi, without its credentials
+func authMethod(connectorType endpoint.ConnectorType, credentials *endpoint.Authentication) string {
+	switch {
+	case connectorType == endpoint.ConnectorTypeFake:
+		return authMethodNone
+	case credentials == nil:
+		return authMethodUnknown
+	case credentials.User != "":
+		return authMethodUserPassword
+	case credentials.AccessToken != "":
+		return authMethodAccessToken
+	case credentials.APIKey != "":
+		return authMethodAPIKey
+	default:
+		return authMethodUnknown
+	}
+}
+
+const (
+	pathVenafiWhoamiHelpSyn  = `Read how a role connects to Venafi.`
+	pathVenafiWhoamiHelpDesc = `This path returns the connection settings of a role without connecting to Venafi: the type of Venafi
+connector used, the zone and the additional zones of the role, the URL, whether a trust bundle is set and the authentication method. Credentials are never
+returned.`
+)
@@ -0,0 +1,57 @@
+package pki
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestWhoamiRedactsCredentials(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secrets := map[string]venafiSecretEntry{
+		"token": {URL: "https://tpp.example.com/vedsdk", Zone: `DevOps\Vault`, AccessToken: "secret-access-token",
+			RefreshToken: "secret-refresh-token", TrustBundlePEM: "-----BEGIN CERTIFICATE-----"},
+		"user":  {URL: "https://tpp.example.com/vedsdk", Zone: `DevOps\Vault`, TppUser: "admin", TppPassword: "secret-password"},
+		"cloud": {Zone: "app\\zone", Apikey: "secret-apikey"},
+	}
+	expected := map[string]string{"token": authMethodAccessToken, "user": authMethodUserPassword, "cloud": authMethodAPIKey}
+	for name, secret := range secrets {
+		for key, value := range map[string]interface{}{"venafi/" + name: secret, "role/" + name: roleEntry{VenafiSecret: name}} {
+			entry, err := logical.StorageEntryJSON(key, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := integrationTestEnv.Storage.Put(integrationTestEnv.Context, entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		resp, err := integrationTestEnv.Backend.HandleRequest(integrationTestEnv.Context, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "whoami/" + name,
+			Storage:   integrationTestEnv.Storage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || resp.IsError() {
+			t.Fatalf("failed to read whoami of %s: %#v", name, resp)
+		}
+		if resp.Data["auth_method"] != expected[name] {
+			t.Fatalf("expected auth method %s for %s but got %v", expected[name], name, resp.Data["auth_method"])
+		}
+		if resp.Data["trust_bundle_set"] != (secret.TrustBundlePEM != "") {
+			t.Fatalf("expected trust_bundle_set %v for %s but got %v", secret.TrustBundlePEM != "", name, resp.Data["trust_bundle_set"])
+		}
+		for key, value := range resp.Data {
+			if s, ok := value.(string); ok && strings.Contains(s, "secret-") {
+				t.Fatalf("%s of %s discloses a credential: %s", key, name, s)
+			}
+		}
+	}
+}
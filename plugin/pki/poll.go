@@ -0,0 +1,182 @@
+package pki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPollBackoffBase = 1 * time.Second
+	// defaultPollBackoffFactor and defaultPollBackoffMax are the backoff of roles without poll_backoff_factor and
+	// poll_backoff_max
+	defaultPollBackoffFactor = 2
+	defaultPollBackoffMax    = 30 * time.Second
+	//consecutive network errors after which the retrieval gives up instead of polling again
+	maxRetrieveNetworkErrors = 3
+)
+
+// networkErrorSubstrings are the messages of the network errors vcert returns as plain text, which are worth polling again
+var networkErrorSubstrings = []string{
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"temporary failure in name resolution",
+}
+
+// errCertificateRejected is returned when Venafi rejected the request, e.g. its approver did, so retrieving it again
+// won't issue the certificate
+type errCertificateRejected struct {
+	PickupID string
+	Status   string
+}
+
+func (e errCertificateRejected) Error() string {
+	return fmt.Sprintf("certificate request %s was rejected by an approver: %s", e.PickupID, e.Status)
+}
+
+// rejectionStatus returns the status given by Venafi when the error says the request was rejected. A rejected request
+// can be reported as pending by vcert, with the rejection in its status.
+func rejectionStatus(err error) (string, bool) {
+	if err == nil {
+		return "", false
+	}
+	var rejected errCertificateRejected
+	if errors.As(err, &rejected) {
+		return rejected.Status, true
+	}
+	status := err.Error()
+	var pending endpoint.ErrCertificatePending
+	if errors.As(err, &pending) {
+		status = pending.Status
+	}
+	return status, strings.Contains(strings.ToLower(status), "reject")
+}
+
+// isNetworkError validates if the retrieval failed because Venafi couldn't be reached for a moment. vcert returns most
+// of them as text, so their message is checked too.
+func isNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, substring := range networkErrorSubstrings {
+		if strings.Contains(msg, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// retrieveCertificate polls Venafi until the certificate is issued, waiting between attempts with an exponential backoff
+// so quick approvals are picked up fast without hammering Venafi on slow ones, or with the role fixed poll interval. The
+// backoff waits are jittered so a batch of pending requests doesn't poll in lockstep. It gives up after the role retrieve
+// timeout, or after timeout when the role doesn't set one. A rejected request ends the polling right away, while network
+// errors are polled again up to maxRetrieveNetworkErrors times in a row.
+func (b *backend) retrieveCertificate(ctx context.Context, cl endpoint.Connector, roleName string, role *roleEntry, pickupReq *certificate.Request,
+	timeout time.Duration) (
+	*certificate.PEMCollection, error) {
+
+	//a zero timeout makes vcert check the status once instead of running its own polling loop
+	onceReq := *pickupReq
+	onceReq.Timeout = 0
+
+	if role.RetrieveTimeout > 0 {
+		timeout = role.RetrieveTimeout
+	}
+
+	startTime := time.Now()
+	delay := role.PollBackoffBase
+	if role.PollInterval > 0 {
+		delay = role.PollInterval
+	}
+	if delay <= 0 {
+		delay = defaultPollBackoffBase
+	}
+	networkErrors := 0
+	for attempt := 1; ; attempt++ {
+		//the request may have been cancelled while the previous check was running
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var pcc *certificate.PEMCollection
+		err := b.withRequestSlot(ctx, func() (err error) {
+			pcc, err = cl.RetrieveCertificate(&onceReq)
+			return err
+		})
+		if status, rejected := rejectionStatus(err); rejected {
+			return nil, errCertificateRejected{PickupID: pickupReq.PickupID, Status: status}
+		}
+		if isNetworkError(err) {
+			networkErrors++
+			if networkErrors > maxRetrieveNetworkErrors {
+				return nil, err
+			}
+			b.Logger().Debug(fmt.Sprintf("Network error retrieving certificate %s: %s", pickupReq.PickupID, err))
+		} else if !isPickupPending(err) {
+			return pcc, err
+		} else {
+			networkErrors = 0
+			b.recordPendingPoll(roleName)
+		}
+
+		remaining := timeout - time.Since(startTime)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("certificate still pending after %s, retry later using pickup ID %s: %w",
+				timeout, pickupReq.PickupID, endpoint.ErrRetrieveCertificateTimeout{CertificateID: pickupReq.PickupID})
+		}
+		wait := delay
+		if role.PollInterval <= 0 {
+			wait = pollJitter(delay)
+		}
+		if wait > remaining {
+			wait = remaining
+		}
+
+		b.Logger().Debug(fmt.Sprintf("Certificate %s is pending, retrieving it again in %s (attempt %d)", pickupReq.PickupID, wait, attempt))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		delay = nextPollDelay(delay, role)
+	}
+}
+
+// pollJitter returns a random wait between half the delay and the delay
+func pollJitter(delay time.Duration) time.Duration {
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// nextPollDelay multiplies the delay by the role backoff factor, capped to the role max delay. A role poll interval
+// keeps the delay fixed instead.
+func nextPollDelay(delay time.Duration, role *roleEntry) time.Duration {
+	if role.PollInterval > 0 {
+		return role.PollInterval
+	}
+	if role.pollBackoffFactor() > 1 {
+		delay = delay * time.Duration(role.pollBackoffFactor())
+	}
+	if delay > role.pollBackoffMax() {
+		delay = role.pollBackoffMax()
+	}
+	if delay <= 0 {
+		delay = defaultPollBackoffBase
+	}
+	return delay
+}
@@ -0,0 +1,211 @@
+package pki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/hashicorp/vault/sdk/framework"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextPollDelay(t *testing.T) {
+	role := &roleEntry{
+		PollBackoffBase:   time.Second,
+		PollBackoffFactor: 2,
+		PollBackoffMax:    5 * time.Second,
+	}
+
+	delay := role.PollBackoffBase
+	var delays []time.Duration
+	for i := 0; i < 5; i++ {
+		delay = nextPollDelay(delay, role)
+		delays = append(delays, delay)
+	}
+
+	expected := []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i := range expected {
+		if delays[i] != expected[i] {
+			t.Fatalf("Expecting delays %v but got %v", expected, delays)
+		}
+	}
+
+	//roles stored before the backoff options existed have them unset
+	if delay := nextPollDelay(0, &roleEntry{}); delay != defaultPollBackoffBase {
+		t.Fatalf("Expecting delay %s for a role without backoff options but got %s", defaultPollBackoffBase, delay)
+	}
+}
+
+func TestPollJitter(t *testing.T) {
+	delay := 4 * time.Second
+	for i := 0; i < 100; i++ {
+		if wait := pollJitter(delay); wait < delay/2 || wait > delay {
+			t.Fatalf("Expecting a wait between %s and %s but got %s", delay/2, delay, wait)
+		}
+	}
+	if wait := pollJitter(time.Nanosecond); wait > time.Nanosecond {
+		t.Fatalf("Expecting a wait of at most 1ns but got %s", wait)
+	}
+}
+
+// pendingConnector is a fake connector that keeps the certificate pending for a number of retrievals
+type pendingConnector struct {
+	*fake.Connector
+	pendingRetrievals int
+	retrievals        int
+}
+
+func (c *pendingConnector) RetrieveCertificate(req *certificate.Request) (*certificate.PEMCollection, error) {
+	c.retrievals++
+	if req.Timeout != 0 {
+		return nil, fmt.Errorf("expecting a single check, but the timeout is %s", req.Timeout)
+	}
+	if c.retrievals <= c.pendingRetrievals {
+		return nil, endpoint.ErrCertificatePending{CertificateID: req.PickupID, Status: "Pending approval"}
+	}
+	return &certificate.PEMCollection{Certificate: "certificate"}, nil
+}
+
+func TestRetrieveCertificateWithBackoff(t *testing.T) {
+	b := &backend{}
+	b.Backend = &framework.Backend{}
+	role := &roleEntry{
+		PollBackoffBase:   10 * time.Millisecond,
+		PollBackoffFactor: 2,
+		PollBackoffMax:    20 * time.Millisecond,
+	}
+
+	cl := &pendingConnector{Connector: fake.NewConnector(false, nil), pendingRetrievals: 3}
+	pcc, err := b.retrieveCertificate(context.Background(), cl, "", role, &certificate.Request{PickupID: "id", Timeout: time.Minute}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pcc.Certificate != "certificate" || cl.retrievals != 4 {
+		t.Fatalf("Expecting the certificate after 4 retrievals but got %#v after %d", pcc, cl.retrievals)
+	}
+
+	cl = &pendingConnector{Connector: fake.NewConnector(false, nil), pendingRetrievals: 1000}
+	_, err = b.retrieveCertificate(context.Background(), cl, "", role, &certificate.Request{PickupID: "id"}, 50*time.Millisecond)
+	var timeoutErr endpoint.ErrRetrieveCertificateTimeout
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Expecting a timeout error but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "still pending after 50ms") || !strings.Contains(err.Error(), "pickup ID id") {
+		t.Fatalf("Expecting the error to give the wait and the pickup ID but got %v", err)
+	}
+}
+
+func TestRetrieveCertificateWithPollInterval(t *testing.T) {
+	b := &backend{}
+	b.Backend = &framework.Backend{}
+	role := &roleEntry{
+		PollBackoffBase:   time.Hour,
+		PollBackoffFactor: 2,
+		PollInterval:      10 * time.Millisecond,
+		RetrieveTimeout:   55 * time.Millisecond,
+	}
+
+	if delay := nextPollDelay(role.PollInterval, role); delay != role.PollInterval {
+		t.Fatalf("Expecting the fixed poll interval %s but got %s", role.PollInterval, delay)
+	}
+
+	//the role retrieve timeout takes precedence over the server timeout
+	cl := &pendingConnector{Connector: fake.NewConnector(false, nil), pendingRetrievals: 1000}
+	_, err := b.retrieveCertificate(context.Background(), cl, "", role, &certificate.Request{PickupID: "id"}, time.Hour)
+	if !isPickupPending(err) {
+		t.Fatalf("Expecting a timeout error but got %v", err)
+	}
+	if cl.retrievals < 4 {
+		t.Fatalf("Expecting a check every 10ms during 55ms but got %d checks", cl.retrievals)
+	}
+}
+
+func TestRetrieveCertificateCancelled(t *testing.T) {
+	b := &backend{}
+	b.Backend = &framework.Backend{}
+	role := &roleEntry{PollInterval: time.Hour}
+
+	//cancelled while waiting for the next check
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	cl := &pendingConnector{Connector: fake.NewConnector(false, nil), pendingRetrievals: 1000}
+	startTime := time.Now()
+	_, err := b.retrieveCertificate(ctx, cl, "", role, &certificate.Request{PickupID: "id"}, time.Hour)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expecting the context error but got %v", err)
+	}
+	if time.Since(startTime) > time.Minute || cl.retrievals != 1 {
+		t.Fatalf("Expecting the retrieval to stop after the first check but got %d checks", cl.retrievals)
+	}
+
+	//cancelled before the first check
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	cl = &pendingConnector{Connector: fake.NewConnector(false, nil)}
+	_, err = b.retrieveCertificate(ctx, cl, "", role, &certificate.Request{PickupID: "id"}, time.Hour)
+	if err != context.Canceled || cl.retrievals != 0 {
+		t.Fatalf("Expecting no check with a cancelled context but got %d checks and error %v", cl.retrievals, err)
+	}
+}
+
+// scriptedConnector is a fake connector that returns the given errors on its first retrievals, then the certificate
+type scriptedConnector struct {
+	*fake.Connector
+	errors     []error
+	retrievals int
+}
+
+func (c *scriptedConnector) RetrieveCertificate(req *certificate.Request) (*certificate.PEMCollection, error) {
+	c.retrievals++
+	if c.retrievals <= len(c.errors) {
+		return nil, c.errors[c.retrievals-1]
+	}
+	return &certificate.PEMCollection{Certificate: "certificate"}, nil
+}
+
+func TestRetrieveCertificateErrors(t *testing.T) {
+	b := &backend{}
+	b.Backend = &framework.Backend{}
+	role := &roleEntry{PollInterval: time.Millisecond}
+	networkErr := fmt.Errorf("unable to retrieve: read tcp 10.0.0.1:443: connection reset by peer")
+
+	//a rejection ends the polling right away
+	cl := &scriptedConnector{Connector: fake.NewConnector(false, nil), errors: []error{
+		endpoint.ErrCertificatePending{CertificateID: "id", Status: "Pending approval"},
+		endpoint.ErrCertificatePending{CertificateID: "id", Status: "Request rejected by security team"},
+	}}
+	_, err := b.retrieveCertificate(context.Background(), cl, "", role, &certificate.Request{PickupID: "id"}, time.Minute)
+	var rejected errCertificateRejected
+	if !errors.As(err, &rejected) || rejected.Status != "Request rejected by security team" {
+		t.Fatalf("Expecting a rejection error but got %v", err)
+	}
+	if isPickupPending(err) || cl.retrievals != 2 {
+		t.Fatalf("Expecting the rejection not to be pending after 2 checks but got %d checks", cl.retrievals)
+	}
+
+	//network errors are polled again
+	cl = &scriptedConnector{Connector: fake.NewConnector(false, nil), errors: []error{networkErr, networkErr, networkErr}}
+	pcc, err := b.retrieveCertificate(context.Background(), cl, "", role, &certificate.Request{PickupID: "id"}, time.Minute)
+	if err != nil || pcc.Certificate != "certificate" {
+		t.Fatalf("Expecting the certificate after network errors but got %v", err)
+	}
+
+	//but not forever
+	cl = &scriptedConnector{Connector: fake.NewConnector(false, nil), errors: []error{networkErr, networkErr, networkErr, networkErr}}
+	_, err = b.retrieveCertificate(context.Background(), cl, "", role, &certificate.Request{PickupID: "id"}, time.Minute)
+	if err != networkErr || cl.retrievals != maxRetrieveNetworkErrors+1 {
+		t.Fatalf("Expecting the network error after %d checks but got %v after %d", maxRetrieveNetworkErrors+1, err, cl.retrievals)
+	}
+
+	//other errors end the polling
+	otherErr := fmt.Errorf("Failed to retrieve certificate. Status: FAILED")
+	cl = &scriptedConnector{Connector: fake.NewConnector(false, nil), errors: []error{otherErr}}
+	_, err = b.retrieveCertificate(context.Background(), cl, "", role, &certificate.Request{PickupID: "id"}, time.Minute)
+	if err != otherErr || cl.retrievals != 1 {
+		t.Fatalf("Expecting the error after a single check but got %v after %d", err, cl.retrievals)
+	}
+}
@@ -0,0 +1,70 @@
+package pki
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
+)
+
+// defaultRenewBefore is how much of their lifetime certificates have left when renewal is hinted, unless the role sets
+// "renew_before"
+const defaultRenewBefore = "33%"
+
+// parseRenewBefore reads a "renew_before" value, either a percentage of the certificate lifetime like "33%" or a
+// duration like "720h" or a number of seconds. One of the percentage or the duration is returned.
+func parseRenewBefore(renewBefore string) (float64, time.Duration, error) {
+	renewBefore = strings.TrimSpace(renewBefore)
+	if strings.HasSuffix(renewBefore, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(renewBefore, "%")), 64)
+		if err != nil || percent <= 0 || percent >= 100 {
+			return 0, 0, fmt.Errorf(errorTextRenewBeforeInvalid, renewBefore)
+		}
+		return percent, 0, nil
+	}
+	duration, err := parseutil.ParseDurationSecond(renewBefore)
+	if err != nil || duration <= 0 {
+		return 0, 0, fmt.Errorf(errorTextRenewBeforeInvalid, renewBefore)
+	}
+	return 0, duration, nil
+}
+
+// renewAfter returns when the certificate should be renewed, which is when it has "renew_before" of its lifetime left.
+// The hint is never before the certificate becomes valid.
+func renewAfter(cert *x509.Certificate, renewBefore string) (time.Time, error) {
+	percent, duration, err := parseRenewBefore(renewBefore)
+	if err != nil {
+		return time.Time{}, err
+	}
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	if percent > 0 {
+		duration = time.Duration(float64(lifetime) * percent / 100)
+	}
+	if duration > lifetime {
+		return cert.NotBefore, nil
+	}
+	return cert.NotAfter.Add(-duration), nil
+}
+
+// addRenewAfter adds to the response data when the certificate should be renewed, as a Unix timestamp like its
+// expiration. Roles are validated when written, so the hint is only left out for roles stored with an invalid setting.
+func addRenewAfter(respData map[string]interface{}, cert *x509.Certificate, role *roleEntry) {
+	if renewAt, err := renewAfter(cert, role.renewBefore()); err == nil {
+		respData["renew_after"] = renewAt.Unix()
+	}
+}
+
+// renewBefore returns the renewal hint setting of the role
+func (r *roleEntry) renewBefore() string {
+	if strings.TrimSpace(r.RenewBefore) == "" {
+		return defaultRenewBefore
+	}
+	return r.RenewBefore
+}
+
+const (
+	errorTextRenewBeforeInvalid = `"renew_before" must be a percentage of the certificate lifetime between 0%% and 100%% or a positive duration, not %q`
+)
@@ -0,0 +1,42 @@
+package pki
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestRenewAfter(t *testing.T) {
+	notBefore := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.Add(90 * 24 * time.Hour)}
+
+	cases := map[string]time.Time{
+		"":      notBefore.Add(90 * 24 * time.Hour).Add(-time.Duration(float64(90*24*time.Hour) * 0.33)),
+		"50%":   notBefore.Add(45 * 24 * time.Hour),
+		"720h":  notBefore.Add(60 * 24 * time.Hour),
+		"86400": notBefore.Add(89 * 24 * time.Hour),
+		"2400h": notBefore,
+	}
+	for renewBefore, expected := range cases {
+		role := &roleEntry{RenewBefore: renewBefore}
+		renewAt, err := renewAfter(cert, role.renewBefore())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !renewAt.Equal(expected) {
+			t.Fatalf("Expecting renewal after %s with renew_before %q but got %s", expected, renewBefore, renewAt)
+		}
+	}
+
+	for _, renewBefore := range []string{"0%", "100%", "abc%", "-1h", "0", "soon"} {
+		if _, _, err := parseRenewBefore(renewBefore); err == nil {
+			t.Fatalf("Expecting renew_before %q to be rejected", renewBefore)
+		}
+	}
+
+	respData := map[string]interface{}{}
+	addRenewAfter(respData, cert, &roleEntry{RenewBefore: "50%"})
+	if respData["renew_after"] != notBefore.Add(45*24*time.Hour).Unix() {
+		t.Fatalf("Expecting renew_after in the response but got %#v", respData)
+	}
+}
@@ -0,0 +1,116 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/hashicorp/vault/sdk/logical"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// tppCertificateResetPath is the Venafi Platform endpoint that clears the pending request of a certificate. vcert
+	// doesn't call it, so the request is sent by the backend.
+	tppCertificateResetPath = "/vedsdk/certificates/reset"
+	// resetTimeout limits the reset of an abandoned request, which runs after the request of the caller is over
+	resetTimeout = 30 * time.Second
+)
+
+type certificateResetRequest struct {
+	CertificateDN string `json:"CertificateDN"`
+	Restart       bool   `json:"Restart"`
+}
+
+type certificateResetResponse struct {
+	ProcessingResetCompleted bool   `json:"ProcessingResetCompleted"`
+	Error                    string `json:"Error"`
+}
+
+// tppURL returns the URL of a Venafi Platform API path, for a base URL given with or without "/vedsdk"
+func tppURL(baseURL string, path string) string {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	if strings.HasSuffix(strings.ToLower(baseURL), "/vedsdk") {
+		baseURL = baseURL[:len(baseURL)-len("/vedsdk")]
+	}
+	return baseURL + path
+}
+
+// resetCertificateRequest clears the pending request of the certificate on Venafi Platform, so it isn't left waiting
+// for a workflow nobody will pick up. Only access tokens can be used, vcert keeps the session of a user and password to
+// itself.
+func resetCertificateRequest(ctx context.Context, cfg *vcert.Config, certificateDN string) error {
+	if cfg.ConnectorType != endpoint.ConnectorTypeTPP {
+		return fmt.Errorf(errorTextResetNotTPP)
+	}
+	if cfg.Credentials == nil || cfg.Credentials.AccessToken == "" {
+		return fmt.Errorf(errorTextResetNoAccessToken)
+	}
+	client, err := configHTTPClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(certificateResetRequest{CertificateDN: certificateDN})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tppURL(cfg.BaseUrl, tppCertificateResetPath), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+cfg.Credentials.AccessToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code on TPP Certificate Reset. Status: %s", resp.Status)
+	}
+	var resetResp certificateResetResponse
+	if err := json.NewDecoder(resp.Body).Decode(&resetResp); err != nil {
+		return fmt.Errorf("failed to decode TPP Certificate Reset response: %s", err)
+	}
+	if resetResp.Error != "" {
+		return fmt.Errorf("TPP failed to reset certificate %s: %s", certificateDN, resetResp.Error)
+	}
+	return nil
+}
+
+// resetAbandonedRequest resets the request of a certificate that the role gave up retrieving, when the role asks for
+// it. It runs with its own deadline, as the request of the caller may have been cancelled. It returns if the request
+// was reset.
+func (b *backend) resetAbandonedRequest(req *logical.Request, roleName string, role *roleEntry, connectorType endpoint.ConnectorType,
+	requestID string) bool {
+	if !role.ResetAbandonedRequests || connectorType != endpoint.ConnectorTypeTPP {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resetTimeout)
+	defer cancel()
+
+	cfg, err := b.getConfig(ctx, req, roleName, false)
+	if err == nil {
+		err = resetCertificateRequest(ctx, cfg, certificateDN(connectorType, requestID))
+	}
+	if err != nil {
+		b.Logger().Error(fmt.Sprintf("Failed to reset abandoned certificate request %s: %s", requestID, err))
+		return false
+	}
+	b.Logger().Info(fmt.Sprintf("Reset abandoned certificate request %s of role %s", requestID, roleName))
+	return true
+}
+
+const (
+	errorTextResetNotTPP        = "only Venafi Platform certificate requests can be reset"
+	errorTextResetNoAccessToken = "resetting a certificate request requires a Venafi secret with an access token"
+)
@@ -0,0 +1,70 @@
+package pki
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTPPURL(t *testing.T) {
+	cases := map[string]string{
+		"https://tpp.example.com/vedsdk":  "https://tpp.example.com/vedsdk/certificates/reset",
+		"https://tpp.example.com/vedsdk/": "https://tpp.example.com/vedsdk/certificates/reset",
+		"https://tpp.example.com":         "https://tpp.example.com/vedsdk/certificates/reset",
+		"tpp.example.com:5008/VEDSDK":     "https://tpp.example.com:5008/vedsdk/certificates/reset",
+	}
+	for baseURL, expected := range cases {
+		if url := tppURL(baseURL, tppCertificateResetPath); url != expected {
+			t.Fatalf("Expecting URL %s for %s but got %s", expected, baseURL, url)
+		}
+	}
+}
+
+func TestResetCertificateRequest(t *testing.T) {
+	var received certificateResetRequest
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != tppCertificateResetPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode request body: %s", err)
+		}
+		if received.CertificateDN == `\VED\Policy\failing` {
+			w.Write([]byte(`{"Error":"certificate does not exist"}`))
+			return
+		}
+		w.Write([]byte(`{"ProcessingResetCompleted":true}`))
+	}))
+	defer server.Close()
+
+	cfg := &vcert.Config{
+		ConnectorType: endpoint.ConnectorTypeTPP,
+		BaseUrl:       server.URL + "/vedsdk",
+		Credentials:   &endpoint.Authentication{AccessToken: "secret-access-token"},
+	}
+	if err := resetCertificateRequest(context.Background(), cfg, `\VED\Policy\cert`); err != nil {
+		t.Fatal(err)
+	}
+	if received.CertificateDN != `\VED\Policy\cert` || received.Restart {
+		t.Fatalf("Expecting the request of the certificate to be reset without restarting it but got %#v", received)
+	}
+	if authorization != "Bearer secret-access-token" {
+		t.Fatalf("Expecting the access token to be sent but got %q", authorization)
+	}
+
+	if err := resetCertificateRequest(context.Background(), cfg, `\VED\Policy\failing`); err == nil {
+		t.Fatal("Expecting the error returned by Venafi Platform to fail the reset")
+	}
+
+	cfg.Credentials = &endpoint.Authentication{User: "admin", Password: "secret-password"}
+	if err := resetCertificateRequest(context.Background(), cfg, `\VED\Policy\cert`); err == nil || err.Error() != errorTextResetNoAccessToken {
+		t.Fatalf("Expecting a user and password not to be able to reset requests but got %v", err)
+	}
+}
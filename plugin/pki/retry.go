@@ -0,0 +1,95 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRateLimitWait = 1 * time.Second
+	// defaultRateLimitMaxAttempts is the number of retries of roles without rate_limit_max_attempts
+	defaultRateLimitMaxAttempts = 3
+	// defaultRateLimitMaxWait is the maximum wait between retries of roles without rate_limit_max_wait
+	defaultRateLimitMaxWait = 30 * time.Second
+)
+
+// retryAfterRegex finds the Retry-After hint of Venafi in an error message. vcert doesn't expose the response headers,
+// so the hint is only known when it's part of the error text.
+var retryAfterRegex = regexp.MustCompile(`(?i)retry-after:?\s*(\d+)`)
+
+// isRateLimitError validates if the error returned by vcert is caused by Venafi throttling the requests. At this moment the
+// only way to do it is using the error message, the same way it's done for expired access tokens.
+func isRateLimitError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	if getStatusCode(msg) == HTTP_TOO_MANY_REQUESTS {
+		return true
+	}
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "too many requests") || strings.Contains(msg, "rate limit")
+}
+
+// isRetryableError validates if the error is transient, either because Venafi is throttling the requests or because its
+// message contains one of the role's retryable_error_substrings
+func isRetryableError(err error, role *roleEntry) bool {
+	if err == nil {
+		return false
+	}
+	if isRateLimitError(err) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, substring := range role.RetryableErrorSubstrings {
+		if substring != "" && strings.Contains(msg, strings.ToLower(substring)) {
+			return true
+		}
+	}
+	return false
+}
+
+// getRetryAfter returns the wait time hinted by Venafi in the error message, or 0 if there is no hint
+func getRetryAfter(msg string) time.Duration {
+	match := retryAfterRegex.FindStringSubmatch(msg)
+	if len(match) < 2 {
+		return 0
+	}
+	seconds, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// retryOnTransientError runs operation and retries it while Venafi keeps answering with a rate limit or another retryable
+// error, up to the role's max attempts. Each wait honors the Retry-After hint found in the error text, or else is longer
+// than the previous one, capped to the role's max wait.
+func (b *backend) retryOnTransientError(ctx context.Context, role *roleEntry, operationName string, operation func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = operation()
+		if !isRetryableError(err, role) || attempt >= role.rateLimitMaxAttempts() {
+			return err
+		}
+
+		wait := getRetryAfter(err.Error())
+		if wait == 0 {
+			wait = defaultRateLimitWait * time.Duration(attempt+1)
+		}
+		if wait > role.rateLimitMaxWait() {
+			wait = role.rateLimitMaxWait()
+		}
+
+		b.Logger().Debug(fmt.Sprintf("%s failed with a transient error, retrying in %s (attempt %d of %d): %s", operationName, wait, attempt+1, role.rateLimitMaxAttempts(), err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
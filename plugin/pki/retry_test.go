@@ -0,0 +1,111 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestIsRateLimitError(t *testing.T) {
+	rateLimited := []error{
+		fmt.Errorf("unexpected status code on TPP Certificate Request.\n Status:\n 429 Too Many Requests"),
+		fmt.Errorf("vcert error: server error: Invalid status: 429 Too Many Requests"),
+		fmt.Errorf("rate limit exceeded"),
+	}
+	for _, err := range rateLimited {
+		if !isRateLimitError(err) {
+			t.Fatalf("Expecting %q to be a rate limit error", err)
+		}
+	}
+
+	notRateLimited := []error{
+		nil,
+		fmt.Errorf("vcert error: server error: Invalid status: 401 Unauthorized"),
+		fmt.Errorf("zone not found"),
+	}
+	for _, err := range notRateLimited {
+		if isRateLimitError(err) {
+			t.Fatalf("Expecting %q not to be a rate limit error", err)
+		}
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	role := &roleEntry{RetryableErrorSubstrings: []string{"Connection Reset", "503"}}
+
+	if !isRetryableError(fmt.Errorf("read tcp 10.0.0.1:443: connection reset by peer"), role) {
+		t.Fatalf("Expecting error matching a retryable substring to be retryable")
+	}
+	if !isRetryableError(fmt.Errorf("Invalid status: 429 Too Many Requests"), role) {
+		t.Fatalf("Expecting rate limit error to be retryable")
+	}
+	if isRetryableError(fmt.Errorf("zone not found"), role) {
+		t.Fatalf("Expecting error not matching any retryable substring not to be retryable")
+	}
+}
+
+func TestGetRetryAfter(t *testing.T) {
+	if wait := getRetryAfter("429 Too Many Requests. Retry-After: 7"); wait != 7*time.Second {
+		t.Fatalf("Expecting 7s wait but got %s", wait)
+	}
+	if wait := getRetryAfter("429 Too Many Requests"); wait != 0 {
+		t.Fatalf("Expecting no wait but got %s", wait)
+	}
+}
+
+func TestRetryOnRateLimit(t *testing.T) {
+	b, _ := createBackendWithStorage(t)
+	maxAttempts := 2
+	role := &roleEntry{
+		RateLimitMaxAttempts: &maxAttempts,
+		RateLimitMaxWait:     time.Millisecond,
+	}
+
+	calls := 0
+	err := b.retryOnTransientError(context.Background(), role, "test", func() error {
+		calls++
+		if calls < 2 {
+			return fmt.Errorf("Invalid status: 429 Too Many Requests. Retry-After: 60")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("Expecting 2 calls but got %d", calls)
+	}
+
+	calls = 0
+	err = b.retryOnTransientError(context.Background(), role, "test", func() error {
+		calls++
+		return fmt.Errorf("Invalid status: 429 Too Many Requests")
+	})
+	if !isRateLimitError(err) {
+		t.Fatalf("Expecting rate limit error but got %v", err)
+	}
+	if calls != maxAttempts+1 {
+		t.Fatalf("Expecting %d calls but got %d", maxAttempts+1, calls)
+	}
+
+	calls = 0
+	err = b.retryOnTransientError(context.Background(), role, "test", func() error {
+		calls++
+		return fmt.Errorf("zone not found")
+	})
+	if err == nil || calls != 1 {
+		t.Fatalf("Expecting a single call for a non rate limit error but got %d", calls)
+	}
+
+	//roles stored before rate_limit_max_attempts existed are retried as new roles are by default
+	upgraded := &roleEntry{RateLimitMaxWait: time.Millisecond}
+	calls = 0
+	b.retryOnTransientError(context.Background(), upgraded, "test", func() error {
+		calls++
+		return fmt.Errorf("Invalid status: 429 Too Many Requests")
+	})
+	if calls != defaultRateLimitMaxAttempts+1 {
+		t.Fatalf("Expecting %d calls for a role without rate_limit_max_attempts but got %d", defaultRateLimitMaxAttempts+1, calls)
+	}
+}
@@ -1,7 +1,14 @@
 package pki
 
 import (
+	"context"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"strings"
+	"time"
 )
 
 // SecretCertsType is the name used to identify this type
@@ -12,21 +19,147 @@ func secretCerts(b *backend) *framework.Secret {
 		Type: SecretCertsType,
 		Fields: map[string]*framework.FieldSchema{
 			"certificate": &framework.FieldSchema{
-				Type: framework.TypeString,
-				Description: `The PEM-encoded concatenated certificate and
-issuing certificate authority`,
+				Type:        framework.TypeString,
+				Description: "The PEM-encoded certificate",
+			},
+			"certificate_chain": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The PEM-encoded certificate concatenated with its chain",
 			},
 			"private_key": &framework.FieldSchema{
 				Type:        framework.TypeString,
 				Description: "The PEM-encoded private key for the certificate",
 			},
-			"serial": &framework.FieldSchema{
+			"serial_number": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `The serial number of the certificate, for handy
 reference`,
 			},
 		},
 
-		Revoke: b.venafiCertRevoke,
+		Renew:  b.secretCertsRenew,
+		Revoke: b.secretCertsRevoke,
+	}
+}
+
+// secretCertsInternalData is kept with the lease of a certificate so it can be revoked in Venafi along with the lease
+// and marked revoked at the path it's stored at, which is empty when the role doesn't store certificates.
+func secretCertsInternalData(roleName, serialNumber, certDN, thumbprint, pickupID, storagePath string, expiration time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"serial_number":  serialNumber,
+		"storage_path":   storagePath,
+		"role":           roleName,
+		"certificate_dn": certDN,
+		"thumbprint":     thumbprint,
+		"pickup_id":      pickupID,
+		"expiration":     expiration.UTC().Format(time.RFC3339),
+	}
+}
+
+// secretCertsRenew extends the lease of a certificate by the role lease_default_ttl, up to the certificate expiration,
+// and never beyond the role max_ttl. Leases created by earlier versions don't know when their certificate expires and
+// can't be renewed.
+func (b *backend) secretCertsRenew(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	serialNumber, _ := req.Secret.InternalData["serial_number"].(string)
+	expirationString, _ := req.Secret.InternalData["expiration"].(string)
+	if expirationString == "" {
+		return logical.ErrorResponse(fmt.Sprintf("lease of certificate %s has no expiration and can't be renewed", serialNumber)), nil
+	}
+	expiration, err := time.Parse(time.RFC3339, expirationString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiration of lease of certificate %s: %s", serialNumber, err)
+	}
+	if !time.Now().Before(expiration) {
+		return logical.ErrorResponse(fmt.Sprintf("certificate %s has expired, its lease can't be renewed", serialNumber)), nil
+	}
+
+	issuedAt := req.Secret.IssueTime
+	if issuedAt.IsZero() {
+		issuedAt = time.Now()
+	}
+	maxTTL := expiration.Sub(issuedAt)
+	ttl := time.Until(expiration)
+	if roleName, _ := req.Secret.InternalData["role"].(string); roleName != "" {
+		role, err := b.getRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.MaxTTL > 0 && role.MaxTTL < maxTTL {
+			maxTTL = role.MaxTTL
+		}
+		if role != nil {
+			if role.LeaseDefaultTTL > 0 && role.LeaseDefaultTTL < ttl {
+				ttl = role.LeaseDefaultTTL
+			}
+			ttl, _ = clampLeaseTTL(roundLeaseTTL(ttl, role.leaseRoundTo()), role.LeaseMaxTTL, 0)
+		}
+	}
+	if mountMaxTTL := b.System().MaxLeaseTTL(); mountMaxTTL > 0 && mountMaxTTL < maxTTL {
+		maxTTL = mountMaxTTL
+	}
+
+	resp := &logical.Response{Secret: req.Secret}
+	resp.Secret.TTL = ttl
+	resp.Secret.MaxTTL = maxTTL
+	return resp, nil
+}
+
+// secretCertsRevoke revokes in Venafi the certificate of a revoked or expired lease when the role has
+// "revoke_on_lease_end". Vault ends leases the same way whether they were revoked or expired, and leases are often
+// shorter than the certificate, so it's up to the role. Leases created by earlier versions only have the serial number
+// and aren't revoked in Venafi, nor are certificates of connectors that can't revoke them.
+func (b *backend) secretCertsRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	internalString := func(key string) string {
+		v, _ := req.Secret.InternalData[key].(string)
+		return v
+	}
+	roleName := internalString("role")
+	serialNumber := internalString("serial_number")
+	revReq := &certificate.RevocationRequest{
+		CertificateDN: internalString("certificate_dn"),
+		Thumbprint:    internalString("thumbprint"),
+		Reason:        revocationReasons["unspecified"],
+	}
+	if roleName == "" || (revReq.CertificateDN == "" && revReq.Thumbprint == "") {
+		b.Logger().Debug(fmt.Sprintf("Lease of certificate %s has no Venafi identifier, not revoking it in Venafi", serialNumber))
+		return nil, nil
+	}
+
+	//a lease whose role was deleted can't be revoked anymore, failing would only make Vault retry it
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		b.Logger().Warn(fmt.Sprintf("Role %s of the lease of certificate %s doesn't exist, not revoking it in Venafi", roleName, serialNumber))
+		return nil, nil
+	}
+	if !role.RevokeOnLeaseEnd {
+		b.Logger().Debug(fmt.Sprintf("Role %s doesn't revoke certificates when their lease ends, not revoking certificate %s in Venafi", roleName, serialNumber))
+		return nil, nil
+	}
+
+	cl, _, err := b.ClientVenafi(ctx, req.Storage, d, req, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if cl.GetType() != endpoint.ConnectorTypeTPP {
+		b.Logger().Debug(fmt.Sprintf("Certificate %s can't be revoked through the %s connector", serialNumber, cl.GetType()))
+		return nil, nil
+	}
+
+	b.Logger().Debug(fmt.Sprintf("Revoking certificate %s of revoked lease", serialNumber))
+	if err := cl.RevokeCertificate(revReq); err != nil && !isAlreadyRevoked(err) {
+		return nil, fmt.Errorf("failed to revoke certificate %s: %s", serialNumber, err)
+	}
+	//certificates stored by common name aren't found by their serial number, leases created by earlier versions
+	//don't know where the certificate is stored
+	certUID := serialNumber
+	if storagePath := internalString("storage_path"); storagePath != "" {
+		certUID = strings.TrimPrefix(storagePath, "certs/")
+	}
+	if err := markRevoked(ctx, req.Storage, certUID, "unspecified", time.Now()); err != nil {
+		return nil, err
 	}
+	return nil, nil
 }
@@ -0,0 +1,95 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+// signatureAlgorithms are the algorithms locally generated CSRs can be signed with, named as by x509.SignatureAlgorithm
+var signatureAlgorithms = map[string]x509.SignatureAlgorithm{
+	"SHA256-RSA":    x509.SHA256WithRSA,
+	"SHA384-RSA":    x509.SHA384WithRSA,
+	"SHA512-RSA":    x509.SHA512WithRSA,
+	"SHA256-RSAPSS": x509.SHA256WithRSAPSS,
+	"SHA384-RSAPSS": x509.SHA384WithRSAPSS,
+	"SHA512-RSAPSS": x509.SHA512WithRSAPSS,
+	"ECDSA-SHA256":  x509.ECDSAWithSHA256,
+	"ECDSA-SHA384":  x509.ECDSAWithSHA384,
+	"ECDSA-SHA512":  x509.ECDSAWithSHA512,
+}
+
+// parseSignatureAlgorithm returns the algorithm of a "signature_algorithm" value, ignoring its case
+func parseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	if alg, ok := signatureAlgorithms[strings.ToUpper(strings.TrimSpace(name))]; ok {
+		return alg, nil
+	}
+	var names []string
+	for n := range signatureAlgorithms {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf(errorTextSignatureAlgorithmUnknown, name, strings.Join(names, ", "))
+}
+
+// signatureAlgorithmKeyType returns the type of key, "rsa" or "ec", that can sign with the algorithm
+func signatureAlgorithmKeyType(alg x509.SignatureAlgorithm) string {
+	switch alg {
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		return "ec"
+	}
+	return "rsa"
+}
+
+// validateSignatureAlgorithm validates the role signature algorithm can sign CSRs with the keys of the role
+func validateSignatureAlgorithm(name, keyType string) error {
+	if strings.TrimSpace(name) == "" {
+		return nil
+	}
+	alg, err := parseSignatureAlgorithm(name)
+	if err != nil {
+		return err
+	}
+	if (keyType == "rsa" || keyType == "ec") && signatureAlgorithmKeyType(alg) != keyType {
+		return fmt.Errorf(errorTextSignatureAlgorithmKeyType, name, keyType)
+	}
+	return nil
+}
+
+// signCSRWithAlgorithm generates again the CSR of a request with a locally generated key, signing it with the given
+// algorithm instead of the default one of the key. vcert builds the CSR the same way but doesn't let the algorithm be set.
+func signCSRWithAlgorithm(certReq *certificate.Request, name string) error {
+	alg, err := parseSignatureAlgorithm(name)
+	if err != nil {
+		return err
+	}
+	if keyType := privateKeyType(certReq.PrivateKey); keyType != signatureAlgorithmKeyType(alg) {
+		return fmt.Errorf(errorTextSignatureAlgorithmKeyType, name, keyType)
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:            certReq.Subject,
+		Attributes:         certReq.Attributes,
+		SignatureAlgorithm: alg,
+	}
+	if !certReq.OmitSANs {
+		template.DNSNames = certReq.DNSNames
+		template.EmailAddresses = certReq.EmailAddresses
+		template.IPAddresses = certReq.IPAddresses
+		template.URIs = certReq.URIs
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, certReq.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to sign CSR with %s: %s", name, err)
+	}
+	return certReq.SetCSR(csr)
+}
+
+const (
+	errorTextSignatureAlgorithmUnknown = `unknown "signature_algorithm" %q, can be %s`
+	errorTextSignatureAlgorithmKeyType = `"signature_algorithm" %s can't sign with a key of type %q`
+)
@@ -0,0 +1,85 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+func TestValidateSignatureAlgorithm(t *testing.T) {
+	valid := map[string]string{
+		"":              "rsa",
+		"SHA384-RSA":    "rsa",
+		"sha512-rsapss": "rsa",
+		"ECDSA-SHA384":  "ec",
+		"SHA256-RSA":    "any",
+	}
+	for name, keyType := range valid {
+		if err := validateSignatureAlgorithm(name, keyType); err != nil {
+			t.Fatalf("Expecting signature algorithm %q to be valid for %s keys: %s", name, keyType, err)
+		}
+	}
+	invalid := map[string]string{
+		"MD5-RSA":      "rsa",
+		"SHA384-RSA":   "ec",
+		"ECDSA-SHA256": "rsa",
+	}
+	for name, keyType := range invalid {
+		if err := validateSignatureAlgorithm(name, keyType); err == nil {
+			t.Fatalf("Expecting signature algorithm %q to be rejected for %s keys", name, keyType)
+		}
+	}
+}
+
+func TestSignCSRWithAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		req      *certificate.Request
+		expected x509.SignatureAlgorithm
+	}{
+		{"SHA384-RSA", &certificate.Request{PrivateKey: rsaKey}, x509.SHA384WithRSA},
+		{"SHA512-RSAPSS", &certificate.Request{PrivateKey: rsaKey}, x509.SHA512WithRSAPSS},
+		{"ECDSA-SHA384", &certificate.Request{PrivateKey: ecKey}, x509.ECDSAWithSHA384},
+	}
+	for _, c := range cases {
+		c.req.Subject = pkix.Name{CommonName: "signature.example.com"}
+		c.req.DNSNames = []string{"signature.example.com"}
+		if err := signCSRWithAlgorithm(c.req, c.name); err != nil {
+			t.Fatal(err)
+		}
+		pemBlock, _ := pem.Decode(c.req.GetCSR())
+		if pemBlock == nil {
+			t.Fatalf("Expecting a PEM CSR signed with %s", c.name)
+		}
+		csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if csr.SignatureAlgorithm != c.expected || csr.CheckSignature() != nil {
+			t.Fatalf("Expecting a CSR signed with %s but got %s", c.expected, csr.SignatureAlgorithm)
+		}
+		if csr.Subject.CommonName != "signature.example.com" || len(csr.DNSNames) != 1 {
+			t.Fatalf("Expecting the CSR to keep the request names but got %s %v", csr.Subject.CommonName, csr.DNSNames)
+		}
+	}
+
+	if err := signCSRWithAlgorithm(&certificate.Request{PrivateKey: ecKey}, "SHA384-RSA"); err == nil {
+		t.Fatal("Expecting an RSA signature algorithm to be rejected for an EC key")
+	}
+}
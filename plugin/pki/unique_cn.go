@@ -0,0 +1,249 @@
+package pki
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/hashicorp/vault/sdk/logical"
+	"strings"
+	"time"
+)
+
+const (
+	// cnIndexPrefix holds an entry per stored certificate under the hash of its common name, so certificates can be
+	// looked up by common name without reading the whole store
+	cnIndexPrefix = "cn-index/"
+	// cnIndexBuiltPath marks the index as built for the certificates stored before it existed
+	cnIndexBuiltPath = "cn-index-built"
+)
+
+// cnIndexEntry points to the storage path of a certificate, relative to "certs/"
+type cnIndexEntry struct {
+	CertUID string `json:"cert_uid"`
+}
+
+// cnIndexDir returns the path listing the index entries of a common name. Common names are hashed as they may hold
+// slashes, and compared case insensitively.
+func cnIndexDir(commonName string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(commonName)))
+	return cnIndexPrefix + hex.EncodeToString(sum[:]) + "/"
+}
+
+// cnIndexPath returns the path of the index entry of a certificate
+func cnIndexPath(commonName, serialNumber string) string {
+	return cnIndexDir(commonName) + normalizeSerial(serialNumber)
+}
+
+// indexCertByCN records the certificate stored at path in the common name index
+func indexCertByCN(ctx context.Context, s logical.Storage, cert *x509.Certificate, path string) error {
+	serialNumber, err := certSerialNumber(cert)
+	if err != nil {
+		return err
+	}
+	entry, err := logical.StorageEntryJSON(cnIndexPath(cert.Subject.CommonName, serialNumber),
+		cnIndexEntry{CertUID: strings.TrimPrefix(path, "certs/")})
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// unindexCertByCN removes a certificate from the common name index
+func unindexCertByCN(ctx context.Context, s logical.Storage, cert *x509.Certificate) error {
+	serialNumber, err := certSerialNumber(cert)
+	if err != nil {
+		return err
+	}
+	return s.Delete(ctx, cnIndexPath(cert.Subject.CommonName, serialNumber))
+}
+
+// buildCNIndex indexes the certificates stored before the common name index existed. It reads the whole store once,
+// then marks the index as built. It runs when the plugin is initialized and on tidy.
+func buildCNIndex(ctx context.Context, s logical.Storage) error {
+	built, err := s.Get(ctx, cnIndexBuiltPath)
+	if err != nil {
+		return err
+	}
+	if built != nil {
+		return nil
+	}
+
+	keys, err := s.List(ctx, "certs/")
+	if err != nil {
+		return fmt.Errorf("failed to list stored certificates: %s", err)
+	}
+	for _, key := range keys {
+		stored, path, err := getStoredCert(ctx, s, key)
+		if err != nil {
+			return err
+		}
+		if stored == nil {
+			continue
+		}
+		if cert := parsePEMCertificate(stored.Certificate); cert != nil {
+			if err := indexCertByCN(ctx, s, cert, path); err != nil {
+				return fmt.Errorf("failed to index %s: %s", path, err)
+			}
+		}
+	}
+	return s.Put(ctx, &logical.StorageEntry{Key: cnIndexBuiltPath, Value: []byte("true")})
+}
+
+// indexedCert returns the certificate an index entry of the common name directory prefix points to, or nil when the
+// certificate was deleted, or replaced by one with another serial number when stored by common name
+func indexedCert(ctx context.Context, s logical.Storage, prefix, serial string) (*VenafiCert, *x509.Certificate, error) {
+	entry, err := s.Get(ctx, prefix+serial)
+	if err != nil {
+		return nil, nil, err
+	}
+	if entry == nil {
+		return nil, nil, nil
+	}
+	var index cnIndexEntry
+	if err := entry.DecodeJSON(&index); err != nil {
+		return nil, nil, err
+	}
+
+	stored, _, err := getStoredCert(ctx, s, index.CertUID)
+	if err != nil || stored == nil {
+		return nil, nil, err
+	}
+	parsedCertificate := parsePEMCertificate(stored.Certificate)
+	if parsedCertificate == nil {
+		return nil, nil, nil
+	}
+	storedSerial, err := certSerialNumber(parsedCertificate)
+	if err != nil {
+		return nil, nil, err
+	}
+	if normalizeSerial(storedSerial) != serial {
+		return nil, nil, nil
+	}
+	return stored, parsedCertificate, nil
+}
+
+// tidyCNIndex builds the common name index if it wasn't yet, and removes the entries whose certificate was deleted or
+// replaced
+func tidyCNIndex(ctx context.Context, s logical.Storage) (deleted int, err error) {
+	if err := buildCNIndex(ctx, s); err != nil {
+		return 0, err
+	}
+
+	dirs, err := s.List(ctx, cnIndexPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list the common name index: %s", err)
+	}
+	for _, dir := range dirs {
+		prefix := cnIndexPrefix + dir
+		serials, err := s.List(ctx, prefix)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list the common name index: %s", err)
+		}
+		for _, serial := range serials {
+			stored, _, err := indexedCert(ctx, s, prefix, serial)
+			if err != nil {
+				return deleted, err
+			}
+			if stored == nil {
+				if err := s.Delete(ctx, prefix+serial); err != nil {
+					return deleted, fmt.Errorf("failed to delete index entry %s: %s", prefix+serial, err)
+				}
+				deleted++
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// validCertWithCN validates if the stored certificate has the common name and is neither expired nor revoked
+func validCertWithCN(stored *VenafiCert, cert *x509.Certificate, commonName string, now time.Time) bool {
+	return stored.RevocationTime == 0 && strings.EqualFold(cert.Subject.CommonName, commonName) && !now.After(cert.NotAfter)
+}
+
+// findValidCertByCN looks in the common name index for a stored certificate with the given common name that is neither
+// expired nor revoked. When several are found the one that expires last is returned, or nil if there is none. The
+// lookup only reads the storage, the index is built when the plugin is initialized and repaired by tidy; until it's
+// built the whole store is read instead.
+func findValidCertByCN(ctx context.Context, s logical.Storage, commonName string) (*x509.Certificate, error) {
+	if commonName == "" {
+		return nil, nil
+	}
+	built, err := s.Get(ctx, cnIndexBuiltPath)
+	if err != nil {
+		return nil, err
+	}
+	if built == nil {
+		return findValidCertInStore(ctx, s, commonName)
+	}
+
+	prefix := cnIndexDir(commonName)
+	serials, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the certificates of %s: %s", commonName, err)
+	}
+
+	var found *x509.Certificate
+	now := time.Now()
+	for _, serial := range serials {
+		stored, parsedCertificate, err := indexedCert(ctx, s, prefix, serial)
+		if err != nil {
+			return nil, err
+		}
+		if stored == nil || !validCertWithCN(stored, parsedCertificate, commonName, now) {
+			continue
+		}
+		if found == nil || parsedCertificate.NotAfter.After(found.NotAfter) {
+			found = parsedCertificate
+		}
+	}
+	return found, nil
+}
+
+// findValidCertInStore is findValidCertByCN reading every stored certificate, for mounts whose index isn't built yet
+func findValidCertInStore(ctx context.Context, s logical.Storage, commonName string) (*x509.Certificate, error) {
+	keys, err := s.List(ctx, "certs/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored certificates: %s", err)
+	}
+
+	var found *x509.Certificate
+	now := time.Now()
+	for _, key := range keys {
+		stored, _, err := getStoredCert(ctx, s, key)
+		if err != nil {
+			return nil, err
+		}
+		if stored == nil {
+			continue
+		}
+		parsedCertificate := parsePEMCertificate(stored.Certificate)
+		if parsedCertificate == nil || !validCertWithCN(stored, parsedCertificate, commonName, now) {
+			continue
+		}
+		if found == nil || parsedCertificate.NotAfter.After(found.NotAfter) {
+			found = parsedCertificate
+		}
+	}
+	return found, nil
+}
+
+// requestCommonName returns the common name a request is going to be issued for, reading it from the CSR when the
+// request signs a user provided one
+func requestCommonName(certReq *certificate.Request) string {
+	if certReq.Subject.CommonName != "" {
+		return certReq.Subject.CommonName
+	}
+	pemBlock, _ := pem.Decode(certReq.GetCSR())
+	if pemBlock == nil {
+		return ""
+	}
+	csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+	if err != nil {
+		return ""
+	}
+	return csr.Subject.CommonName
+}
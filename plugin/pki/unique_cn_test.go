@@ -0,0 +1,113 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestFindValidCertByCN(t *testing.T) {
+	ctx := context.Background()
+	_, s := createBackendWithStorage(t)
+
+	storeCert := func(certPEM string, cert *x509.Certificate, revoked bool, index bool) string {
+		serialNumber, err := certSerialNumber(cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored := VenafiCert{Certificate: certPEM}
+		if revoked {
+			stored.RevocationTime = time.Now().Unix()
+		}
+		path := certStoragePath(storeBySerialString, "", serialNumber)
+		entry, err := logical.StorageEntryJSON(path, stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+		if index {
+			if err := indexCertByCN(ctx, s, cert, path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+
+	//stored before the index existed, found by reading the store until the index is built
+	legacyPEM, legacy, _ := issueTestCertificate(t, 1, "legacy.example.com", false, nil, nil)
+	storeCert(legacyPEM, legacy, false, false)
+	found, err := findValidCertByCN(ctx, s, "LEGACY.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.SerialNumber.Cmp(legacy.SerialNumber) != 0 {
+		t.Fatalf("Expecting the certificate stored before the index to be found but got %#v", found)
+	}
+	if keys, err := s.List(ctx, cnIndexPrefix); err != nil || len(keys) != 0 {
+		t.Fatalf("Expecting the lookup not to write the index but got %v, %v", keys, err)
+	}
+	if err := buildCNIndex(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	found, err = findValidCertByCN(ctx, s, "legacy.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.SerialNumber.Cmp(legacy.SerialNumber) != 0 {
+		t.Fatalf("Expecting the certificate stored before the index to be found once it's built but got %#v", found)
+	}
+
+	revokedPEM, revoked, _ := issueTestCertificate(t, 2, "revoked.example.com", false, nil, nil)
+	storeCert(revokedPEM, revoked, true, true)
+	if found, err := findValidCertByCN(ctx, s, "revoked.example.com"); err != nil || found != nil {
+		t.Fatalf("Expecting a revoked certificate not to be found but got %#v, %v", found, err)
+	}
+
+	deletedPEM, deleted, _ := issueTestCertificate(t, 3, "deleted.example.com", false, nil, nil)
+	path := storeCert(deletedPEM, deleted, false, true)
+	if err := s.Delete(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := findValidCertByCN(ctx, s, "deleted.example.com"); err != nil || found != nil {
+		t.Fatalf("Expecting a deleted certificate not to be found but got %#v, %v", found, err)
+	}
+	if keys, err := s.List(ctx, cnIndexDir("deleted.example.com")); err != nil || len(keys) != 1 {
+		t.Fatalf("Expecting the lookup not to remove the index entry of the deleted certificate but got %v, %v", keys, err)
+	}
+	if removed, err := tidyCNIndex(ctx, s); err != nil || removed != 1 {
+		t.Fatalf("Expecting tidy to remove the index entry of the deleted certificate but got %d, %v", removed, err)
+	}
+	if keys, err := s.List(ctx, cnIndexDir("deleted.example.com")); err != nil || len(keys) != 0 {
+		t.Fatalf("Expecting the index entry of the deleted certificate to be removed but got %v, %v", keys, err)
+	}
+}
+
+func TestInitializeBuildsCNIndex(t *testing.T) {
+	ctx := context.Background()
+	b, s := createBackendWithStorage(t)
+
+	certPEM, cert, _ := issueTestCertificate(t, 1, "legacy.example.com", false, nil, nil)
+	serialNumber, err := certSerialNumber(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := logical.StorageEntryJSON(certStoragePath(storeBySerialString, "", serialNumber), VenafiCert{Certificate: certPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Initialize(ctx, &logical.InitializationRequest{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := s.List(ctx, cnIndexDir("legacy.example.com")); err != nil || len(keys) != 1 {
+		t.Fatalf("Expecting the certificates stored before the index to be indexed when the plugin is initialized but got %v, %v", keys, err)
+	}
+}
@@ -0,0 +1,121 @@
+package pki
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	oidExtensionRequest     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+	oidExtensionKeyUsage    = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+	keyUsages = map[string]x509.KeyUsage{
+		"digital_signature":  x509.KeyUsageDigitalSignature,
+		"content_commitment": x509.KeyUsageContentCommitment,
+		"key_encipherment":   x509.KeyUsageKeyEncipherment,
+		"data_encipherment":  x509.KeyUsageDataEncipherment,
+		"key_agreement":      x509.KeyUsageKeyAgreement,
+		"cert_sign":          x509.KeyUsageCertSign,
+		"crl_sign":           x509.KeyUsageCRLSign,
+		"encipher_only":      x509.KeyUsageEncipherOnly,
+		"decipher_only":      x509.KeyUsageDecipherOnly,
+	}
+	extKeyUsageOIDs = map[string]asn1.ObjectIdentifier{
+		"server_auth":      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+		"client_auth":      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+		"code_signing":     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+		"email_protection": {1, 3, 6, 1, 5, 5, 7, 3, 4},
+		"time_stamping":    {1, 3, 6, 1, 5, 5, 7, 3, 8},
+		"ocsp_signing":     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+	}
+)
+
+// usageAttributes builds the extension request attribute asking for the key usages and extended key usages in the
+// CSR. vcert can't set them, but it keeps the attributes of the request in the CSR it generates. Whether they end up in
+// the certificate depends on the zone policy and the CA.
+func usageAttributes(keyUsageNames, extKeyUsageNames []string) ([]pkix.AttributeTypeAndValueSET, error) {
+	var extensions []pkix.AttributeTypeAndValue
+
+	if len(keyUsageNames) > 0 {
+		var usage x509.KeyUsage
+		for _, name := range keyUsageNames {
+			u, ok := keyUsages[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf(errorTextInvalidKeyUsage, name, strings.Join(usageNames(keyUsages), ", "))
+			}
+			usage |= u
+		}
+		value, err := asn1.Marshal(keyUsageBitString(usage))
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.AttributeTypeAndValue{Type: oidExtensionKeyUsage, Value: value})
+	}
+
+	if len(extKeyUsageNames) > 0 {
+		var oids []asn1.ObjectIdentifier
+		for _, name := range extKeyUsageNames {
+			oid, ok := extKeyUsageOIDs[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf(errorTextInvalidExtKeyUsage, name, strings.Join(usageNames(extKeyUsageOIDs), ", "))
+			}
+			oids = append(oids, oid)
+		}
+		value, err := asn1.Marshal(oids)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.AttributeTypeAndValue{Type: oidExtensionExtKeyUsage, Value: value})
+	}
+
+	if len(extensions) == 0 {
+		return nil, nil
+	}
+	return []pkix.AttributeTypeAndValueSET{{
+		Type:  oidExtensionRequest,
+		Value: [][]pkix.AttributeTypeAndValue{extensions},
+	}}, nil
+}
+
+// keyUsageBitString encodes the key usage as the bit string of the key usage extension, where bit 0 is digital
+// signature
+func keyUsageBitString(usage x509.KeyUsage) asn1.BitString {
+	var bits asn1.BitString
+	for i := 0; i < 9; i++ {
+		if usage&(1<<uint(i)) == 0 {
+			continue
+		}
+		for len(bits.Bytes) <= i/8 {
+			bits.Bytes = append(bits.Bytes, 0)
+		}
+		bits.Bytes[i/8] |= 0x80 >> uint(i%8)
+		bits.BitLength = i + 1
+	}
+	return bits
+}
+
+func usageNames(usages interface{}) []string {
+	var names []string
+	switch u := usages.(type) {
+	case map[string]x509.KeyUsage:
+		for name := range u {
+			names = append(names, name)
+		}
+	case map[string]asn1.ObjectIdentifier:
+		for name := range u {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+const (
+	errorTextInvalidKeyUsage    = `"key_usage" %q is not valid, use %s`
+	errorTextInvalidExtKeyUsage = `"ext_key_usage" %q is not valid, use %s`
+)
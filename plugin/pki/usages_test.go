@@ -0,0 +1,82 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestUsageAttributes(t *testing.T) {
+	attributes, err := usageAttributes([]string{"digital_signature", "key_encipherment", "decipher_only"}, []string{"client_auth", "code_signing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certReq := &certificate.Request{
+		Subject:    pkix.Name{CommonName: "usages.example.com"},
+		CsrOrigin:  certificate.LocalGeneratedCSR,
+		KeyType:    certificate.KeyTypeECDSA,
+		KeyCurve:   certificate.EllipticCurveP256,
+		Attributes: attributes,
+	}
+	if err := fake.NewConnector(true, nil).GenerateRequest(nil, certReq); err != nil {
+		t.Fatal(err)
+	}
+	pemBlock, _ := pem.Decode(certReq.GetCSR())
+	csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the extensions are expected to be encoded as they are in a certificate with the same usages
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageDecipherOnly,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := 0
+	for _, ext := range csr.Extensions {
+		for _, certExt := range cert.Extensions {
+			if ext.Id.Equal(certExt.Id) && (ext.Id.Equal(oidExtensionKeyUsage) || ext.Id.Equal(oidExtensionExtKeyUsage)) {
+				if !bytes.Equal(ext.Value, certExt.Value) {
+					t.Fatalf("Expecting extension %s to be %x but got %x", ext.Id, certExt.Value, ext.Value)
+				}
+				found++
+			}
+		}
+	}
+	if found != 2 {
+		t.Fatalf("Expecting the CSR to request key usages and extended key usages but got %v", csr.Extensions)
+	}
+
+	if _, err := usageAttributes([]string{"signing"}, nil); err == nil {
+		t.Fatalf("Expecting an unknown key usage to fail")
+	}
+	if _, err := usageAttributes(nil, []string{"any"}); err == nil {
+		t.Fatalf("Expecting an unknown extended key usage to fail")
+	}
+}
@@ -3,8 +3,12 @@ package pki
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
 	"github.com/Venafi/vcert/v4"
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
@@ -14,6 +18,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,7 +28,8 @@ import (
 const (
 	role_ttl_test_property = int(120)
 	ttl_test_property      = int(48)
-	HTTP_UNAUTHORIZED = 401
+	HTTP_UNAUTHORIZED      = 401
+	HTTP_TOO_MANY_REQUESTS = 429
 )
 
 func sliceContains(slice []string, item string) bool {
@@ -36,6 +42,16 @@ func sliceContains(slice []string, item string) bool {
 	return ok
 }
 
+// sliceContainsFold is like sliceContains but ignores the case, as for DNS names
+func sliceContainsFold(slice []string, item string) bool {
+	for _, s := range slice {
+		if strings.EqualFold(s, item) {
+			return true
+		}
+	}
+	return false
+}
+
 func getHexFormatted(buf []byte, sep string) (string, error) {
 	var ret bytes.Buffer
 	for _, cur := range buf {
@@ -55,6 +71,20 @@ func normalizeSerial(serial string) string {
 	return strings.Replace(strings.ToLower(serial), ":", "-", -1)
 }
 
+// certSerialNumber returns the serial number of a certificate in the colon separated form returned in responses
+func certSerialNumber(cert *x509.Certificate) (string, error) {
+	return getHexFormatted(cert.SerialNumber.Bytes(), ":")
+}
+
+// certStoragePath returns the path a certificate is stored at by common name or serial number. Serial numbers are
+// stored normalized, so lookups by the serial number returned in responses normalize it the same way.
+func certStoragePath(storeBy, commonName, serialNumber string) string {
+	if storeBy == storeByCNString {
+		return "certs/" + commonName
+	}
+	return "certs/" + normalizeSerial(serialNumber)
+}
+
 type RunContext struct {
 	TPPurl              string
 	TPPuser             string
@@ -216,7 +246,7 @@ func getTppConnector(cfg *vcert.Config) (*tpp.Connector, error) {
 func updateAccessToken(cfg *vcert.Config, b *backend, ctx context.Context, req *logical.Request, roleName string) error {
 	tppConnector, _ := getTppConnector(cfg)
 
-	httpClient, err := getHTTPClient(cfg.ConnectionTrust)
+	httpClient, err := configHTTPClient(cfg)
 	if err != nil {
 		return err
 	}
@@ -235,12 +265,23 @@ func updateAccessToken(cfg *vcert.Config, b *backend, ctx context.Context, req *
 			return err
 		}
 
-	} else {
+	} else if err != nil {
 		return err
+	} else {
+		return fmt.Errorf("TPP returned no access token when refreshing it")
 	}
 	return nil
 }
 
+// accessTokenExpired tells if the access token of a Venafi secret has expired, or will within margin, according to the
+// expiration TPP gave when it was issued. Tokens whose expiration is unknown are never considered expired.
+func accessTokenExpired(entry *venafiSecretEntry, now time.Time, margin time.Duration) bool {
+	if entry.AccessToken == "" || entry.AccessTokenExpires == 0 {
+		return false
+	}
+	return !now.Add(margin).Before(time.Unix(entry.AccessTokenExpires, 0))
+}
+
 func storeAccessData(b *backend, ctx context.Context, req *logical.Request, roleName string, resp tpp.OauthRefreshAccessTokenResponse) error {
 	entry, err := b.getRole(ctx, req.Storage, roleName)
 
@@ -259,6 +300,7 @@ func storeAccessData(b *backend, ctx context.Context, req *logical.Request, role
 
 	venafiEntry.AccessToken = resp.Access_token
 	venafiEntry.RefreshToken = resp.Refresh_token
+	venafiEntry.AccessTokenExpires = int64(resp.Expires)
 
 	// Store it
 	jsonEntry, err := logical.StorageEntryJSON(CredentialsRootPath+entry.VenafiSecret, venafiEntry)
@@ -271,7 +313,38 @@ func storeAccessData(b *backend, ctx context.Context, req *logical.Request, role
 	return nil
 }
 
-func getHTTPClient(trustBundlePem string) (*http.Client, error) {
+// setConnectionTrust sets how the config trusts the remote server, from the trust bundle PEM or file of the Venafi
+// secret. Skipping the verification of the server certificate needs an HTTP client of its own.
+func setConnectionTrust(cfg *vcert.Config, entry *venafiSecretEntry) error {
+	if entry.TrustBundlePEM != "" {
+		cfg.ConnectionTrust = entry.TrustBundlePEM
+	} else if entry.TrustBundleFile != "" {
+		trustBundle, err := ioutil.ReadFile(entry.TrustBundleFile)
+		if err != nil {
+			return err
+		}
+		cfg.ConnectionTrust = string(trustBundle)
+	}
+
+	if entry.SkipTLSVerify {
+		client, err := getHTTPClient(cfg.ConnectionTrust, true)
+		if err != nil {
+			return err
+		}
+		cfg.Client = client
+	}
+	return nil
+}
+
+// configHTTPClient returns the HTTP client to connect to TPP with the config
+func configHTTPClient(cfg *vcert.Config) (*http.Client, error) {
+	if cfg.Client != nil {
+		return cfg.Client, nil
+	}
+	return getHTTPClient(cfg.ConnectionTrust, false)
+}
+
+func getHTTPClient(trustBundlePem string, insecureSkipVerify bool) (*http.Client, error) {
 
 	var netTransport = &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
@@ -302,6 +375,7 @@ func getHTTPClient(trustBundlePem string) (*http.Client, error) {
 
 		tlsConfig.RootCAs = trustBundle
 	}
+	tlsConfig.InsecureSkipVerify = insecureSkipVerify // #nosec G402, only set by skip_tls_verify
 
 	tlsConfig.Renegotiation = tls.RenegotiateFreelyAsClient
 	netTransport.TLSClientConfig = tlsConfig
@@ -342,28 +416,17 @@ func copyMap(m map[string]interface{}) map[string]interface{} {
 	return cp
 }
 
+// statusCodeRegex finds the HTTP status in the messages of vcert errors, e.g. "Status: 503 Service Unavailable" or
+// "Invalid status: 500 Internal Server Error"
+var statusCodeRegex = regexp.MustCompile(`(?i)status(?: code)?:\s*(\d{3})\b`)
 
+// getStatusCode returns the HTTP status Venafi answered with, according to the error message, or 0 if there is none
 func getStatusCode(msg string) int64 {
-
-	var statusCode int64
-	splittedMsg := strings.Split(msg, ":")
-
-	for i := 0; i < len(splittedMsg); i++ {
-
-		current := splittedMsg[i]
-		current = strings.TrimSpace(current)
-
-		if current == "Invalid status" {
-
-			status := splittedMsg[i+1]
-			status = strings.TrimSpace(status)
-			splittedStatus := strings.Split(status, " ")
-			statusCode, _ = strconv.ParseInt(splittedStatus[0], 10, 64)
-			break
-
-		}
+	match := statusCodeRegex.FindStringSubmatch(msg)
+	if len(match) < 2 {
+		return 0
 	}
-
+	statusCode, _ := strconv.ParseInt(match[1], 10, 64)
 	return statusCode
 }
 
@@ -376,19 +439,8 @@ func createConfigFromFieldData(data *venafiSecretEntry) (*vcert.Config, error) {
 	cfg.Zone = data.Zone
 	cfg.LogVerbose = true
 
-	trustBundlePath := data.TrustBundleFile
-
-	if trustBundlePath != "" {
-
-		var trustBundlePEM string
-		trustBundle, err := ioutil.ReadFile(trustBundlePath)
-
-		if err != nil {
-			return cfg, err
-		}
-
-		trustBundlePEM = string(trustBundle)
-		cfg.ConnectionTrust = trustBundlePEM
+	if err := setConnectionTrust(cfg, data); err != nil {
+		return cfg, err
 	}
 
 	cfg.ConnectorType = endpoint.ConnectorTypeTPP
@@ -406,7 +458,7 @@ func getAccessData(cfg *vcert.Config) (tpp.OauthRefreshAccessTokenResponse, erro
 
 	var tokenInfoResponse tpp.OauthRefreshAccessTokenResponse
 	tppConnector, _ := getTppConnector(cfg)
-	httpClient, err := getHTTPClient(cfg.ConnectionTrust)
+	httpClient, err := configHTTPClient(cfg)
 
 	if err != nil {
 		return tokenInfoResponse, err
@@ -422,4 +474,53 @@ func getAccessData(cfg *vcert.Config) (tpp.OauthRefreshAccessTokenResponse, erro
 
 	return tokenInfoResponse, err
 
-}
\ No newline at end of file
+}
+
+// parsePrivateKeyPEM decodes a PEM private key, decrypting it with password if it's encrypted
+func parsePrivateKeyPEM(privateKeyPEM string, password string) (crypto.Signer, error) {
+	pemBlock, _ := pem.Decode([]byte(privateKeyPEM))
+	if pemBlock == nil {
+		return nil, fmt.Errorf("private key contains no PEM data")
+	}
+
+	keyBytes := pemBlock.Bytes
+	if x509.IsEncryptedPEMBlock(pemBlock) {
+		var err error
+		keyBytes, err = x509.DecryptPEMBlock(pemBlock, []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key: %s", err)
+		}
+	} else if pemBlock.Type == "ENCRYPTED PRIVATE KEY" {
+		var err error
+		keyBytes, err = decryptPKCS8(pemBlock.Bytes, []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key: %s", err)
+		}
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(keyBytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(keyBytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse private key of type %s", pemBlock.Type)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key of type %s", pemBlock.Type)
+	}
+	return signer, nil
+}
+
+// generateKeyPassword returns a random password to protect private keys while in transit from Venafi. It includes upper
+// case, lower case, digit and symbol characters so it meets the default TPP password complexity rules.
+func generateKeyPassword() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "Vault-" + hex.EncodeToString(buf) + "!", nil
+}
@@ -0,0 +1,211 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	validatorRequireOCSP = "require_ocsp"
+	validatorNotCA       = "not_ca"
+	validatorMinKeyBits  = "min_key_bits"
+	validatorRootSHA256  = "root_sha256"
+
+	verifyChainOff   = "off"
+	verifyChainWarn  = "warn"
+	verifyChainError = "error"
+)
+
+// validatorRule is a post-issuance check of the role, written as "name" or "name=value"
+type validatorRule struct {
+	rule  string
+	name  string
+	value string
+}
+
+func parseValidatorRules(rules []string) ([]validatorRule, error) {
+	var parsed []validatorRule
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		name, value := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, value = strings.TrimSpace(rule[:i]), strings.TrimSpace(rule[i+1:])
+		}
+
+		switch name {
+		case validatorRequireOCSP, validatorNotCA:
+			if value != "" {
+				return nil, fmt.Errorf("validator %s doesn't take a value", name)
+			}
+		case validatorMinKeyBits:
+			bits, err := strconv.Atoi(value)
+			if err != nil || bits <= 0 {
+				return nil, fmt.Errorf("validator %s requires a positive number of bits, got %q", name, value)
+			}
+		case validatorRootSHA256:
+			fingerprint, err := hex.DecodeString(normalizeFingerprint(value))
+			if err != nil || len(fingerprint) != sha256.Size {
+				return nil, fmt.Errorf("validator %s requires a SHA-256 fingerprint, got %q", name, value)
+			}
+			value = normalizeFingerprint(value)
+		default:
+			return nil, fmt.Errorf("unknown validator %s, can be %s, %s, %s=<bits> or %s=<fingerprint>", name,
+				validatorRequireOCSP, validatorNotCA, validatorMinKeyBits, validatorRootSHA256)
+		}
+		parsed = append(parsed, validatorRule{rule: rule, name: name, value: value})
+	}
+	return parsed, nil
+}
+
+// validateIssuedCertificate runs the role validators against the issued certificate and its chain, returning an error
+// naming the first rule that fails. Several root_sha256 rules are accepted as alternative approved roots.
+func validateIssuedCertificate(rules []string, cert *x509.Certificate, chain []string) error {
+	parsed, err := parseValidatorRules(rules)
+	if err != nil {
+		return err
+	}
+
+	var approvedRoots []validatorRule
+	for _, rule := range parsed {
+		var ruleErr error
+		switch rule.name {
+		case validatorRequireOCSP:
+			if len(cert.OCSPServer) == 0 {
+				ruleErr = fmt.Errorf("certificate has no OCSP URL")
+			}
+		case validatorNotCA:
+			if cert.IsCA {
+				ruleErr = fmt.Errorf("certificate is a CA")
+			}
+		case validatorMinKeyBits:
+			minBits, _ := strconv.Atoi(rule.value)
+			bits := publicKeyBits(cert)
+			if bits < minBits {
+				ruleErr = fmt.Errorf("certificate key has %d bits", bits)
+			}
+		case validatorRootSHA256:
+			approvedRoots = append(approvedRoots, rule)
+		}
+		if ruleErr != nil {
+			return fmt.Errorf(errorTextValidatorFailed, rule.rule, ruleErr)
+		}
+	}
+
+	if len(approvedRoots) > 0 {
+		root, err := findRoot(chain)
+		if err != nil {
+			return fmt.Errorf(errorTextValidatorFailed, approvedRoots[0].rule, err)
+		}
+		sum := sha256.Sum256(root.Raw)
+		fingerprint := hex.EncodeToString(sum[:])
+		for _, rule := range approvedRoots {
+			if rule.value == fingerprint {
+				return nil
+			}
+		}
+		return fmt.Errorf(errorTextValidatorFailed, approvedRoots[0].rule, fmt.Errorf("chain terminates at root %s with fingerprint %s", root.Subject.CommonName, fingerprint))
+	}
+	return nil
+}
+
+func publicKeyBits(cert *x509.Certificate) int {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	}
+	return 0
+}
+
+// findRoot returns the self-signed certificate of the chain, whatever the chain order is
+func findRoot(chain []string) (*x509.Certificate, error) {
+	for _, c := range chain {
+		pemBlock, _ := pem.Decode([]byte(c))
+		if pemBlock == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(pemBlock.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("chain doesn't terminate at a root certificate")
+}
+
+// verifyIssuedChain checks that the chain returned by Venafi links the certificate to its issuers, each certificate being
+// signed by another one of the chain whatever the chain order is, and that the certificate matches the requested common
+// name and DNS names. It returns every problem found so they can be reported as warnings.
+func verifyIssuedChain(cert *x509.Certificate, chain []string, commonName string, dnsNames []string) []error {
+	var problems []error
+	var remaining []*x509.Certificate
+	for _, c := range chain {
+		pemBlock, _ := pem.Decode([]byte(c))
+		if pemBlock == nil {
+			problems = append(problems, fmt.Errorf("chain contains data that is not a PEM certificate"))
+			continue
+		}
+		chainCert, err := x509.ParseCertificate(pemBlock.Bytes)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("failed to parse chain certificate: %s", err))
+			continue
+		}
+		remaining = append(remaining, chainCert)
+	}
+
+	current := cert
+	for len(remaining) > 0 && !bytes.Equal(current.RawSubject, current.RawIssuer) {
+		issuer := -1
+		for i, c := range remaining {
+			if current.CheckSignatureFrom(c) == nil {
+				issuer = i
+				break
+			}
+		}
+		if issuer < 0 {
+			problems = append(problems, fmt.Errorf("certificate %q is not signed by any certificate of the chain, its issuer is %q",
+				current.Subject.CommonName, current.Issuer.CommonName))
+			//the certificates left can't be placed in the chain, only the broken link is reported
+			remaining = nil
+			break
+		}
+		current = remaining[issuer]
+		remaining = append(remaining[:issuer], remaining[issuer+1:]...)
+	}
+	for _, c := range remaining {
+		problems = append(problems, fmt.Errorf("chain certificate %q doesn't issue any certificate of the chain", c.Subject.CommonName))
+	}
+
+	if commonName != "" && !strings.EqualFold(cert.Subject.CommonName, commonName) && !sliceContainsFold(cert.DNSNames, commonName) {
+		problems = append(problems, fmt.Errorf("certificate common name %q doesn't match the requested %q", cert.Subject.CommonName, commonName))
+	}
+	for _, name := range dnsNames {
+		if !sliceContainsFold(cert.DNSNames, name) {
+			problems = append(problems, fmt.Errorf("certificate doesn't include the requested DNS name %q", name))
+		}
+	}
+	return problems
+}
+
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", "-", "", " ", "").Replace(fingerprint))
+}
+
+const (
+	errorTextValidatorFailed   = `certificate failed post-issuance validation rule "%s": %s`
+	errorTextChainVerification = `certificate failed chain verification: %s`
+)
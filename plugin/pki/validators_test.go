@@ -0,0 +1,169 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateIssuedCertificate(t *testing.T) {
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCert, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER}))
+	rootSum := sha256.Sum256(rootDER)
+	rootFingerprint := hex.EncodeToString(rootSum[:])
+
+	leafKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{"http://ocsp.example.com"},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, rootCert, &leafKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCert, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		rules       []string
+		chain       []string
+		failedRule  string
+		failedError string
+	}{
+		{[]string{validatorRequireOCSP, validatorNotCA, "min_key_bits=1024", "root_sha256=" + rootFingerprint}, []string{rootPEM}, "", ""},
+		{[]string{"min_key_bits=2048"}, nil, "min_key_bits=2048", "certificate key has 1024 bits"},
+		{[]string{"root_sha256=" + rootFingerprint}, nil, "root_sha256=" + rootFingerprint, "chain doesn't terminate at a root certificate"},
+		{[]string{"root_sha256=" + rootFingerprint[2:] + "00"}, []string{rootPEM}, "root_sha256=" + rootFingerprint[2:] + "00",
+			fmt.Sprintf("chain terminates at root Test Root with fingerprint %s", rootFingerprint)},
+	}
+	for _, c := range cases {
+		err := validateIssuedCertificate(c.rules, leafCert, c.chain)
+		if c.failedRule == "" {
+			if err != nil {
+				t.Fatalf("Expecting rules %v to pass but got %s", c.rules, err)
+			}
+			continue
+		}
+		expectingError := fmt.Sprintf(errorTextValidatorFailed, c.failedRule, c.failedError)
+		if err == nil || err.Error() != expectingError {
+			t.Fatalf("Expecting error %s but got %v", expectingError, err)
+		}
+	}
+
+	err = validateIssuedCertificate([]string{validatorNotCA}, rootCert, nil)
+	if err == nil || err.Error() != fmt.Sprintf(errorTextValidatorFailed, validatorNotCA, "certificate is a CA") {
+		t.Fatalf("Expecting %s rule to fail for a CA but got %v", validatorNotCA, err)
+	}
+}
+
+func TestParseValidatorRules(t *testing.T) {
+	for _, rule := range []string{"must_be_nice", "min_key_bits=big", "not_ca=true", "root_sha256=abcd"} {
+		if _, err := parseValidatorRules([]string{rule}); err == nil {
+			t.Fatalf("Expecting rule %s to be rejected", rule)
+		}
+	}
+}
+
+func TestVerifyIssuedChain(t *testing.T) {
+	newCert := func(template, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey, string) {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.NotBefore = time.Now()
+		template.NotAfter = time.Now().Add(time.Hour)
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	caTemplate := func(serial int64, cn string) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: cn},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+	}
+
+	rootCert, rootKey, rootPEM := newCert(caTemplate(1, "Test Root"), nil, nil)
+	issuingCert, issuingKey, issuingPEM := newCert(caTemplate(2, "Test Issuing CA"), rootCert, rootKey)
+	_, _, otherPEM := newCert(caTemplate(3, "Other Root"), nil, nil)
+	leafCert, _, _ := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		DNSNames:     []string{"leaf.example.com", "www.example.com"},
+	}, issuingCert, issuingKey)
+
+	//the chain is accepted in both orders
+	for _, chain := range [][]string{{issuingPEM, rootPEM}, {rootPEM, issuingPEM}, {issuingPEM}} {
+		if problems := verifyIssuedChain(leafCert, chain, "leaf.example.com", []string{"www.example.com"}); len(problems) > 0 {
+			t.Fatalf("Expecting the chain to be valid but got %v", problems)
+		}
+	}
+
+	cases := []struct {
+		chain      []string
+		commonName string
+		dnsNames   []string
+		problem    string
+	}{
+		{[]string{otherPEM}, "leaf.example.com", nil, "is not signed by any certificate of the chain"},
+		{[]string{issuingPEM, rootPEM, otherPEM}, "leaf.example.com", nil, `chain certificate "Other Root"`},
+		{[]string{"garbage"}, "leaf.example.com", nil, "not a PEM certificate"},
+		{[]string{issuingPEM}, "other.example.com", nil, "doesn't match the requested"},
+		{[]string{issuingPEM}, "leaf.example.com", []string{"api.example.com"}, `requested DNS name "api.example.com"`},
+	}
+	for _, c := range cases {
+		problems := verifyIssuedChain(leafCert, c.chain, c.commonName, c.dnsNames)
+		if len(problems) != 1 || !strings.Contains(problems[0].Error(), c.problem) {
+			t.Fatalf("Expecting a problem containing %q but got %v", c.problem, problems)
+		}
+	}
+}
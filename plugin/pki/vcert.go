@@ -7,11 +7,26 @@ import (
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
-	"io/ioutil"
+	"regexp"
+	"strings"
 	"time"
 )
 
+const (
+	//how long before its expiration an access token is refreshed
+	accessTokenExpiryMargin = 1 * time.Minute
+)
+
+// ClientVenafi returns the client of the role. Roles with additional zones get the zone of the request in round robin,
+// which the client keeps for the whole request.
 func (b *backend) ClientVenafi(ctx context.Context, s logical.Storage, data *framework.FieldData, req *logical.Request, roleName string) (
+	endpoint.Connector, time.Duration, error) {
+	return b.clientVenafiInZone(ctx, req, roleName, "")
+}
+
+// clientVenafiInZone returns the client of the role sending requests to zone, or to the next zone of the role when zone
+// is empty
+func (b *backend) clientVenafiInZone(ctx context.Context, req *logical.Request, roleName string, zone string) (
 	endpoint.Connector, time.Duration, error) {
 	b.Logger().Debug(fmt.Sprintf("Using role: %s", roleName))
 	if roleName == "" {
@@ -23,23 +38,108 @@ func (b *backend) ClientVenafi(ctx context.Context, s logical.Storage, data *fra
 		return nil, 0, err
 	}
 	if role == nil {
-		return nil, 0, fmt.Errorf("unknown role %v", role)
+		return nil, 0, fmt.Errorf(errorTextUnknownRole, roleName)
+	}
+
+	//an access token that is known to have expired is refreshed before it's used, instead of failing the request
+	venafiSecret, err := b.getVenafiSecret(ctx, req.Storage, role.VenafiSecret)
+	if err != nil {
+		return nil, 0, err
+	}
+	if venafiSecret != nil && venafiSecret.RefreshToken != "" && accessTokenExpired(venafiSecret, time.Now(), accessTokenExpiryMargin) {
+		b.Logger().Debug(fmt.Sprintf("Access token of venafi secret %s has expired, refreshing it", role.VenafiSecret))
+		cfg, err := b.getConfig(ctx, req, roleName, true)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := updateAccessToken(cfg, b, ctx, req, roleName); err != nil {
+			return nil, 0, fmt.Errorf("failed to refresh access token: %s", err)
+		}
 	}
 
 	cfg, err := b.getConfig(ctx, req, roleName, false)
 	if err != nil {
 		return nil, 0, err
 	}
+	//requests of roles with additional zones are spread across all of them
+	var zones []string
+	if len(role.AdditionalZones) > 0 {
+		zones = roleZones(cfg.Zone, role.AdditionalZones)
+		if zone == "" {
+			zone = b.nextZone(roleName, zones)
+		}
+		cfg.Zone = zone
+		b.Logger().Debug(fmt.Sprintf("Using zone [%s] of the zones of role %s", zone, roleName))
+	}
+	if role.WorkToDoTimeout > 0 && cfg.ConnectorType == endpoint.ConnectorTypeTPP {
+		if err := setWorkToDoTimeout(cfg, role.WorkToDoTimeout); err != nil {
+			return nil, 0, err
+		}
+	}
 
 	client, err := vcert.NewClient(cfg)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get Venafi issuer client: %s", err)
 	}
+	if len(zones) > 0 {
+		client = &zoneConnector{Connector: client, zones: zones, zone: cfg.Zone}
+	}
 
 	return client, role.ServerTimeout, nil
 
 }
 
+// expiredTokenRegex matches the errors of Venafi Platform about expired or revoked access tokens
+var expiredTokenRegex = regexp.MustCompile("(expired|invalid)_token")
+
+// isAuthError validates if Venafi Platform refused the request because the client isn't authenticated anymore, e.g. its
+// access token expired. At this moment the only way to do it is using the error message.
+func isAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return getStatusCode(msg) == HTTP_UNAUTHORIZED || expiredTokenRegex.MatchString(msg) ||
+		strings.Contains(strings.ToLower(msg), "401 unauthorized")
+}
+
+// withReauthentication runs operation with the client and, when Venafi Platform answers that it isn't authenticated,
+// refreshes the access token of the role, or authenticates again with its user and password, and runs it once more with
+// a new client in the same zone, which replaces cl
+func (b *backend) withReauthentication(ctx context.Context, req *logical.Request, data *framework.FieldData, roleName string,
+	cl *endpoint.Connector, operation func(cl endpoint.Connector) error) error {
+
+	err := operation(*cl)
+	if !isAuthError(err) || (*cl).GetType() != endpoint.ConnectorTypeTPP {
+		return err
+	}
+
+	cfg, cfgErr := b.getConfig(ctx, req, roleName, true)
+	if cfgErr != nil {
+		return err
+	}
+	if cfg.Credentials.RefreshToken != "" {
+		b.Logger().Debug(fmt.Sprintf("Venafi Platform refused the access token of role %s, refreshing it", roleName))
+		if refreshErr := updateAccessToken(cfg, b, ctx, req, roleName); refreshErr != nil {
+			return fmt.Errorf("failed to refresh access token after %s: %s", err, refreshErr)
+		}
+	} else if cfg.Credentials.User == "" {
+		//an access token without refresh token can't be renewed by the plugin
+		return err
+	} else {
+		b.Logger().Debug(fmt.Sprintf("Venafi Platform refused the session of role %s, authenticating again", roleName))
+	}
+
+	newCl, _, clErr := b.clientVenafiInZone(ctx, req, roleName, clientZone(*cl))
+	if clErr != nil {
+		return clErr
+	}
+	*cl = newCl
+	return operation(newCl)
+}
+
+// getConfig returns the vcert config of the role, with the zone of the role or else the zone of its Venafi secret. It
+// doesn't pick one of the additional zones of the role, ClientVenafi does.
 func (b *backend) getConfig(ctx context.Context, req *logical.Request, roleName string, includeRefreshToken bool) (*vcert.Config, error) {
 	var cfg *vcert.Config
 	b.Logger().Debug(fmt.Sprintf("Using role: %s", roleName))
@@ -52,7 +152,7 @@ func (b *backend) getConfig(ctx context.Context, req *logical.Request, roleName
 		return nil, err
 	}
 	if role == nil {
-		return nil, fmt.Errorf("unknown role %v", role)
+		return nil, fmt.Errorf(errorTextUnknownRole, roleName)
 	}
 
 	venafiSecret, err := b.getVenafiSecret(ctx, req.Storage, role.VenafiSecret)
@@ -63,16 +163,6 @@ func (b *backend) getConfig(ctx context.Context, req *logical.Request, roleName
 		return nil, fmt.Errorf("unknown venafi secret %v", role.VenafiSecret)
 	}
 
-	var trustBundlePEM string
-	if venafiSecret.TrustBundleFile != "" {
-		b.Logger().Debug(fmt.Sprintf("Reading trust bundle from file: " + venafiSecret.TrustBundleFile))
-		trustBundle, err := ioutil.ReadFile(venafiSecret.TrustBundleFile)
-		if err != nil {
-			return cfg, err
-		}
-		trustBundlePEM = string(trustBundle)
-	}
-
 	//If the role has a Zone declared, it takes priority over the Zone in the Venafi secret
 	var zone string
 	if role.Zone != "" {
@@ -87,14 +177,18 @@ func (b *backend) getConfig(ctx context.Context, req *logical.Request, roleName
 	cfg.BaseUrl = venafiSecret.URL
 	cfg.Zone = zone
 	cfg.LogVerbose = true
-	if trustBundlePEM != "" {
-		cfg.ConnectionTrust = trustBundlePEM
+	if venafiSecret.TrustBundleFile != "" {
+		b.Logger().Debug(fmt.Sprintf("Reading trust bundle from file: " + venafiSecret.TrustBundleFile))
+	}
+	if err := setConnectionTrust(cfg, venafiSecret); err != nil {
+		return cfg, err
 	}
 
 	if venafiSecret.Fakemode {
 		b.Logger().Debug("Using fakemode to issue certificate")
 		cfg = &vcert.Config{
 			ConnectorType: endpoint.ConnectorTypeFake,
+			Zone:          zone,
 			LogVerbose:    true,
 		}
 
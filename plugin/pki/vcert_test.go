@@ -10,6 +10,7 @@ import (
 	"github.com/Venafi/vcert/v4"
 	"github.com/Venafi/vcert/v4/pkg/certificate"
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
 	"github.com/hashicorp/vault/sdk/logical"
 	"log"
 	"strings"
@@ -114,3 +115,84 @@ func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
 	}
 	return b, config.StorageView
 }
+
+func TestGetConfigZone(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := integrationTestEnv.Backend
+	ctx := context.Background()
+	s := &logical.InmemStorage{}
+
+	requests := []*logical.Request{
+		{Path: "venafi/tpp", Data: map[string]interface{}{
+			"url": "https://tpp.example.com/vedsdk", "access_token": "token", "zone": "Secret\\Zone"}},
+		{Path: "venafi/fake", Data: map[string]interface{}{"fakemode": true, "zone": "Fake\\Zone"}},
+		{Path: "roles/secret-zone", Data: map[string]interface{}{"venafi_secret": "tpp"}},
+		{Path: "roles/role-zone", Data: map[string]interface{}{"venafi_secret": "tpp", "zone": "Role\\Zone"}},
+		{Path: "roles/fake-role-zone", Data: map[string]interface{}{"venafi_secret": "fake", "zone": "Role\\Zone"}},
+	}
+	for _, req := range requests {
+		req.Operation = logical.UpdateOperation
+		req.Storage = s
+		resp, err := b.HandleRequest(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatalf("failed to write %s: %s", req.Path, resp.Error())
+		}
+	}
+
+	zones := map[string]string{
+		"secret-zone":    "Secret\\Zone",
+		"role-zone":      "Role\\Zone",
+		"fake-role-zone": "Role\\Zone",
+	}
+	for roleName, zone := range zones {
+		cfg, err := b.(*backend).getConfig(ctx, &logical.Request{Storage: s}, roleName, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Zone != zone {
+			t.Fatalf("Expecting zone %s for role %s but got %s", zone, roleName, cfg.Zone)
+		}
+	}
+}
+
+func TestIsAuthError(t *testing.T) {
+	cases := []struct {
+		err  error
+		auth bool
+	}{
+		{nil, false},
+		{fmt.Errorf("Invalid status: 401 Unauthorized"), true},
+		{fmt.Errorf("Unexpected status code on TPP Certificate Request.\n Status:\n 401 Unauthorized. \n Body:\n "), true},
+		{fmt.Errorf("unable to retrieve: Unexpected status code on TPP Certificate Retrieval. Status: 401 Unauthorized"), true},
+		{fmt.Errorf(`{"error":"expired_token","error_description":"Grant has expired"}`), true},
+		{fmt.Errorf("Invalid status: 400 Bad Request"), false},
+		{fmt.Errorf("Failed to retrieve certificate. Status: FAILED"), false},
+	}
+	for _, c := range cases {
+		if isAuthError(c.err) != c.auth {
+			t.Fatalf("Expecting isAuthError %v for %v", c.auth, c.err)
+		}
+	}
+}
+
+func TestWithReauthenticationFake(t *testing.T) {
+	b := &backend{}
+	var cl endpoint.Connector = fake.NewConnector(false, nil)
+	authErr := fmt.Errorf("Invalid status: 401 Unauthorized")
+
+	//the fake connector doesn't authenticate so the operation isn't run again
+	calls := 0
+	err := b.withReauthentication(context.Background(), &logical.Request{}, nil, "role", &cl, func(cl endpoint.Connector) error {
+		calls++
+		return authErr
+	})
+	if err != authErr || calls != 1 {
+		t.Fatalf("Expecting the auth error after a single call but got %v after %d", err, calls)
+	}
+}
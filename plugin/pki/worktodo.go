@@ -0,0 +1,67 @@
+package pki
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Venafi/vcert/v4"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// tppCertificateRetrievePath is the Venafi Platform endpoint certificates are retrieved from, which takes the
+// WorkToDoTimeout parameter
+const tppCertificateRetrievePath = "/vedsdk/certificates/retrieve"
+
+// setWorkToDoTimeout makes the config connect to Venafi Platform with a client that asks it to wait up to timeout for the
+// workflow of a pending certificate on each retrieval. vcert doesn't send the parameter itself, so it's added to the
+// retrieve requests by the client transport. The client timeout is raised by the same amount so the wait isn't cut short.
+func setWorkToDoTimeout(cfg *vcert.Config, timeout time.Duration) error {
+	client, err := configHTTPClient(cfg)
+	if err != nil {
+		return err
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cfg.Client = &http.Client{
+		Transport: &workToDoTransport{base: base, timeout: timeout},
+		Timeout:   client.Timeout + timeout,
+	}
+	return nil
+}
+
+// workToDoTransport adds the WorkToDoTimeout parameter to the certificate retrieve requests sent to Venafi Platform
+type workToDoTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *workToDoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost || req.Body == nil ||
+		!strings.HasSuffix(strings.ToLower(req.URL.Path), tppCertificateRetrievePath) {
+		return t.base.RoundTrip(req)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal(body, &params); err != nil {
+		return nil, err
+	}
+	params["WorkToDoTimeout"] = int64(t.timeout.Seconds())
+	body, err = json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	retrieveReq := req.Clone(req.Context())
+	retrieveReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	retrieveReq.ContentLength = int64(len(body))
+	return t.base.RoundTrip(retrieveReq)
+}
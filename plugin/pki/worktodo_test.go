@@ -0,0 +1,52 @@
+package pki
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Venafi/vcert/v4"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWorkToDoTimeout(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = nil
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode request body: %s", err)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &vcert.Config{}
+	if err := setWorkToDoTimeout(cfg, 45*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Client.Timeout != 75*time.Second {
+		t.Fatalf("client timeout should be raised by the work to do timeout, got %s", cfg.Client.Timeout)
+	}
+
+	post := func(path string) {
+		body := []byte(`{"CertificateDN":"\\VED\\Policy\\cert","Format":"base64"}`)
+		resp, err := cfg.Client.Post(server.URL+path, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	post("/vedsdk/Certificates/Retrieve")
+	if received["WorkToDoTimeout"] != float64(45) {
+		t.Fatalf("retrieve request should have WorkToDoTimeout 45, got %#v", received)
+	}
+	if received["CertificateDN"] != `\VED\Policy\cert` {
+		t.Fatalf("retrieve request parameters should be kept, got %#v", received)
+	}
+
+	post("/vedsdk/Certificates/Request")
+	if _, ok := received["WorkToDoTimeout"]; ok {
+		t.Fatalf("only retrieve requests should have WorkToDoTimeout, got %#v", received)
+	}
+}
@@ -0,0 +1,125 @@
+package pki
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+)
+
+// zoneFailurePeriod is how long a zone that failed on the Venafi side is skipped when picking the zone of a request
+const zoneFailurePeriod = time.Minute
+
+// zoneConnector is the client of a role with additional zones. It knows the zones of the role and the one it sends
+// requests to, so a failing zone can be replaced by the next one.
+type zoneConnector struct {
+	endpoint.Connector
+	zones []string
+	zone  string
+}
+
+func (c *zoneConnector) SetZone(zone string) {
+	c.zone = zone
+	c.Connector.SetZone(zone)
+}
+
+// clientZone returns the zone the client of a role with additional zones sends requests to, or an empty string for the
+// clients of other roles, which use the zone of the role
+func clientZone(cl endpoint.Connector) string {
+	if zc, ok := cl.(*zoneConnector); ok {
+		return zc.zone
+	}
+	return ""
+}
+
+// roleZones returns the zone of the role, or of its Venafi secret, followed by the additional zones of the role
+func roleZones(zone string, additionalZones []string) []string {
+	zones := []string{zone}
+	for _, z := range additionalZones {
+		if z = strings.TrimSpace(z); z != "" && !sliceContains(zones, z) {
+			zones = append(zones, z)
+		}
+	}
+	return zones
+}
+
+// roleZoneKey returns the key of what the backend keeps for a zone of a role
+func roleZoneKey(roleName, zone string) string {
+	return roleName + "\n" + zone
+}
+
+// zoneFailedRecently validates if the zone failed on the Venafi side less than zoneFailurePeriod ago. The caller holds
+// zonesLock.
+func (b *backend) zoneFailedRecently(roleName, zone string, now time.Time) bool {
+	failedAt, ok := b.zoneFailures[roleZoneKey(roleName, zone)]
+	return ok && now.Sub(failedAt) < zoneFailurePeriod
+}
+
+// nextZone picks the zone of a request of the role in round robin, skipping the zones that failed recently. When all
+// of them did, the next one is used anyway.
+func (b *backend) nextZone(roleName string, zones []string) string {
+	b.zonesLock.Lock()
+	defer b.zonesLock.Unlock()
+	if b.zoneRotation == nil {
+		b.zoneRotation = map[string]int{}
+	}
+
+	start := b.zoneRotation[roleName] % len(zones)
+	now := time.Now()
+	for i := 0; i < len(zones); i++ {
+		index := (start + i) % len(zones)
+		if !b.zoneFailedRecently(roleName, zones[index], now) {
+			b.zoneRotation[roleName] = index + 1
+			return zones[index]
+		}
+	}
+	b.zoneRotation[roleName] = start + 1
+	return zones[start]
+}
+
+// markZoneFailed records that the zone failed on the Venafi side, so it's skipped for a while
+func (b *backend) markZoneFailed(roleName, zone string) {
+	b.zonesLock.Lock()
+	defer b.zonesLock.Unlock()
+	if b.zoneFailures == nil {
+		b.zoneFailures = map[string]time.Time{}
+	}
+	b.zoneFailures[roleZoneKey(roleName, zone)] = time.Now()
+}
+
+// failoverZone returns the next zone after the failed one that hasn't been tried and didn't fail recently
+func (b *backend) failoverZone(roleName string, zones []string, tried map[string]bool) (string, bool) {
+	b.zonesLock.Lock()
+	defer b.zonesLock.Unlock()
+	now := time.Now()
+	for _, zone := range zones {
+		if !tried[zone] && !b.zoneFailedRecently(roleName, zone, now) {
+			return zone, true
+		}
+	}
+	return "", false
+}
+
+// withZoneFailover runs operation and, when the zone of the client fails on the Venafi side, runs it again on the next
+// zone of the role, until one succeeds or all were tried. Clients of roles without additional zones run it once.
+func (b *backend) withZoneFailover(roleName string, cl *endpoint.Connector, operation func() error) error {
+	err := operation()
+	tried := map[string]bool{}
+	for isServerError(err) {
+		zc, ok := (*cl).(*zoneConnector)
+		if !ok {
+			return err
+		}
+		tried[zc.zone] = true
+		b.markZoneFailed(roleName, zc.zone)
+		next, ok := b.failoverZone(roleName, zc.zones, tried)
+		if !ok {
+			return err
+		}
+		b.Logger().Warn(fmt.Sprintf("Zone %s of role %s failed, using zone %s: %s", zc.zone, roleName, next, err))
+		zc.SetZone(next)
+		err = operation()
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+func TestRoleZones(t *testing.T) {
+	zones := roleZones(`devops\vault`, []string{` devops\vault-2`, `devops\vault`, "", `devops\vault-3`})
+	expected := []string{`devops\vault`, `devops\vault-2`, `devops\vault-3`}
+	if !reflect.DeepEqual(zones, expected) {
+		t.Fatalf("Expecting zones %v but got %v", expected, zones)
+	}
+}
+
+func TestNextZone(t *testing.T) {
+	b := &backend{}
+	zones := []string{"a", "b", "c"}
+
+	var picked []string
+	for i := 0; i < 4; i++ {
+		picked = append(picked, b.nextZone("role", zones))
+	}
+	if !reflect.DeepEqual(picked, []string{"a", "b", "c", "a"}) {
+		t.Fatalf("Expecting zones to be picked in round robin but got %v", picked)
+	}
+
+	b.markZoneFailed("role", "b")
+	picked = nil
+	for i := 0; i < 3; i++ {
+		picked = append(picked, b.nextZone("role", zones))
+	}
+	if !reflect.DeepEqual(picked, []string{"c", "a", "c"}) {
+		t.Fatalf("Expecting the failed zone to be skipped but got %v", picked)
+	}
+
+	b.markZoneFailed("role", "a")
+	b.markZoneFailed("role", "c")
+	if zone := b.nextZone("role", zones); zone == "" {
+		t.Fatal("Expecting a zone to be picked when all of them failed")
+	}
+	if zone := b.nextZone("other", zones); zone != "a" {
+		t.Fatalf("Expecting zone failures to be kept per role but got %s", zone)
+	}
+}
+
+func TestWithZoneFailover(t *testing.T) {
+	integrationTestEnv, err := newIntegrationTestEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := integrationTestEnv.Backend.(*backend)
+
+	var cl endpoint.Connector = &zoneConnector{Connector: fake.NewConnector(true, nil), zones: []string{"a", "b", "c"}, zone: "a"}
+	var used []string
+	err = b.withZoneFailover("role", &cl, func() error {
+		zone := cl.(*zoneConnector).zone
+		used = append(used, zone)
+		if zone != "c" {
+			return fmt.Errorf("Invalid status: 503 Service Unavailable")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(used, []string{"a", "b", "c"}) {
+		t.Fatalf("Expecting failing zones to be replaced by the next ones but got %v", used)
+	}
+	if zone := b.nextZone("role", []string{"a", "b", "c"}); zone != "c" {
+		t.Fatalf("Expecting the failed zones to be skipped afterwards but got %s", zone)
+	}
+
+	//requests refused for their content aren't sent to another zone
+	used = nil
+	err = b.withZoneFailover("other", &cl, func() error {
+		used = append(used, cl.(*zoneConnector).zone)
+		return fmt.Errorf("Invalid status: 400 Bad Request")
+	})
+	if err == nil || len(used) != 1 {
+		t.Fatalf("Expecting a bad request not to fail over, got %v after zones %v", err, used)
+	}
+
+	//all zones failing returns the last error
+	cl = &zoneConnector{Connector: fake.NewConnector(true, nil), zones: []string{"x", "y"}, zone: "x"}
+	used = nil
+	err = b.withZoneFailover("third", &cl, func() error {
+		used = append(used, cl.(*zoneConnector).zone)
+		return fmt.Errorf("Invalid status: 500 Internal Server Error")
+	})
+	if err == nil || !reflect.DeepEqual(used, []string{"x", "y"}) {
+		t.Fatalf("Expecting every zone to be tried once, got %v after zones %v", err, used)
+	}
+}
+
+func TestClientVenafiZone(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	for path, data := range map[string]map[string]interface{}{
+		"venafi/fake": {"fakemode": true, "zone": "a"},
+		"roles/zones": {"venafi_secret": "fake", "additional_zones": "b,c"},
+	} {
+		resp, err := b.HandleRequest(ctx, &logical.Request{Operation: logical.UpdateOperation, Path: path, Storage: storage, Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatalf("failed to write %s: %s", path, resp.Error())
+		}
+	}
+	req := &logical.Request{Storage: storage}
+
+	//reading the config of the role doesn't move the round robin
+	for i := 0; i < 2; i++ {
+		cfg, err := b.getConfig(ctx, req, "zones", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Zone != "a" {
+			t.Fatalf("Expecting the zone of the role in its config but got %s", cfg.Zone)
+		}
+	}
+
+	var picked []string
+	for i := 0; i < 3; i++ {
+		cl, _, err := b.ClientVenafi(ctx, storage, nil, req, "zones")
+		if err != nil {
+			t.Fatal(err)
+		}
+		picked = append(picked, clientZone(cl))
+	}
+	if !reflect.DeepEqual(picked, []string{"a", "b", "c"}) {
+		t.Fatalf("Expecting each client to get the next zone but got %v", picked)
+	}
+
+	cl, _, err := b.clientVenafiInZone(ctx, req, "zones", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone := clientZone(cl); zone != "b" {
+		t.Fatalf("Expecting a client in zone b but got %s", zone)
+	}
+	cl, _, err = b.ClientVenafi(ctx, storage, nil, req, "zones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone := clientZone(cl); zone != "a" {
+		t.Fatalf("Expecting a client in a given zone not to move the round robin but got %s", zone)
+	}
+}